@@ -4,11 +4,17 @@ import (
 	"flag"
 	"fmt"
 	"github.com/chermehdi/comet/cmd/repl"
+	"github.com/chermehdi/comet/pkg/compiler"
 	"github.com/chermehdi/comet/pkg/debug"
 	eval2 "github.com/chermehdi/comet/pkg/eval"
+	"github.com/chermehdi/comet/pkg/optimize"
 	parser2 "github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/resolve"
+	"github.com/chermehdi/comet/pkg/std"
+	"github.com/chermehdi/comet/pkg/vm"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 const VERSION = "1.0.0"
@@ -26,6 +32,14 @@ version: %s
 
 var filePath = flag.String("file", "", "Path to the file to run")
 var printAst = flag.Bool("debug", false, "Print the ast of the given file")
+var optimizeAst = flag.Bool("optimize", false, "Fold constants and remove dead code before running the given file")
+var useVM = flag.Bool("vm", false, "Compile the given file to bytecode and run it on the virtual machine, only the modules of the standard library can be imported")
+var allowRead = flag.String("allow-read", "", "Directory accessible by the file system builtins, the file system is not accessible if it's empty")
+var allowWrite = flag.Bool("allow-write", false, "Allow the file system builtins to write in the directory given by -allow-read")
+var allowEnv = flag.Bool("allow-env", false, "Allow the programs to read the environment variables")
+var allowExec = flag.Bool("allow-exec", false, "Allow the programs to execute commands")
+var searchPath = flag.String("path", "", "Directories searched for the imported modules, separated like PATH, before the ones listed by "+eval2.SearchPathEnv+
+	". The modules of the standard library take precedence, import a file with the same name with a relative path like \"./strings\"")
 
 func main() {
 	flag.Parse()
@@ -46,12 +60,49 @@ func main() {
 			fmt.Println(p.Errors)
 			return
 		}
+		resolver := resolve.New()
+		resolver.Resolve(rootNode)
+		if resolver.Errors.HasAny() {
+			fmt.Println(resolver.Errors)
+			return
+		}
+		if *optimizeAst {
+			optimizer := optimize.New()
+			optimizer.Debug = *printAst
+			optimizer.Optimize(rootNode)
+			for _, transformation := range optimizer.Report {
+				fmt.Println("optimizer:", transformation)
+			}
+		}
 		if *printAst {
 			p := &debug.PrintingVisitor{}
 			p.VisitRootNode(*rootNode)
 			fmt.Println(p)
 		}
+		// The arguments following the flags are passed to the program.
+		capabilities := std.Capabilities{
+			Root:  *allowRead,
+			Write: *allowWrite,
+			Env:   *allowEnv,
+			Exec:  *allowExec,
+			Exit:  os.Exit,
+			Args:  flag.Args(),
+		}
+		if *useVM {
+			bytecode, err := compiler.New().Compile(rootNode)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			machine := vm.New()
+			machine.Capabilities = capabilities
+			machine.Run(bytecode)
+			return
+		}
 		evaluator := eval2.NewEvaluator()
+		evaluator.Capabilities = capabilities
+		evaluator.Dir = filepath.Dir(*filePath)
+		evaluator.SearchPaths = append(eval2.SearchPaths(*searchPath), eval2.SearchPaths(os.Getenv(eval2.SearchPathEnv))...)
 		evaluator.Eval(rootNode)
 	} else {
 		// REPL MODE
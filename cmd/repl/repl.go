@@ -5,13 +5,18 @@ import (
 	"fmt"
 	eval2 "github.com/chermehdi/comet/pkg/eval"
 	parser2 "github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/resolve"
 	"io"
 	"strings"
 )
 
+// Start runs the REPL, lines are read from reader, and the results and the output of the programs
+// are written to writer.
 func Start(reader io.Reader, writer io.Writer) {
 	scanner := bufio.NewScanner(reader)
 	evaluator := eval2.NewEvaluator()
+	evaluator.Stdout = writer
+	evaluator.Stderr = writer
 
 	for {
 		fmt.Fprint(writer, ">> ")
@@ -28,7 +33,7 @@ func Start(reader io.Reader, writer io.Writer) {
 				break
 			}
 			if line == "/scope" {
-				printScope(evaluator)
+				printScope(writer, evaluator)
 				continue
 			}
 		}
@@ -38,6 +43,12 @@ func Start(reader io.Reader, writer io.Writer) {
 			fmt.Fprintln(writer, p.Errors)
 			continue
 		}
+		resolver := resolve.New(globals(evaluator)...)
+		resolver.Resolve(rootNode)
+		if resolver.Errors.HasAny() {
+			fmt.Fprintln(writer, resolver.Errors)
+			continue
+		}
 		res := evaluator.Eval(rootNode)
 		if res != nil {
 			fmt.Fprintln(writer, res.ToString())
@@ -45,16 +56,27 @@ func Start(reader io.Reader, writer io.Writer) {
 	}
 }
 
-func printScope(eval *eval2.Evaluator) {
-	fmt.Println("==== Variables ====")
+// globals returns the names declared by the previously evaluated lines.
+func globals(eval *eval2.Evaluator) []string {
+	names := make([]string, 0)
+	for cur := eval.Scope; cur != nil; cur = cur.Parent {
+		for name := range cur.Variables {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func printScope(writer io.Writer, eval *eval2.Evaluator) {
+	fmt.Fprintln(writer, "==== Variables ====")
 	scope := eval.Scope
 	for cur := scope; cur != nil; cur = cur.Parent {
 		for k, v := range cur.Variables {
-			fmt.Println(fmt.Sprintf("%s = %v", k, v.Type()))
+			fmt.Fprintf(writer, "%s = %v\n", k, v.Type())
 		}
 	}
-	fmt.Println("==== Types ====")
+	fmt.Fprintln(writer, "==== Types ====")
 	for _, t := range eval.Types {
-		fmt.Println(t.Name)
+		fmt.Fprintln(writer, t.Name)
 	}
 }
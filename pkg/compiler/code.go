@@ -0,0 +1,287 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"strings"
+)
+
+// Instructions is a sequence of encoded instructions, every instruction is an Opcode followed by its operands.
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	// Pushes the constant at the given index of the constant pool.
+	OpConstant Opcode = iota
+	OpNil
+	OpTrue
+	OpFalse
+	OpNop
+	OpPop
+	// Replaces a CometNop on top of the stack by nil, used by the expressions that can have an empty body.
+	OpNopToNil
+
+	// Applies the binary operator at the given index of Operators on the two values on top of the stack.
+	OpBinary
+	OpMinus
+	OpNot
+
+	OpJump
+	// Pops the condition and jumps if it's false, the second operand is the Condition used to report errors.
+	OpJumpIfFalse
+	// Pops a boolean produced by the VM and jumps if it's true.
+	OpJumpIfTrue
+	// Jumps if the value on top of the stack is nil, the value is kept on the stack.
+	OpJumpIfNil
+	// Jumps if the value on top of the stack is not nil, the value is popped otherwise.
+	OpJumpIfNotNil
+	// Short circuits && and ||, the operands are the jump target and the index of the operator in Operators.
+	OpLogical
+	// Converts the right side of && and || to a boolean.
+	OpLogicalRight
+
+	OpGetGlobal
+	OpSetGlobal
+	// Checks that the global can be assigned (it's declared and not a constant).
+	OpCheckGlobal
+	// Declares a global, the second operand is 1 for constants.
+	OpDefineGlobal
+	// Reports an error if the global is a constant.
+	OpCheckRedeclaration
+	OpGetLocal
+	OpSetLocal
+	OpDefineLocal
+	// Clears the locals in [first, first + count), they become undeclared.
+	OpClearLocals
+	// Loads a function to call, reports an error if it's not declared or not callable.
+	OpGetGlobalFunc
+	// Loads the global function like OpGetGlobalFunc, or the builtin at the second operand if the
+	// global is not declared, the declarations of the program take precedence over the builtins.
+	OpGetGlobalOrBuiltin
+	OpGetLocalFunc
+	// Pushes the function being executed.
+	OpCurrentFunc
+
+	OpArray
+	OpIndex
+	// Checks an index assignment target and pushes the current value of the element.
+	OpIndexLoad
+	OpIndexSet
+	// Slices the target, the operand is a bit mask of the bounds present on the stack (start, stop, step).
+	OpSlice
+
+	OpGetField
+	// Checks a field assignment target and pushes the current value of the field.
+	OpFieldLoad
+	OpSetField
+	// Calls the method named by the constant at the first operand, with the given number of arguments.
+	OpCallMethod
+
+	OpCall
+	// Calls a function in place of the current frame, used by `return f(...)`.
+	OpTailCall
+	OpReturn
+
+	// Declares the struct defined by the constant at the given index.
+	OpStruct
+	// Creates an instance of the type named by the constant at the first operand.
+	OpNew
+	// Calls the constructor of the instance created by OpNew, with the given number of arguments.
+	OpInit
+
+	// Pops the value to iterate, checks that it can be iterated and initializes the iterable and counter locals.
+	OpIterCheck
+	// Advances the iteration over the iterable and counter locals (second and third operands), pushes
+	// the value and the key or jumps to the target (first operand) when the iteration is done.
+	OpIterNext
+
+	// Pops a case value and a subject, and pushes true if the subject matches the case.
+	OpMatchCase
+	// Matches the value against the pattern defined by the constant at the given index, pushes the
+	// values bound by the pattern followed by true if it matches, false otherwise.
+	OpMatch
+	// Reports that no arm of a match expression matched the value on top of the stack.
+	OpNoMatch
+	// Reports that the value on top of the stack can't be destructured with the pattern at the given index.
+	OpDestructureError
+	// Reports an error with the message held by the constant at the given index.
+	OpError
+)
+
+// Condition identifies the statement testing a condition, strict mode errors depend on it.
+type Condition byte
+
+const (
+	ConditionIf Condition = iota
+	ConditionExpression
+	ConditionFor
+	ConditionWhile
+)
+
+// Operators are the binary operators referenced by index from OpBinary, OpLogical and OpLogicalRight.
+var Operators = []lexer.Token{
+	lexer.NewToken(lexer.Plus, lexer.Plus),
+	lexer.NewToken(lexer.Minus, lexer.Minus),
+	lexer.NewToken(lexer.Mul, lexer.Mul),
+	lexer.NewToken(lexer.Div, lexer.Div),
+	lexer.NewToken(lexer.Mod, lexer.Mod),
+	lexer.NewToken(lexer.LSHIFT, lexer.LSHIFT),
+	lexer.NewToken(lexer.RSHIFT, lexer.RSHIFT),
+	lexer.NewToken(lexer.GT, lexer.GT),
+	lexer.NewToken(lexer.GTE, lexer.GTE),
+	lexer.NewToken(lexer.LT, lexer.LT),
+	lexer.NewToken(lexer.LTE, lexer.LTE),
+	lexer.NewToken(lexer.EQ, lexer.EQ),
+	lexer.NewToken(lexer.NEQ, lexer.NEQ),
+	lexer.NewToken(lexer.DotDot, lexer.DotDot),
+	lexer.NewToken(lexer.ANDAND, lexer.ANDAND),
+	lexer.NewToken(lexer.OROR, lexer.OROR),
+}
+
+func operatorIndex(op lexer.TokenType) (int, bool) {
+	for i, operator := range Operators {
+		if operator.Type == op {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Definition describes an Opcode, OperandWidths holds the number of bytes of every operand.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:           {"OpConstant", []int{2}},
+	OpNil:                {"OpNil", []int{}},
+	OpTrue:               {"OpTrue", []int{}},
+	OpFalse:              {"OpFalse", []int{}},
+	OpNop:                {"OpNop", []int{}},
+	OpPop:                {"OpPop", []int{}},
+	OpNopToNil:           {"OpNopToNil", []int{}},
+	OpBinary:             {"OpBinary", []int{1}},
+	OpMinus:              {"OpMinus", []int{}},
+	OpNot:                {"OpNot", []int{}},
+	OpJump:               {"OpJump", []int{2}},
+	OpJumpIfFalse:        {"OpJumpIfFalse", []int{2, 1}},
+	OpJumpIfTrue:         {"OpJumpIfTrue", []int{2}},
+	OpJumpIfNil:          {"OpJumpIfNil", []int{2}},
+	OpJumpIfNotNil:       {"OpJumpIfNotNil", []int{2}},
+	OpLogical:            {"OpLogical", []int{2, 1}},
+	OpLogicalRight:       {"OpLogicalRight", []int{1}},
+	OpGetGlobal:          {"OpGetGlobal", []int{2}},
+	OpSetGlobal:          {"OpSetGlobal", []int{2}},
+	OpCheckGlobal:        {"OpCheckGlobal", []int{2}},
+	OpDefineGlobal:       {"OpDefineGlobal", []int{2, 1}},
+	OpCheckRedeclaration: {"OpCheckRedeclaration", []int{2}},
+	OpGetLocal:           {"OpGetLocal", []int{2}},
+	OpSetLocal:           {"OpSetLocal", []int{2}},
+	OpDefineLocal:        {"OpDefineLocal", []int{2}},
+	OpClearLocals:        {"OpClearLocals", []int{2, 2}},
+	OpGetGlobalFunc:      {"OpGetGlobalFunc", []int{2}},
+	OpGetGlobalOrBuiltin: {"OpGetGlobalOrBuiltin", []int{2, 2}},
+	OpGetLocalFunc:       {"OpGetLocalFunc", []int{2}},
+	OpCurrentFunc:        {"OpCurrentFunc", []int{}},
+	OpArray:              {"OpArray", []int{2}},
+	OpIndex:              {"OpIndex", []int{}},
+	OpIndexLoad:          {"OpIndexLoad", []int{}},
+	OpIndexSet:           {"OpIndexSet", []int{}},
+	OpSlice:              {"OpSlice", []int{1}},
+	OpGetField:           {"OpGetField", []int{2}},
+	OpFieldLoad:          {"OpFieldLoad", []int{2}},
+	OpSetField:           {"OpSetField", []int{2}},
+	OpCallMethod:         {"OpCallMethod", []int{2, 1}},
+	OpCall:               {"OpCall", []int{1}},
+	OpTailCall:           {"OpTailCall", []int{1}},
+	OpReturn:             {"OpReturn", []int{}},
+	OpStruct:             {"OpStruct", []int{2}},
+	OpNew:                {"OpNew", []int{2, 1}},
+	OpInit:               {"OpInit", []int{1}},
+	OpIterCheck:          {"OpIterCheck", []int{2, 2}},
+	OpIterNext:           {"OpIterNext", []int{2, 2, 2}},
+	OpMatchCase:          {"OpMatchCase", []int{}},
+	OpMatch:              {"OpMatch", []int{2}},
+	OpNoMatch:            {"OpNoMatch", []int{}},
+	OpDestructureError:   {"OpDestructureError", []int{2}},
+	OpError:              {"OpError", []int{2}},
+}
+
+// Lookup returns the definition of the given Opcode.
+func Lookup(op Opcode) (*Definition, error) {
+	def, found := definitions[op]
+	if !found {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction, operands are written in big endian order.
+func Make(op Opcode, operands ...int) []byte {
+	def, found := definitions[op]
+	if !found {
+		return []byte{}
+	}
+	length := 1
+	for _, width := range def.OperandWidths {
+		length += width
+	}
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+	offset := 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, and returns the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ins[offset])
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one instruction per line prefixed by its offset.
+func (ins Instructions) String() string {
+	var sb strings.Builder
+	for i := 0; i < len(ins); {
+		def, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			fmt.Fprintf(&sb, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&sb, "%04d %s", i, def.Name)
+		for _, operand := range operands {
+			fmt.Fprintf(&sb, " %d", operand)
+		}
+		sb.WriteRune('\n')
+		i += 1 + read
+	}
+	return sb.String()
+}
@@ -0,0 +1,959 @@
+// Package compiler lowers the AST produced by the parser to bytecode executed by the vm package.
+//
+// Variables declared at the top level of a program are globals, any other variable (function
+// parameters, variables declared in function bodies, loops and match arms) is a local stored in a
+// slot of its function's frame. Names are resolved while compiling, a name that is not declared
+// when it's used refers to a global, which allows functions to use globals declared after them.
+package compiler
+
+import (
+	"fmt"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+)
+
+// Bytecode is the result of a compilation.
+type Bytecode struct {
+	// Main holds the top level statements of the program.
+	Main      *CompiledFunction
+	Constants []std.CometObject
+	// The names of the globals, indexed by the global operands.
+	Globals []string
+}
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	// The function being compiled, used by nested functions to call themselves.
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name     string
+	Scope    SymbolScope
+	Index    int
+	Constant bool
+}
+
+// blockScope holds the locals declared in a block of the function being compiled and their stack slots,
+// lookups walk up to the enclosing blocks.
+type blockScope struct {
+	symbols map[string]*Symbol
+	parent  *blockScope
+}
+
+type loopState struct {
+	breaks    []int
+	continues []int
+}
+
+// functionState is the state of the function being compiled.
+type functionState struct {
+	name         string
+	instructions Instructions
+	localNames   []string
+	// nil for the top level scope of the program, where declarations are globals.
+	scope *blockScope
+	loops []*loopState
+	// Set if the function can refer to itself by name without going through a global.
+	nested bool
+	parent *functionState
+	sites  map[int]lexer.Token
+}
+
+type Compiler struct {
+	constants []std.CometObject
+	strings   map[string]int
+	globals   map[string]*Symbol
+	names     []string
+	builtins  map[string]int
+
+	function *functionState
+}
+
+// New creates a compiler, globals and constants are kept between compilations so that a program
+// can be compiled and executed in multiple parts (e.g. by the REPL) using the same VM.
+func New() *Compiler {
+	c := &Compiler{
+		constants: make([]std.CometObject, 0),
+		strings:   make(map[string]int),
+		globals:   make(map[string]*Symbol),
+		names:     make([]string, 0),
+		builtins:  make(map[string]int),
+	}
+	for i, builtin := range std.Builtins {
+		c.builtins[builtin.Name] = i
+	}
+	return c
+}
+
+// Compile compiles the program, the returned error reports constructs that can't be compiled.
+func (c *Compiler) Compile(root *parser.RootNode) (*Bytecode, error) {
+	c.function = &functionState{name: "main"}
+	if err := c.compileStatements(root.Statements); err != nil {
+		return nil, err
+	}
+	c.emit(OpReturn)
+	main := c.leaveFunction(nil, false)
+	return &Bytecode{
+		Main:      main,
+		Constants: c.constants,
+		Globals:   c.names,
+	}, nil
+}
+
+func (c *Compiler) compile(node parser.Node) error {
+	switch n := node.(type) {
+	case *parser.RootNode:
+		return c.compileStatements(n.Statements)
+	case *parser.NumberLiteral:
+		c.emit(OpConstant, c.addConstant(&std.CometInt{Value: n.ActualValue}))
+	case *parser.BigIntLiteral:
+		c.emit(OpConstant, c.addConstant(&std.CometBigInt{Value: n.ActualValue}))
+	case *parser.FloatLiteral:
+		c.emit(OpConstant, c.addConstant(&std.CometFloat{Value: n.ActualValue}))
+	case *parser.StringLiteral:
+		c.emit(OpConstant, c.addConstant(&std.CometStr{Value: n.Value, Size: len(n.Value)}))
+	case *parser.NilLiteral:
+		c.emit(OpNil)
+	case *parser.BooleanLiteral:
+		if n.ActualValue {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *parser.ArrayLiteral:
+		for _, element := range n.Elements {
+			if err := c.compile(element); err != nil {
+				return err
+			}
+		}
+		c.emit(OpArray, len(n.Elements))
+	case *parser.ParenthesisedExpression:
+		return c.compile(n.Expression)
+	case *parser.PrefixExpression:
+		return c.compilePrefixExpression(n)
+	case *parser.BinaryExpression:
+		return c.compileBinaryExpression(n)
+	case *parser.ConditionalExpression:
+		return c.compileConditional(n.Test, ConditionExpression, n.Then, n.Else, false)
+	case *parser.IfStatement:
+		return c.compileConditional(n.Test, ConditionIf, &n.Then, &n.Else, true)
+	case *parser.BlockStatement:
+		return c.compileStatements(n.Statements)
+	case *parser.ReturnStatement:
+		if call, ok := n.Expression.(*parser.CallExpression); ok && c.function.parent != nil {
+			return c.compileCall(call, true)
+		}
+		if err := c.compile(n.Expression); err != nil {
+			return err
+		}
+		c.emit(OpReturn)
+	case *parser.DeclarationStatement:
+		return c.compileDeclaration(n.Identifier.Literal, n.Expression, n.Constant)
+	case *parser.DestructuringStatement:
+		return c.compileDestructuring(n)
+	case *parser.IdentifierExpression:
+		c.load(c.resolve(n.Name))
+	case *parser.FunctionStatement:
+		return c.compileFunctionStatement(n)
+	case *parser.CallExpression:
+		return c.compileCall(n, false)
+	case *parser.AssignExpression:
+		return c.compileAssign(n)
+	case *parser.IndexAccess:
+		if err := c.compileAll(n.Identifier, n.Index); err != nil {
+			return err
+		}
+		c.emit(OpIndex)
+	case *parser.SliceExpression:
+		return c.compileSlice(n)
+	case *parser.IndexAssignExpression:
+		if err := c.compileAll(n.Target.Identifier, n.Target.Index); err != nil {
+			return err
+		}
+		c.emit(OpIndexLoad)
+		return c.compileAssignedValue(n.Op, n.Value, OpIndexSet)
+	case *parser.ForStatement:
+		return c.compileForStatement(n)
+	case *parser.ForClauseStatement:
+		return c.compileForClauseStatement(n)
+	case *parser.WhileStatement:
+		return c.compileWhileStatement(n)
+	case *parser.BreakStatement:
+		return c.compileLoopJump(n.Token, true)
+	case *parser.ContinueStatement:
+		return c.compileLoopJump(n.Token, false)
+	case *parser.SwitchStatement:
+		return c.compileSwitchStatement(n)
+	case *parser.MatchExpression:
+		return c.compileMatchExpression(n)
+	case *parser.StructDeclarationStatement:
+		return c.compileStructDeclaration(n)
+	case *parser.ImportStatement:
+		return c.compileImport(n)
+	case *parser.NewCallExpr:
+		if n.Module != "" {
+			return fmt.Errorf("cannot compile new %s.%s, modules are only supported by the evaluator", n.Module, n.Type)
+		}
+		c.emit(OpNew, c.addString(n.Type), len(n.Args))
+		for _, arg := range n.Args {
+			if err := c.compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(OpInit, len(n.Args))
+	default:
+		return fmt.Errorf("cannot compile node %s", node.Literal())
+	}
+	return nil
+}
+
+// compileStatements compiles a sequence of statements, leaving the value of the last one on the
+// stack, or a CometNop if there are no statements.
+func (c *Compiler) compileStatements(statements []parser.Statement) error {
+	if len(statements) == 0 {
+		c.emit(OpNop)
+		return nil
+	}
+	for i, statement := range statements {
+		if err := c.compile(statement); err != nil {
+			return err
+		}
+		if i < len(statements)-1 {
+			c.emit(OpPop)
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileAll(nodes ...parser.Node) error {
+	for _, node := range nodes {
+		if err := c.compile(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compilePrefixExpression(n *parser.PrefixExpression) error {
+	if err := c.compile(n.Right); err != nil {
+		return err
+	}
+	switch n.Op.Type {
+	case lexer.Minus:
+		c.emit(OpMinus)
+	case lexer.Bang:
+		c.emit(OpNot)
+	default:
+		c.emitError("Unrecognized prefix operator %s", n.Op.Literal)
+	}
+	return nil
+}
+
+func (c *Compiler) compileBinaryExpression(n *parser.BinaryExpression) error {
+	if isMemberAccess(n) {
+		jumps, err := c.compileMemberChain(n)
+		for _, jump := range jumps {
+			c.patchJump(jump)
+		}
+		return err
+	}
+	if err := c.compile(n.Left); err != nil {
+		return err
+	}
+	switch n.Op.Type {
+	case lexer.Coalesce:
+		end := c.emitJump(OpJumpIfNotNil)
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		c.patchJump(end)
+		return nil
+	}
+	op, found := operatorIndex(n.Op.Type)
+	if !found {
+		return fmt.Errorf("cannot compile binary operator %s", n.Op.Literal)
+	}
+	if n.Op.Type == lexer.ANDAND || n.Op.Type == lexer.OROR {
+		end := c.emitJump(OpLogical, op)
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		c.emit(OpLogicalRight, op)
+		c.patchJump(end)
+		return nil
+	}
+	if err := c.compile(n.Right); err != nil {
+		return err
+	}
+	c.emit(OpBinary, op)
+	return nil
+}
+
+// compileMemberChain compiles a chain of '.' and '?.' operators. Safe navigation: accessing anything
+// on nil with '?.' yields nil, and skips the rest of the chain. The returned jumps must be patched to
+// the end of the chain.
+func (c *Compiler) compileMemberChain(n *parser.BinaryExpression) ([]int, error) {
+	var jumps []int
+	if inner, ok := n.Left.(*parser.BinaryExpression); ok && isMemberAccess(inner) {
+		var err error
+		if jumps, err = c.compileMemberChain(inner); err != nil {
+			return jumps, err
+		}
+	} else if err := c.compile(n.Left); err != nil {
+		return jumps, err
+	}
+	if n.Op.Type == lexer.QuestionDot {
+		jumps = append(jumps, c.emitJump(OpJumpIfNil))
+	}
+	return jumps, c.compileDotAccess(n.Right)
+}
+
+// isMemberAccess returns true for the '.' and '?.' operators.
+func isMemberAccess(n *parser.BinaryExpression) bool {
+	return n.Op.Type == lexer.Dot || n.Op.Type == lexer.QuestionDot
+}
+
+// compileDotAccess compiles the right side of a '.' operator, the left side is on top of the stack.
+func (c *Compiler) compileDotAccess(right parser.Expression) error {
+	switch n := right.(type) {
+	case *parser.AssignExpression:
+		field := c.addString(n.VarName)
+		c.emit(OpFieldLoad, field)
+		return c.compileAssignedValue(n.Op, n.Value, OpSetField, field)
+	case *parser.IdentifierExpression:
+		c.emit(OpGetField, c.addString(n.Name))
+	case *parser.CallExpression:
+		for _, arg := range n.Arguments {
+			if err := c.compile(arg); err != nil {
+				return err
+			}
+		}
+		c.addSite(c.emit(OpCallMethod, c.addString(n.Name), len(n.Arguments)), n.Token)
+	default:
+		c.emit(OpPop)
+		c.emitError("Used '.' operator with none function element")
+	}
+	return nil
+}
+
+// compileAssignedValue compiles the value of an assignment and the store instruction, the current
+// value of the target is on top of the stack. For compound assignments the operator is applied on
+// the current value, like in the expanded form: target = target op value.
+func (c *Compiler) compileAssignedValue(op lexer.Token, value parser.Expression, store Opcode, operands ...int) error {
+	if op.Type == "" {
+		c.emit(OpPop)
+	}
+	if err := c.compile(value); err != nil {
+		return err
+	}
+	if op.Type != "" {
+		index, found := operatorIndex(op.Type)
+		if !found {
+			return fmt.Errorf("cannot compile compound operator %s", op.Literal)
+		}
+		c.emit(OpBinary, index)
+	}
+	c.emit(store, operands...)
+	return nil
+}
+
+// compileConditional compiles if statements and conditional expressions, the value of an if
+// statement with an empty branch is nil.
+func (c *Compiler) compileConditional(test parser.Expression, condition Condition, then, otherwise parser.Node, statement bool) error {
+	if err := c.compile(test); err != nil {
+		return err
+	}
+	elseJump := c.emitJump(OpJumpIfFalse, int(condition))
+	if err := c.compile(then); err != nil {
+		return err
+	}
+	end := c.emitJump(OpJump)
+	c.patchJump(elseJump)
+	if err := c.compile(otherwise); err != nil {
+		return err
+	}
+	c.patchJump(end)
+	if statement {
+		c.emit(OpNopToNil)
+	}
+	return nil
+}
+
+func (c *Compiler) compileDeclaration(name string, value parser.Expression, constant bool) error {
+	c.checkLocalRedeclaration(name)
+	if err := c.compile(value); err != nil {
+		return err
+	}
+	c.define(name, constant)
+	return nil
+}
+
+// checkRedeclaration reports an error if name is a constant, the redeclarations of the global
+// constants are checked at runtime by OpCheckRedeclaration.
+func (c *Compiler) checkRedeclaration(name string) {
+	if c.function.scope == nil {
+		c.emit(OpCheckRedeclaration, c.global(name).Index)
+		return
+	}
+	c.checkLocalRedeclaration(name)
+}
+
+// checkLocalRedeclaration reports an error if name is a constant of the current local scope, it
+// does nothing for the globals.
+func (c *Compiler) checkLocalRedeclaration(name string) {
+	if c.function.scope == nil {
+		return
+	}
+	if symbol, found := c.function.scope.symbols[name]; found && symbol.Constant {
+		c.emitError("Cannot redeclare constant '%s'", name)
+	}
+}
+
+// compileImport binds the module of the standard library, or the given members of the module. The
+// modules written in Comet are only supported by the evaluator.
+func (c *Compiler) compileImport(n *parser.ImportStatement) error {
+	module, found := std.Modules[n.Path]
+	if !found {
+		return fmt.Errorf("cannot compile the import of %s, only the modules of the standard library are supported by the vm", n.Path)
+	}
+	if n.Alias != "" {
+		c.checkRedeclaration(n.Alias)
+		c.emit(OpConstant, c.addConstant(module))
+		c.define(n.Alias, true)
+		c.emit(OpPop)
+	}
+	for _, name := range n.Names {
+		value := module.GetField(name.Name)
+		if err, ok := value.(*std.CometError); ok {
+			c.emitError("%s", err.Message)
+			return nil
+		}
+		c.checkRedeclaration(name.Name)
+		c.emit(OpConstant, c.addConstant(value))
+		c.define(name.Name, true)
+		c.emit(OpPop)
+	}
+	c.emit(OpNop)
+	return nil
+}
+
+func (c *Compiler) compileDestructuring(n *parser.DestructuringStatement) error {
+	pattern := newPatternDefinition(n.Pattern)
+	if err := c.compile(n.Expression); err != nil {
+		return err
+	}
+	value := c.addTemporary()
+	c.emit(OpSetLocal, value)
+	c.emit(OpPop)
+	constant := c.addConstant(pattern)
+	if err := c.compileMatch(value, pattern, constant); err != nil {
+		return err
+	}
+	matched := c.emitJump(OpJumpIfTrue)
+	c.emit(OpGetLocal, value)
+	c.emit(OpDestructureError, constant)
+	c.patchJump(matched)
+	// Names are only declared if the whole pattern matches, and none of them is a constant.
+	for _, name := range pattern.Names {
+		c.checkRedeclaration(name)
+	}
+	for i := len(pattern.Names) - 1; i >= 0; i-- {
+		c.define(pattern.Names[i], n.Constant)
+		c.emit(OpPop)
+	}
+	c.emit(OpGetLocal, value)
+	return nil
+}
+
+// compileMatch pushes the value held by the given local and the values of the literal patterns
+// before matching them against the pattern.
+func (c *Compiler) compileMatch(value int, pattern *PatternDefinition, constant int) error {
+	c.emit(OpGetLocal, value)
+	for _, literal := range pattern.Literals {
+		if err := c.compile(literal.Value); err != nil {
+			return err
+		}
+	}
+	c.emit(OpMatch, constant)
+	return nil
+}
+
+func (c *Compiler) compileFunctionStatement(n *parser.FunctionStatement) error {
+	nested := c.function.scope != nil || c.function.parent != nil
+	fn, err := c.compileFunction(n.Name, n.Parameters, n.Block, false, nested)
+	if err != nil {
+		return err
+	}
+	c.checkLocalRedeclaration(n.Name)
+	c.emit(OpConstant, c.addConstant(fn))
+	c.define(n.Name, false)
+	return nil
+}
+
+func (c *Compiler) compileFunction(name string, params []*parser.IdentifierExpression, body *parser.BlockStatement, method, nested bool) (*CompiledFunction, error) {
+	c.function = &functionState{
+		name:   name,
+		scope:  &blockScope{symbols: make(map[string]*Symbol)},
+		nested: nested,
+		parent: c.function,
+	}
+	if method {
+		c.defineLocal("this", false)
+	}
+	for _, param := range params {
+		c.defineLocal(param.Name, false)
+	}
+	if err := c.compileStatements(body.Statements); err != nil {
+		c.function = c.function.parent
+		return nil, err
+	}
+	// Functions that complete without a return statement yield nil.
+	c.emit(OpPop)
+	c.emit(OpNil)
+	c.emit(OpReturn)
+	return c.leaveFunction(params, method), nil
+}
+
+func (c *Compiler) leaveFunction(params []*parser.IdentifierExpression, method bool) *CompiledFunction {
+	state := c.function
+	c.function = state.parent
+	return &CompiledFunction{
+		Name:         state.name,
+		Instructions: state.instructions,
+		Params:       params,
+		Method:       method,
+		NumLocals:    len(state.localNames),
+		LocalNames:   state.localNames,
+		Sites:        state.sites,
+	}
+}
+
+// compileCall compiles a function call, returned is set for the call of a return statement.
+// Like in the evaluator, only the functions declared outside of the current call are called in
+// place of the current frame.
+func (c *Compiler) compileCall(n *parser.CallExpression, returned bool) error {
+	tail := returned
+	// Declared functions take precedence over the builtins, globals are only known at runtime.
+	builtin, isBuiltin := c.builtins[n.Name]
+	symbol := c.resolve(n.Name)
+	switch symbol.Scope {
+	case GlobalScope:
+		if isBuiltin {
+			c.emit(OpGetGlobalOrBuiltin, symbol.Index, builtin)
+			tail = false
+		} else {
+			c.emit(OpGetGlobalFunc, symbol.Index)
+		}
+	case LocalScope:
+		c.emit(OpGetLocalFunc, symbol.Index)
+		tail = false
+	case FunctionScope:
+		c.emit(OpCurrentFunc)
+	}
+	for _, arg := range n.Arguments {
+		if err := c.compile(arg); err != nil {
+			return err
+		}
+	}
+	if tail {
+		c.addSite(c.emit(OpTailCall, len(n.Arguments)), n.Token)
+		return nil
+	}
+	c.addSite(c.emit(OpCall, len(n.Arguments)), n.Token)
+	if returned {
+		c.emit(OpReturn)
+	}
+	return nil
+}
+
+// addSite records the call expression of the call instruction at the given offset.
+func (c *Compiler) addSite(offset int, site lexer.Token) {
+	if c.function.sites == nil {
+		c.function.sites = make(map[int]lexer.Token)
+	}
+	c.function.sites[offset] = site
+}
+
+func (c *Compiler) compileAssign(n *parser.AssignExpression) error {
+	symbol := c.resolveVariable(n.VarName)
+	if symbol.Scope == GlobalScope {
+		c.emit(OpCheckGlobal, symbol.Index)
+		c.emit(OpGetGlobal, symbol.Index)
+		return c.compileAssignedValue(n.Op, n.Value, OpSetGlobal, symbol.Index)
+	}
+	c.emit(OpGetLocal, symbol.Index)
+	if symbol.Constant {
+		c.emitError("Cannot assign to constant '%s'", n.VarName)
+	}
+	return c.compileAssignedValue(n.Op, n.Value, OpSetLocal, symbol.Index)
+}
+
+func (c *Compiler) compileSlice(n *parser.SliceExpression) error {
+	if err := c.compile(n.Target); err != nil {
+		return err
+	}
+	mask := 0
+	for i, bound := range []parser.Expression{n.Start, n.Stop, n.Step} {
+		if bound == nil {
+			continue
+		}
+		if err := c.compile(bound); err != nil {
+			return err
+		}
+		mask |= 1 << uint(i)
+	}
+	c.emit(OpSlice, mask)
+	return nil
+}
+
+func (c *Compiler) compileForStatement(n *parser.ForStatement) error {
+	if err := c.compile(n.Range); err != nil {
+		return err
+	}
+	iterable, counter := c.addTemporary(), c.addTemporary()
+	c.emit(OpIterCheck, iterable, counter)
+	c.enterScope()
+	key := c.defineLocal(n.Key.Name, false)
+	value := c.defineLocal(n.Value.Name, false)
+	loop := c.enterLoop()
+	next := len(c.function.instructions)
+	end := c.emitJump(OpIterNext, iterable, counter)
+	c.emit(OpSetLocal, key.Index)
+	c.emit(OpPop)
+	c.emit(OpSetLocal, value.Index)
+	c.emit(OpPop)
+	if err := c.compileLoopBody(n.Body); err != nil {
+		return err
+	}
+	c.emit(OpJump, next)
+	c.leaveScope()
+	c.patchJump(end)
+	c.leaveLoop(loop, next)
+	return nil
+}
+
+func (c *Compiler) compileForClauseStatement(n *parser.ForClauseStatement) error {
+	// Variables declared in the init clause live for the whole loop.
+	c.enterScope()
+	if n.Init != nil {
+		if err := c.compile(n.Init); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	}
+	loop := c.enterLoop()
+	start := len(c.function.instructions)
+	end := -1
+	if n.Test != nil {
+		if err := c.compile(n.Test); err != nil {
+			return err
+		}
+		end = c.emitJump(OpJumpIfFalse, int(ConditionFor))
+	}
+	c.enterScope()
+	if err := c.compileLoopBody(n.Body); err != nil {
+		return err
+	}
+	c.leaveScope()
+	post := len(c.function.instructions)
+	if n.Post != nil {
+		if err := c.compile(n.Post); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	}
+	c.emit(OpJump, start)
+	if end >= 0 {
+		c.patchJump(end)
+	}
+	c.leaveLoop(loop, post)
+	c.leaveScope()
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(n *parser.WhileStatement) error {
+	loop := c.enterLoop()
+	start := len(c.function.instructions)
+	if err := c.compile(n.Test); err != nil {
+		return err
+	}
+	end := c.emitJump(OpJumpIfFalse, int(ConditionWhile))
+	c.enterScope()
+	if err := c.compileLoopBody(n.Body); err != nil {
+		return err
+	}
+	c.leaveScope()
+	c.emit(OpJump, start)
+	c.patchJump(end)
+	c.leaveLoop(loop, start)
+	return nil
+}
+
+// compileLoopBody compiles the body of a loop in the current scope. Every iteration starts with
+// the locals declared by the body undeclared, like the evaluator creates a scope per iteration.
+func (c *Compiler) compileLoopBody(body *parser.BlockStatement) error {
+	first := len(c.function.localNames)
+	clear := c.emit(OpClearLocals, first, 0)
+	if err := c.compileStatements(body.Statements); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+	c.patchOperand(clear, 3, len(c.function.localNames)-first)
+	return nil
+}
+
+func (c *Compiler) enterLoop() *loopState {
+	loop := &loopState{}
+	c.function.loops = append(c.function.loops, loop)
+	return loop
+}
+
+// leaveLoop patches the jumps of the break and continue statements of the loop, the value of a
+// loop statement is a CometNop.
+func (c *Compiler) leaveLoop(loop *loopState, continueTarget int) {
+	c.function.loops = c.function.loops[:len(c.function.loops)-1]
+	for _, position := range loop.breaks {
+		c.patchJump(position)
+	}
+	for _, position := range loop.continues {
+		c.patchOperand(position, 1, continueTarget)
+	}
+	c.emit(OpNop)
+}
+
+func (c *Compiler) compileLoopJump(token lexer.Token, isBreak bool) error {
+	if len(c.function.loops) == 0 {
+		return fmt.Errorf("'%s' is not allowed outside of a loop", token.Literal)
+	}
+	loop := c.function.loops[len(c.function.loops)-1]
+	position := c.emitJump(OpJump)
+	if isBreak {
+		loop.breaks = append(loop.breaks, position)
+	} else {
+		loop.continues = append(loop.continues, position)
+	}
+	return nil
+}
+
+func (c *Compiler) compileSwitchStatement(n *parser.SwitchStatement) error {
+	if err := c.compile(n.Subject); err != nil {
+		return err
+	}
+	subject := c.addTemporary()
+	c.emit(OpSetLocal, subject)
+	c.emit(OpPop)
+	bodies := make([][]int, len(n.Cases))
+	for i, switchCase := range n.Cases {
+		for _, value := range switchCase.Values {
+			c.emit(OpGetLocal, subject)
+			if err := c.compile(value); err != nil {
+				return err
+			}
+			c.emit(OpMatchCase)
+			bodies[i] = append(bodies[i], c.emitJump(OpJumpIfTrue))
+		}
+	}
+	if err := c.compile(n.Default); err != nil {
+		return err
+	}
+	ends := []int{c.emitJump(OpJump)}
+	for i, switchCase := range n.Cases {
+		for _, position := range bodies[i] {
+			c.patchJump(position)
+		}
+		if err := c.compile(switchCase.Body); err != nil {
+			return err
+		}
+		ends = append(ends, c.emitJump(OpJump))
+	}
+	for _, position := range ends {
+		c.patchJump(position)
+	}
+	return nil
+}
+
+// compileMatchExpression compiles the arms of a match expression in order, every arm has its own
+// scope holding the names bound by its pattern.
+func (c *Compiler) compileMatchExpression(n *parser.MatchExpression) error {
+	if err := c.compile(n.Subject); err != nil {
+		return err
+	}
+	subject := c.addTemporary()
+	c.emit(OpSetLocal, subject)
+	c.emit(OpPop)
+	ends := make([]int, 0, len(n.Arms))
+	for _, arm := range n.Arms {
+		pattern := newPatternDefinition(arm.Pattern)
+		if err := c.compileMatch(subject, pattern, c.addConstant(pattern)); err != nil {
+			return err
+		}
+		next := c.emitJump(OpJumpIfFalse, int(ConditionExpression))
+		c.enterScope()
+		for i := len(pattern.Names) - 1; i >= 0; i-- {
+			symbol := c.defineLocal(pattern.Names[i], false)
+			c.emit(OpSetLocal, symbol.Index)
+			c.emit(OpPop)
+		}
+		if err := c.compile(arm.Body); err != nil {
+			return err
+		}
+		c.leaveScope()
+		c.emit(OpNopToNil)
+		ends = append(ends, c.emitJump(OpJump))
+		c.patchJump(next)
+	}
+	c.emit(OpGetLocal, subject)
+	c.emit(OpNoMatch)
+	for _, position := range ends {
+		c.patchJump(position)
+	}
+	return nil
+}
+
+func (c *Compiler) compileStructDeclaration(n *parser.StructDeclarationStatement) error {
+	definition := &StructDefinition{Name: n.Name}
+	for _, method := range n.Methods {
+		fn, err := c.compileFunction(method.Name, method.Parameters, method.Block, true, false)
+		if err != nil {
+			return err
+		}
+		definition.Methods = append(definition.Methods, fn)
+	}
+	c.emit(OpStruct, c.addConstant(definition))
+	return nil
+}
+
+// resolve returns the symbol bound to name, names that are not declared are globals.
+func (c *Compiler) resolve(name string) *Symbol {
+	for scope := c.function.scope; scope != nil; scope = scope.parent {
+		if symbol, found := scope.symbols[name]; found {
+			return symbol
+		}
+	}
+	if c.function.nested && c.function.name == name {
+		return &Symbol{Name: name, Scope: FunctionScope}
+	}
+	return c.global(name)
+}
+
+// resolveVariable resolves a name that is assigned, a function can't assign its own name.
+func (c *Compiler) resolveVariable(name string) *Symbol {
+	symbol := c.resolve(name)
+	if symbol.Scope == FunctionScope {
+		return c.global(name)
+	}
+	return symbol
+}
+
+func (c *Compiler) global(name string) *Symbol {
+	symbol, found := c.globals[name]
+	if !found {
+		symbol = &Symbol{Name: name, Scope: GlobalScope, Index: len(c.names)}
+		c.globals[name] = symbol
+		c.names = append(c.names, name)
+	}
+	return symbol
+}
+
+func (c *Compiler) load(symbol *Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(OpGetLocal, symbol.Index)
+	case FunctionScope:
+		c.emit(OpCurrentFunc)
+	}
+}
+
+// define declares name in the current scope and stores the value on top of the stack in it,
+// the value is kept on the stack.
+func (c *Compiler) define(name string, constant bool) {
+	if c.function.scope == nil {
+		symbol := c.global(name)
+		flag := 0
+		if constant {
+			flag = 1
+		}
+		c.emit(OpDefineGlobal, symbol.Index, flag)
+		return
+	}
+	symbol := c.defineLocal(name, constant)
+	c.emit(OpDefineLocal, symbol.Index)
+}
+
+// defineLocal declares a local in the current scope, a redeclaration in the same scope reuses the
+// slot of the previous declaration.
+func (c *Compiler) defineLocal(name string, constant bool) *Symbol {
+	symbol, found := c.function.scope.symbols[name]
+	if !found {
+		symbol = &Symbol{Name: name, Scope: LocalScope, Index: len(c.function.localNames)}
+		c.function.localNames = append(c.function.localNames, name)
+		c.function.scope.symbols[name] = symbol
+	}
+	symbol.Constant = constant
+	return symbol
+}
+
+// addTemporary allocates a hidden local.
+func (c *Compiler) addTemporary() int {
+	c.function.localNames = append(c.function.localNames, "")
+	return len(c.function.localNames) - 1
+}
+
+func (c *Compiler) enterScope() {
+	c.function.scope = &blockScope{
+		symbols: make(map[string]*Symbol),
+		parent:  c.function.scope,
+	}
+}
+
+func (c *Compiler) leaveScope() {
+	c.function.scope = c.function.scope.parent
+}
+
+func (c *Compiler) addConstant(obj std.CometObject) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// addString adds a string constant, names are added only once to the constant pool.
+func (c *Compiler) addString(value string) int {
+	if index, found := c.strings[value]; found {
+		return index
+	}
+	index := c.addConstant(&std.CometStr{Value: value, Size: len(value)})
+	c.strings[value] = index
+	return index
+}
+
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	position := len(c.function.instructions)
+	c.function.instructions = append(c.function.instructions, Make(op, operands...)...)
+	return position
+}
+
+func (c *Compiler) emitError(message string, params ...interface{}) {
+	c.emit(OpError, c.addString(fmt.Sprintf(message, params...)))
+}
+
+// emitJump emits a jump instruction with a target to be patched by patchJump, the target is
+// the first operand, the given operands follow it.
+func (c *Compiler) emitJump(op Opcode, operands ...int) int {
+	return c.emit(op, append([]int{0}, operands...)...)
+}
+
+// patchJump sets the target of the jump at the given position to the next emitted instruction.
+func (c *Compiler) patchJump(position int) {
+	c.patchOperand(position, 1, len(c.function.instructions))
+}
+
+// patchOperand overwrites the 2 bytes operand at the given offset of the instruction at position.
+func (c *Compiler) patchOperand(position, offset, value int) {
+	copy(c.function.instructions[position+offset:], Make(OpJump, value)[1:])
+}
@@ -0,0 +1,96 @@
+package compiler
+
+import (
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func compileOrDie(t *testing.T, src string) *Bytecode {
+	p := parser.New(src)
+	root := p.Parse()
+	assert.False(t, p.Errors.HasAny(), p.Errors.String())
+	bytecode, err := New().Compile(root)
+	assert.NoError(t, err)
+	return bytecode
+}
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		Op       Opcode
+		Operands []int
+		Expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpPop, []int{}, []byte{byte(OpPop)}},
+		{OpDefineGlobal, []int{258, 1}, []byte{byte(OpDefineGlobal), 1, 2, 1}},
+	}
+	for _, test := range tests {
+		instruction := Make(test.Op, test.Operands...)
+		assert.Equal(t, test.Expected, instruction)
+		def, err := Lookup(test.Op)
+		assert.NoError(t, err)
+		operands, read := ReadOperands(def, instruction[1:])
+		assert.Equal(t, len(instruction)-1, read)
+		assert.Equal(t, test.Operands, operands)
+	}
+}
+
+func TestInstructions_String(t *testing.T) {
+	var ins Instructions
+	ins = append(ins, Make(OpConstant, 1)...)
+	ins = append(ins, Make(OpJumpIfFalse, 12, int(ConditionIf))...)
+	ins = append(ins, Make(OpReturn)...)
+	assert.Equal(t, "0000 OpConstant 1\n0003 OpJumpIfFalse 12 0\n0007 OpReturn\n", ins.String())
+}
+
+func TestCompiler_Compile(t *testing.T) {
+	bytecode := compileOrDie(t, "var a = 1 + 2\n a")
+	expected := []Instructions{
+		Make(OpConstant, 0),
+		Make(OpConstant, 1),
+		Make(OpBinary, 0),
+		Make(OpDefineGlobal, 0, 0),
+		Make(OpPop),
+		Make(OpGetGlobal, 0),
+		Make(OpReturn),
+	}
+	var concatenated Instructions
+	for _, ins := range expected {
+		concatenated = append(concatenated, ins...)
+	}
+	assert.Equal(t, concatenated.String(), bytecode.Main.Instructions.String())
+	assert.Equal(t, []string{"a"}, bytecode.Globals)
+}
+
+func TestCompiler_Compile_Globals(t *testing.T) {
+	// Globals keep their index across compilations, like the scope of a REPL session.
+	c := New()
+	for _, src := range []string{"var a = 1", "var b = a", "a + b"} {
+		p := parser.New(src)
+		_, err := c.Compile(p.Parse())
+		assert.NoError(t, err)
+	}
+	bytecode, err := c.Compile(parser.New("var c = 3").Parse())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, bytecode.Globals)
+}
+
+func TestCompiler_Compile_TailCalls(t *testing.T) {
+	tests := []struct {
+		Src  string
+		Tail bool
+	}{
+		{"func f(n) { return f(n) }", true},
+		{"func f(n) { return 1 + f(n) }", false},
+		// Functions declared in the call are not called in place of the current frame.
+		{"func f(n) {\n func g() { return n }\n return g()\n }", false},
+		{"func f(n) { return println(n) }", false},
+	}
+	for _, test := range tests {
+		bytecode := compileOrDie(t, test.Src)
+		fn := bytecode.Constants[len(bytecode.Constants)-1].(*CompiledFunction)
+		assert.Equal(t, test.Tail, strings.Contains(fn.Instructions.String(), "OpTailCall"), test.Src)
+	}
+}
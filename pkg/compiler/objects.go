@@ -0,0 +1,113 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+)
+
+// Types of the compiler specific objects stored in the constant pool.
+const (
+	StructDefinitionType = "STRUCT_DEFINITION"
+	PatternType          = "PATTERN"
+)
+
+// CompiledFunction is a function lowered to bytecode.
+// Its arguments are the first locals of the function, methods receive the instance as the
+// local 0 followed by the arguments.
+type CompiledFunction struct {
+	Name         string
+	Instructions Instructions
+	Params       []*parser.IdentifierExpression
+	Method       bool
+	// The number of local slots, including the parameters.
+	NumLocals int
+	// The name of every local slot, used to report errors (hidden locals have an empty name).
+	LocalNames []string
+	// The tokens of the call expressions, by offset of their call instruction.
+	Sites map[int]lexer.Token
+}
+
+func (c *CompiledFunction) Type() std.CometType {
+	return std.FuncType
+}
+
+func (c *CompiledFunction) ToString() string {
+	return "CometFunc"
+}
+
+// NumArgs returns the number of locals initialized by the caller.
+func (c *CompiledFunction) NumArgs() int {
+	if c.Method {
+		return len(c.Params) + 1
+	}
+	return len(c.Params)
+}
+
+// StructDefinition holds the compiled methods of a struct declaration.
+type StructDefinition struct {
+	Name    string
+	Methods []*CompiledFunction
+}
+
+func (s *StructDefinition) Type() std.CometType {
+	return StructDefinitionType
+}
+
+func (s *StructDefinition) ToString() string {
+	return fmt.Sprintf("StructDefinition(%s)", s.Name)
+}
+
+// PatternDefinition describes a pattern matched by OpMatch.
+// The values of the literal patterns are computed before matching, Literals holds the literal
+// patterns in the order their values are pushed. Names are the names bound by the pattern, in the
+// order their values are pushed when the pattern matches.
+type PatternDefinition struct {
+	Pattern  parser.Pattern
+	Literals []*parser.LiteralPattern
+	Names    []string
+}
+
+func (p *PatternDefinition) Type() std.CometType {
+	return PatternType
+}
+
+func (p *PatternDefinition) ToString() string {
+	return fmt.Sprintf("Pattern(%s)", p.Pattern.Literal())
+}
+
+func newPatternDefinition(pattern parser.Pattern) *PatternDefinition {
+	definition := &PatternDefinition{Pattern: pattern}
+	seen := make(map[string]bool)
+	for _, name := range parser.PatternNames(pattern) {
+		if !seen[name] {
+			seen[name] = true
+			definition.Names = append(definition.Names, name)
+		}
+	}
+	definition.collectLiterals(pattern)
+	return definition
+}
+
+func (p *PatternDefinition) collectLiterals(pattern parser.Pattern) {
+	switch n := pattern.(type) {
+	case *parser.LiteralPattern:
+		p.Literals = append(p.Literals, n)
+	case *parser.ArrayPattern:
+		for _, element := range n.Elements {
+			p.collectLiterals(element)
+		}
+		if n.Rest != nil {
+			p.collectLiterals(n.Rest)
+		}
+	case *parser.ObjectPattern:
+		for _, field := range n.Fields {
+			p.collectLiterals(field.Pattern)
+		}
+	case *parser.StructPattern:
+		for _, element := range n.Elements {
+			p.collectLiterals(element)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	parser2 "github.com/chermehdi/comet/pkg/parser"
+	"strings"
 )
 
 const IndentWidth = 2
@@ -15,12 +16,29 @@ type PrintingVisitor struct {
 
 func (p *PrintingVisitor) VisitNewCall(call parser2.NewCallExpr) {
 	p.printIndent()
-	p.buffer.WriteString(fmt.Sprintf("NewCallExpression(%s)\n", call.Type))
+	if call.Module != "" {
+		p.buffer.WriteString(fmt.Sprintf("NewCallExpression(%s.%s)\n", call.Module, call.Type))
+	} else {
+		p.buffer.WriteString(fmt.Sprintf("NewCallExpression(%s)\n", call.Type))
+	}
 	for _, ex := range call.Args {
 		p.VisitExpression(ex)
 	}
 }
 
+func (p *PrintingVisitor) VisitImportStatement(statement parser2.ImportStatement) {
+	p.printIndent()
+	if statement.Alias != "" {
+		p.buffer.WriteString(fmt.Sprintf("ImportStatement(Path=%s, Alias=%s)\n", statement.Path, statement.Alias))
+		return
+	}
+	names := make([]string, len(statement.Names))
+	for i, name := range statement.Names {
+		names[i] = name.Name
+	}
+	p.buffer.WriteString(fmt.Sprintf("ImportStatement(Path=%s, Names=%s)\n", statement.Path, strings.Join(names, ", ")))
+}
+
 func (p *PrintingVisitor) VisitStructDeclaration(statement parser2.StructDeclarationStatement) {
 	p.printIndent()
 	p.buffer.WriteString(fmt.Sprintf("StructDeclaration(Type=%s)\n", statement.Name))
@@ -31,27 +49,127 @@ func (p *PrintingVisitor) VisitStructDeclaration(statement parser2.StructDeclara
 
 func (p *PrintingVisitor) VisitArrayAccess(access parser2.IndexAccess) {
 	p.printIndent()
-	p.buffer.WriteString("IndexAccess")
+	p.buffer.WriteString("IndexAccess\n")
+	p.indent += IndentWidth
+	access.Identifier.Accept(p)
+	access.Index.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitSliceExpression(expression parser2.SliceExpression) {
 	p.printIndent()
-	p.VisitExpression(access.Identifier)
-	p.VisitExpression(access.Index)
+	p.buffer.WriteString("SliceExpression\n")
+	p.indent += IndentWidth
+	expression.Target.Accept(p)
+	bounds := []struct {
+		name  string
+		bound parser2.Expression
+	}{{"Start", expression.Start}, {"Stop", expression.Stop}, {"Step", expression.Step}}
+	for _, b := range bounds {
+		if b.bound != nil {
+			p.printIndent()
+			p.buffer.WriteString(fmt.Sprintf("(%s)\n", b.name))
+			b.bound.Accept(p)
+		}
+	}
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitIndexAssignExpression(expression parser2.IndexAssignExpression) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("IndexAssignExpression(%s=)\n", expression.Op.Literal))
+	p.indent += IndentWidth
+	expression.Target.Accept(p)
+	expression.Value.Accept(p)
+	p.indent -= IndentWidth
 }
 
 func (p *PrintingVisitor) VisitArrayLiteral(array parser2.ArrayLiteral) {
 	p.printIndent()
-	p.buffer.WriteString(array.Literal())
+	p.buffer.WriteString(array.Literal() + "\n")
+	p.indent += IndentWidth
 	for _, el := range array.Elements {
-		p.VisitExpression(el)
+		el.Accept(p)
 	}
+	p.indent -= IndentWidth
 }
 
 func (p *PrintingVisitor) VisitAssignExpression(expression parser2.AssignExpression) {
 	p.printIndent()
-	p.buffer.WriteString(fmt.Sprintf("AssignmentExpression(%s)\n", expression.VarName))
+	p.buffer.WriteString(fmt.Sprintf("AssignmentExpression(%s %s=)\n", expression.VarName, expression.Op.Literal))
+	p.indent += IndentWidth
+	expression.Value.Accept(p)
+	p.indent -= IndentWidth
 }
 
-func (p *PrintingVisitor) VisitForStatement(parser2.ForStatement) {
-	panic("implement me")
+func (p *PrintingVisitor) VisitForStatement(statement parser2.ForStatement) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("ForStatement(Key=%s, Value=%s)\n", statement.Key.Name, statement.Value.Name))
+	p.indent += IndentWidth
+	statement.Range.Accept(p)
+	statement.Body.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitForClauseStatement(statement parser2.ForClauseStatement) {
+	p.printIndent()
+	p.buffer.WriteString("ForClauseStatement\n")
+	p.indent += IndentWidth
+	if statement.Init != nil {
+		p.printIndent()
+		p.buffer.WriteString("(Init)\n")
+		statement.Init.Accept(p)
+	}
+	if statement.Test != nil {
+		p.printIndent()
+		p.buffer.WriteString("(Test)\n")
+		statement.Test.Accept(p)
+	}
+	if statement.Post != nil {
+		p.printIndent()
+		p.buffer.WriteString("(Post)\n")
+		statement.Post.Accept(p)
+	}
+	statement.Body.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitWhileStatement(statement parser2.WhileStatement) {
+	p.printIndent()
+	p.buffer.WriteString("WhileStatement\n")
+	p.indent += IndentWidth
+	statement.Test.Accept(p)
+	statement.Body.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitSwitchStatement(statement parser2.SwitchStatement) {
+	p.printIndent()
+	p.buffer.WriteString("SwitchStatement\n")
+	p.indent += IndentWidth
+	statement.Subject.Accept(p)
+	for _, switchCase := range statement.Cases {
+		p.printIndent()
+		p.buffer.WriteString("(Case)\n")
+		for _, value := range switchCase.Values {
+			value.Accept(p)
+		}
+		switchCase.Body.Accept(p)
+	}
+	p.printIndent()
+	p.buffer.WriteString("(Default)\n")
+	statement.Default.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitBreakStatement(parser2.BreakStatement) {
+	p.printIndent()
+	p.buffer.WriteString("BreakStatement\n")
+}
+
+func (p *PrintingVisitor) VisitContinueStatement(parser2.ContinueStatement) {
+	p.printIndent()
+	p.buffer.WriteString("ContinueStatement\n")
 }
 
 func (p *PrintingVisitor) VisitStringLiteral(literal parser2.StringLiteral) {
@@ -123,11 +241,31 @@ func (p *PrintingVisitor) VisitPrefixExpression(expression parser2.PrefixExpress
 	p.indent -= IndentWidth
 }
 
+func (p *PrintingVisitor) VisitConditionalExpression(expression parser2.ConditionalExpression) {
+	p.printIndent()
+	p.buffer.WriteString("ConditionalExpression\n")
+	p.indent += IndentWidth
+	expression.Test.Accept(p)
+	expression.Then.Accept(p)
+	expression.Else.Accept(p)
+	p.indent -= IndentWidth
+}
+
 func (p *PrintingVisitor) VisitNumberLiteral(expression parser2.NumberLiteral) {
 	p.printIndent()
 	p.buffer.WriteString(fmt.Sprintf("Visiting a Number (%d)\n", expression.ActualValue))
 }
 
+func (p *PrintingVisitor) VisitBigIntLiteral(expression parser2.BigIntLiteral) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("Visiting a BigInt (%s)\n", expression.ActualValue.String()))
+}
+
+func (p *PrintingVisitor) VisitFloatLiteral(expression parser2.FloatLiteral) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("Visiting a Float (%s)\n", expression.Literal()))
+}
+
 func (p *PrintingVisitor) VisitParenthesisedExpression(expression parser2.ParenthesisedExpression) {
 	p.printIndent()
 	p.buffer.WriteString("ParenthesisedExpression\n")
@@ -142,7 +280,11 @@ func (p *PrintingVisitor) String() string {
 
 func (p *PrintingVisitor) VisitDeclarationStatement(statement parser2.DeclarationStatement) {
 	p.printIndent()
-	p.buffer.WriteString(fmt.Sprintf("DeclarationStatement(%s)\n", statement.Identifier.Literal))
+	if statement.Constant {
+		p.buffer.WriteString(fmt.Sprintf("DeclarationStatement(const %s)\n", statement.Identifier.Literal))
+	} else {
+		p.buffer.WriteString(fmt.Sprintf("DeclarationStatement(%s)\n", statement.Identifier.Literal))
+	}
 	p.indent += IndentWidth
 	statement.Expression.Accept(p)
 	p.indent -= IndentWidth
@@ -166,6 +308,11 @@ func (p *PrintingVisitor) VisitBooleanLiteral(literal parser2.BooleanLiteral) {
 	p.buffer.WriteString(fmt.Sprintf("BooleanLiteral (%v)\n", literal.ActualValue))
 }
 
+func (p *PrintingVisitor) VisitNilLiteral(parser2.NilLiteral) {
+	p.printIndent()
+	p.buffer.WriteString("NilLiteral\n")
+}
+
 func (p *PrintingVisitor) VisitFunctionStatement(statement parser2.FunctionStatement) {
 	p.printIndent()
 	p.buffer.WriteString(fmt.Sprintf("FuncStatement(Name='%s')\n", statement.Name))
@@ -190,3 +337,59 @@ func (p *PrintingVisitor) VisitCallExpression(expression parser2.CallExpression)
 	}
 	p.indent -= IndentWidth
 }
+
+func (p *PrintingVisitor) VisitDestructuringStatement(statement parser2.DestructuringStatement) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("DestructuringStatement(%s)\n", statement.Literal()))
+	p.indent += IndentWidth
+	statement.Pattern.Accept(p)
+	statement.Expression.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitMatchExpression(expression parser2.MatchExpression) {
+	p.printIndent()
+	p.buffer.WriteString("MatchExpression\n")
+	p.indent += IndentWidth
+	expression.Subject.Accept(p)
+	for _, arm := range expression.Arms {
+		p.printIndent()
+		p.buffer.WriteString("(Arm)\n")
+		arm.Pattern.Accept(p)
+		arm.Body.Accept(p)
+	}
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitWildcardPattern(parser2.WildcardPattern) {
+	p.printIndent()
+	p.buffer.WriteString("WildcardPattern\n")
+}
+
+func (p *PrintingVisitor) VisitBindingPattern(pattern parser2.BindingPattern) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("BindingPattern(%s)\n", pattern.Name))
+}
+
+func (p *PrintingVisitor) VisitLiteralPattern(pattern parser2.LiteralPattern) {
+	p.printIndent()
+	p.buffer.WriteString("LiteralPattern\n")
+	p.indent += IndentWidth
+	pattern.Value.Accept(p)
+	p.indent -= IndentWidth
+}
+
+func (p *PrintingVisitor) VisitArrayPattern(pattern parser2.ArrayPattern) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("ArrayPattern(%s)\n", pattern.Literal()))
+}
+
+func (p *PrintingVisitor) VisitObjectPattern(pattern parser2.ObjectPattern) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("ObjectPattern(%s)\n", pattern.Literal()))
+}
+
+func (p *PrintingVisitor) VisitStructPattern(pattern parser2.StructPattern) {
+	p.printIndent()
+	p.buffer.WriteString(fmt.Sprintf("StructPattern(%s)\n", pattern.Literal()))
+}
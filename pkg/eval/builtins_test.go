@@ -0,0 +1,95 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBuiltins are registered by the tests of the builtin context, the programs using them are
+// kept out of evaluator_test.go, whose programs are compared with the vm.
+var testBuiltins = []*std2.Builtin{
+	{
+		Name:     "apply",
+		MinArgs:  1,
+		MaxArgs:  -1,
+		ArgTypes: []std2.CometType{std2.FuncType, std2.AnyType},
+		Func: func(ctx *std2.Context, args ...std2.CometObject) std2.CometObject {
+			return ctx.CallFunction(args[0], args[1:]...)
+		},
+	},
+	{
+		Name:     "lookup",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []std2.CometType{std2.StrType},
+		Func: func(ctx *std2.Context, args ...std2.CometObject) std2.CometObject {
+			name := args[0].(*std2.CometStr).Value
+			value, found := ctx.Lookup(name)
+			if !found {
+				return ctx.Errorf("'%s' is not bound", name)
+			}
+			return value
+		},
+	},
+	{
+		Name:     "allocate",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []std2.CometType{std2.IntType},
+		Func: func(ctx *std2.Context, args ...std2.CometObject) std2.CometObject {
+			if err := ctx.CheckSize(args[0].(*std2.CometInt).Value); err != nil {
+				return err
+			}
+			return std2.NopInstance
+		},
+	},
+}
+
+func TestEvaluator_Eval_BuiltinContext(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"func double(x) { return x * 2 }\n apply(double, 21)", "CometInt(42)"},
+		{"func f(n) {\n if n == 0 { return 0 }\n return apply(f, n - 1) + 1\n }\n f(10)", "CometInt(10)"},
+		{"func f() {\n var local = 3\n return apply(g)\n }\n func g() { return lookup(\"local\") }\n f()", "CometInt(3)"},
+		{"var x = 1\n lookup(\"x\")", "CometInt(1)"},
+		{"func fail() { return 1 / 0 }\n apply(fail)", "Comet error: \n\n\tDivision by zero"},
+		{"func add(a, b) { return a + b }\n apply(add, 1)", "Comet error: \n\n\tFunction 'add' expects 2 arguments, 1 were given"},
+		{"apply(1)", "Comet error: \n\n\tArgument 1 of builtin 'apply' expected to be FUNCTION, got INTEGER instead (line 1, column 1)"},
+		{"var a = 1\n  lookup(\"b\")", "Comet error: \n\n\t'b' is not bound (line 2, column 3)"},
+		{"lookup()", "Comet error: \n\n\tBuiltin 'lookup' expects 1 argument, got 0 (line 1, column 1)"},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		for _, builtin := range testBuiltins {
+			evaluator.registerBuiltin(builtin)
+		}
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(test.Src)).ToString(), test.Src)
+		assert.Empty(t, evaluator.frames)
+	}
+}
+
+func TestEvaluator_EvalContext_BuiltinSizes(t *testing.T) {
+	evaluator := NewEvaluator()
+	for _, builtin := range testBuiltins {
+		evaluator.registerBuiltin(builtin)
+	}
+	evaluator.MaxCollectionSize = 100
+	_, err := evaluator.EvalContext(context.Background(), parseOrDie("allocate(100)"))
+	assert.NoError(t, err)
+	result, err := evaluator.EvalContext(context.Background(), parseOrDie("allocate(101)\n 1"))
+	assert.Equal(t, &CollectionSizeError{Limit: 100, Size: 101}, err)
+	assertError(t, result, "collection of size 101 exceeds the limit of 100")
+	// The limits only apply to EvalContext.
+	assert.Equal(t, "CometNil", evaluator.Eval(parseOrDie("allocate(101)\n nil")).ToString())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = evaluator.EvalContext(ctx, parseOrDie("allocate(1)"))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,145 @@
+package eval
+
+import (
+	"fmt"
+	lexer2 "github.com/chermehdi/comet/pkg/lexer"
+	parser2 "github.com/chermehdi/comet/pkg/parser"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"strings"
+)
+
+// DefaultMaxCallDepth is the maximum call depth of the evaluators created by NewEvaluator.
+const DefaultMaxCallDepth = 5000
+
+// The number of calls listed in the trace of a recursion error.
+const traceLength = 10
+
+// callFrame is a function or method call being evaluated.
+type callFrame struct {
+	name string
+	// The token of the call expression, its position is zero if the call has no source (e.g. constructors).
+	site lexer2.Token
+	// The scope holding the parameters of the call.
+	scope *Scope
+}
+
+func (f *callFrame) String() string {
+	return DescribeCall(f.name, f.site)
+}
+
+// DescribeCall describes a call in the trace of a recursion error, site is the token of the call
+// expression.
+func DescribeCall(name string, site lexer2.Token) string {
+	if site.LineNumber == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (line %d, column %d)", name, site.LineNumber, site.ColumnNumber)
+}
+
+// tailCall replaces the frame executing `return f(...)` by the call of f, the body of f is
+// evaluated by the loop of the enclosing call instead of growing the stack.
+// It is only produced wrapped in a CometReturnWrapper, which is unwrapped by call.
+type tailCall struct {
+	function *std2.CometFunc
+	site     lexer2.Token
+	scope    *Scope
+}
+
+func (t *tailCall) Type() std2.CometType {
+	return "TAIL_CALL"
+}
+
+func (t *tailCall) ToString() string {
+	return fmt.Sprintf("TailCall(%s)", t.function.Name)
+}
+
+// call evaluates the body of a function in the given scope, which holds the arguments of the call.
+// Tail calls made by the body are evaluated in the same frame.
+func (ev *Evaluator) call(name string, site lexer2.Token, function *std2.CometFunc, scope *Scope) std2.CometObject {
+	frame := &callFrame{name: name, site: site, scope: scope}
+	if ev.MaxCallDepth > 0 && len(ev.frames) >= ev.MaxCallDepth {
+		err := ev.recursionError(frame)
+		if ev.ctx != nil {
+			return ev.stop(&CallDepthError{Limit: ev.MaxCallDepth, Message: err.(*std2.CometError).Message})
+		}
+		return err
+	}
+	depth := len(ev.frames)
+	ev.frames = append(ev.frames, frame)
+	defer func() {
+		ev.frames = ev.frames[:depth]
+	}()
+	oldScope, oldModule := ev.Scope, ev.module
+	for {
+		// Tail calls are checked as well.
+		if err := ev.checkContext(); err != nil {
+			return err
+		}
+		// The body is evaluated in the module declaring the function.
+		ev.Scope, ev.module = frame.scope, ev.moduleOf(function)
+		result := ev.Eval(function.Body)
+		ev.Scope, ev.module = oldScope, oldModule
+		if wrapper, ok := result.(*std2.CometReturnWrapper); ok {
+			if tail, ok := wrapper.Value.(*tailCall); ok {
+				frame.name, frame.site, frame.scope = tail.function.Name, tail.site, tail.scope
+				function = tail.function
+				continue
+			}
+		}
+		return functionResult(result)
+	}
+}
+
+// tailCall prepares the call of `return f(...)` if it can replace the current frame, it returns nil
+// if the call should be evaluated normally, or the error of the arguments.
+// The called function should be a function declared outside of the current call, its scope has
+// the same parent as the scope of the replaced frame, so the locals of the replaced frame are not
+// visible to the called function.
+func (ev *Evaluator) tailCall(n *parser2.CallExpression) std2.CometObject {
+	if len(ev.frames) == 0 {
+		return nil
+	}
+	frame := ev.frames[len(ev.frames)-1]
+	for sc := ev.Scope; sc != frame.scope.Parent; sc = sc.Parent {
+		if _, found := sc.Variables[n.Name]; found {
+			return nil
+		}
+	}
+	function, found := ev.Scope.Lookup(n.Name)
+	if !found {
+		return nil
+	}
+	funObj, ok := function.(*std2.CometFunc)
+	if !ok {
+		return nil
+	}
+	scope := NewScope(ev.callParent(funObj, frame.scope.Parent))
+	if err := ev.bindArguments(funObj, n.Arguments, scope); err != nil {
+		return err
+	}
+	return &tailCall{function: funObj, site: n.Token, scope: scope}
+}
+
+func (ev *Evaluator) recursionError(frame *callFrame) std2.CometObject {
+	calls := make([]string, 0, len(ev.frames)+1)
+	for _, f := range ev.frames {
+		calls = append(calls, f.String())
+	}
+	return RecursionError(append(calls, frame.String()))
+}
+
+// RecursionError reports that a call exceeded the maximum call depth, calls describes the calls
+// being evaluated including the rejected one, outermost first.
+// The vm package uses it as well to produce the same results.
+func RecursionError(calls []string) std2.CometObject {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "maximum recursion depth exceeded (%d nested calls)\nTraceback (most recent call last):", len(calls)-1)
+	if len(calls) > traceLength {
+		fmt.Fprintf(&sb, "\n\t  ... %d more calls", len(calls)-traceLength)
+		calls = calls[len(calls)-traceLength:]
+	}
+	for _, call := range calls {
+		fmt.Fprintf(&sb, "\n\t  %s", call)
+	}
+	return std2.CreateError("%s", sb.String())
+}
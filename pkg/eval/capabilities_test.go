@@ -0,0 +1,127 @@
+package eval
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluator_Eval_CapabilitiesDenied(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{`readFile("a.txt")`, "Permission denied: builtin 'readFile' needs access to the file system (line 1, column 1)"},
+		{`writeFile("a.txt", "a")`, "Permission denied: builtin 'writeFile' needs access to the file system (line 1, column 1)"},
+		{`listDir(".")`, "Permission denied: builtin 'listDir' needs access to the file system (line 1, column 1)"},
+		{`exists("a.txt")`, "Permission denied: builtin 'exists' needs access to the file system (line 1, column 1)"},
+		{`env("HOME")`, "Permission denied: builtin 'env' needs access to the environment (line 1, column 1)"},
+		{`exit(1)`, "Permission denied: builtin 'exit' needs permission to exit (line 1, column 1)"},
+		{`exec("echo", "a")`, "Permission denied: builtin 'exec' needs permission to execute commands (line 1, column 1)"},
+	}
+	for _, test := range tests {
+		assertError(t, NewEvaluator().Eval(parseOrDie(test.Src)), test.Expected)
+	}
+	assert.Equal(t, "[]", NewEvaluator().Eval(parseOrDie("args()")).ToString())
+}
+
+func TestEvaluator_Eval_ShadowedOSBuiltins(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"func exists(n) { return true }\n exists(\"x\")", "CometBool(true)"},
+		{"func env(name) { return name }\n env(\"HOME\")", `CometStr("HOME")`},
+		{"func exit(code) { return code + 1 }\n exit(1)", "CometInt(2)"},
+		{"func readFile(path) { return nil }\n readFile(\"a.txt\")", "CometNil"},
+		{"func listDir(path, deep) { return [path, deep] }\n listDir(\".\", true)", `[CometStr("."), CometBool(true)]`},
+		{"func args() { return 0 }\n args()", "CometInt(0)"},
+		{"func run(exec) { return exec(\"ls\") }\n func fake(name) { return name }\n run(fake)", `CometStr("ls")`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, NewEvaluator().Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+}
+
+func TestEvaluator_Eval_FileSystem(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.txt":     "hello",
+		"sub/b.txt": "b",
+	})
+	defer os.RemoveAll(dir)
+	outside := writeModules(t, map[string]string{"secret.txt": "secret"})
+	defer os.RemoveAll(outside)
+	assert.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{`readFile("a.txt")`, `CometStr("hello")`},
+		{`readFile("sub/../a.txt")`, `CometStr("hello")`},
+		{`readFile("` + filepath.Join(dir, "a.txt") + `")`, `CometStr("hello")`},
+		{`readFile("missing.txt")`, "Comet error: \n\n\tCannot read file 'missing.txt': no such file or directory (line 1, column 1)"},
+		{`listDir(".")`, `[CometStr("a.txt"), CometStr("link"), CometStr("sub")]`},
+		{`listDir("sub")`, `[CometStr("b.txt")]`},
+		{`exists("sub/b.txt")`, "CometBool(true)"},
+		{`exists("sub/c.txt")`, "CometBool(false)"},
+		{`writeFile("c.txt", "c")`, "Comet error: \n\n\tPermission denied: builtin 'writeFile' needs write access to the file system (line 1, column 1)"},
+		{`readFile("../a.txt")`, "Comet error: \n\n\tPermission denied: '../a.txt' is outside of the accessible directory (line 1, column 1)"},
+		{`readFile("` + filepath.Join(outside, "secret.txt") + `")`, "Comet error: \n\n\tPermission denied: '" + filepath.Join(outside, "secret.txt") + "' is outside of the accessible directory (line 1, column 1)"},
+		{`readFile("link/secret.txt")`, "Comet error: \n\n\tPermission denied: 'link/secret.txt' is outside of the accessible directory (line 1, column 1)"},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		evaluator.Capabilities = std2.Capabilities{Root: dir}
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+
+	evaluator := NewEvaluator()
+	evaluator.Capabilities = std2.Capabilities{Root: dir, Write: true}
+	result := evaluator.Eval(parseOrDie("writeFile(\"sub/c.txt\", \"written\")\n readFile(\"sub/c.txt\")"))
+	assert.Equal(t, `CometStr("written")`, result.ToString())
+	content, err := ioutil.ReadFile(filepath.Join(dir, "sub", "c.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "written", string(content))
+
+	result = evaluator.Eval(parseOrDie(`writeFile("link/secret.txt", "overwritten")`))
+	assertError(t, result, "Permission denied: 'link/secret.txt' is outside of the accessible directory (line 1, column 1)")
+	result = evaluator.Eval(parseOrDie(`writeFile("missing/c.txt", "c")`))
+	assertError(t, result, "Cannot write file 'missing/c.txt': no such file or directory (line 1, column 1)")
+}
+
+func TestEvaluator_Eval_ProcessCapabilities(t *testing.T) {
+	assert.NoError(t, os.Setenv("COMET_TEST_VARIABLE", "value"))
+	defer os.Unsetenv("COMET_TEST_VARIABLE")
+	exitCode := -1
+
+	evaluator := NewEvaluator()
+	evaluator.Capabilities = std2.Capabilities{
+		Env:  true,
+		Exit: func(code int) { exitCode = code },
+		Args: []string{"a", "b"},
+	}
+	assert.Equal(t, `CometStr("value")`, evaluator.Eval(parseOrDie(`env("COMET_TEST_VARIABLE")`)).ToString())
+	assert.Equal(t, "CometNil", evaluator.Eval(parseOrDie(`env("COMET_TEST_MISSING_VARIABLE")`)).ToString())
+	assert.Equal(t, `[CometStr("a"), CometStr("b")]`, evaluator.Eval(parseOrDie("args()")).ToString())
+	evaluator.Eval(parseOrDie("exit(3)"))
+	assert.Equal(t, 3, exitCode)
+	evaluator.Eval(parseOrDie("exit()"))
+	assert.Equal(t, 0, exitCode)
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir := writeModules(t, map[string]string{"a.txt": "a"})
+	defer os.RemoveAll(dir)
+	evaluator.Capabilities = std2.Capabilities{Exec: true, Root: dir}
+	assert.Equal(t, "CometStr(\"a b\n\")", evaluator.Eval(parseOrDie(`exec("echo", "a", "b")`)).ToString())
+	assert.Equal(t, "CometStr(\"a.txt\n\")", evaluator.Eval(parseOrDie(`exec("ls")`)).ToString())
+	result := evaluator.Eval(parseOrDie(`exec("sh", "-c", "echo failed >&2; exit 2")`))
+	assertError(t, result, "Command 'sh' failed: exit status 2: failed (line 1, column 1)")
+}
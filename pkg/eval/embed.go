@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	lexer2 "github.com/chermehdi/comet/pkg/lexer"
+	parser2 "github.com/chermehdi/comet/pkg/parser"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"reflect"
+)
+
+// Register makes a Go function callable from the programs of the evaluator under the given name.
+// The arguments and the result are converted by reflection, see std.NewBuiltin for the supported
+// signatures, and std.ToComet and std.ConvertTo for the conversions.
+// Like the other builtins, registered functions are shadowed by the functions and variables
+// declared by the programs, and can't replace an existing builtin.
+func (ev *Evaluator) Register(name string, function interface{}) error {
+	if ev.isBuiltinFunc(name) {
+		return fmt.Errorf("cannot register '%s', a builtin with the same name exists", name)
+	}
+	builtin, err := std2.NewBuiltin(name, function)
+	if err != nil {
+		return err
+	}
+	ev.registerBuiltin(builtin)
+	return nil
+}
+
+// Call invokes the Comet function bound to the given name with Go arguments, and converts its
+// result back to a Go value with std.FromComet. The function should have been declared by a
+// program evaluated before.
+// Errors raised by the function are returned as Go errors.
+func (ev *Evaluator) Call(name string, args ...interface{}) (interface{}, error) {
+	function, found := ev.Scope.Lookup(name)
+	if !found {
+		return nil, fmt.Errorf("cannot find callable symbol %s", name)
+	}
+	if function.Type() != std2.FuncType {
+		return nil, fmt.Errorf("cannot invoke none callable object of type %s", function.Type())
+	}
+	params := make([]std2.CometObject, len(args))
+	for i, arg := range args {
+		param, err := std2.ToComet(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of '%s': %s", i+1, name, err)
+		}
+		params[i] = param
+	}
+	result := ev.CallFunction(function, params...)
+	if err, ok := result.(*std2.CometError); ok {
+		return nil, errors.New(err.Message)
+	}
+	return std2.FromComet(result)
+}
+
+// RegisterType makes a Go struct type available to the programs of the evaluator, `new Name(...)`
+// creates a std.Native object wrapping a pointer to the struct.
+// constructor is either a struct value or a pointer to a struct, whose type is instantiated with
+// its zero value, or a function returning a pointer to a struct, and optionally an error, which
+// is called with the arguments of `new`.
+func (ev *Evaluator) RegisterType(name string, constructor interface{}) error {
+	if _, found := ev.nativeTypes[name]; found {
+		return fmt.Errorf("cannot register type '%s', a type with the same name exists", name)
+	}
+	if _, found := ev.Types[name]; found {
+		return fmt.Errorf("cannot register type '%s', a type with the same name exists", name)
+	}
+	t := reflect.TypeOf(constructor)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Struct {
+		// The zero value is created without arguments, extra arguments are reported.
+		ev.nativeTypes[name] = &std2.Builtin{
+			Name:    name + ".init",
+			MinArgs: 0,
+			MaxArgs: 0,
+			Func: func(ctx *std2.Context, args ...std2.CometObject) std2.CometObject {
+				native, _ := std2.NewNative(reflect.New(t).Interface())
+				return native
+			},
+		}
+		return nil
+	}
+	if t == nil || t.Kind() != reflect.Func || t.NumOut() == 0 || t.Out(0).Kind() != reflect.Ptr || t.Out(0).Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot register type '%s', expected a struct or a function returning a pointer to a struct, got %T", name, constructor)
+	}
+	builtin, err := std2.NewBuiltin(name+".init", constructor)
+	if err != nil {
+		return err
+	}
+	ev.nativeTypes[name] = builtin
+	return nil
+}
+
+func (ev *Evaluator) evalNativeNewCall(constructor *std2.Builtin, expr *parser2.NewCallExpr) std2.CometObject {
+	args := make([]std2.CometObject, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = ev.Eval(arg)
+		if isError(args[i]) {
+			return args[i]
+		}
+	}
+	result := constructor.Invoke(ev.builtinContext(lexer2.Token{}), args...)
+	if result.Type() == std2.NilType {
+		return std2.CreateError("The constructor of native type '%s' returned nil", expr.Type)
+	}
+	return result
+}
+
+// evalNativeAccess evaluates the right side of a '.' operator against a native object.
+func (ev *Evaluator) evalNativeAccess(native std2.NativeObject, right parser2.Expression) std2.CometObject {
+	switch n := right.(type) {
+	case *parser2.AssignExpression:
+		current := native.GetField(n.VarName)
+		if isError(current) {
+			return current
+		}
+		value := ev.evalAssignedValue(n.Op, current, n.Value)
+		if isError(value) {
+			return value
+		}
+		if err := native.SetField(n.VarName, value); err != nil {
+			return err
+		}
+		return value
+	case *parser2.IdentifierExpression:
+		return native.GetField(n.Name)
+	case *parser2.CallExpression:
+		args := make([]std2.CometObject, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = ev.Eval(arg)
+			if isError(args[i]) {
+				return args[i]
+			}
+		}
+		return native.CallMethod(ev.builtinContext(n.Token), n.Name, args...)
+	default:
+		return std2.CreateError("Used '.' operator with none function element")
+	}
+}
@@ -0,0 +1,250 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `comet:"label"`
+	hidden bool
+	Skip   string `comet:"-"`
+}
+
+func TestEvaluator_Register(t *testing.T) {
+	evaluator := NewEvaluator()
+	register := func(name string, function interface{}) {
+		assert.NoError(t, evaluator.Register(name, function), name)
+	}
+	register("add", func(a, b int) int { return a + b })
+	register("half", func(f float64) float64 { return f / 2 })
+	register("shout", func(s string) string { return strings.ToUpper(s) + "!" })
+	register("sum", func(values ...int64) int64 {
+		total := int64(0)
+		for _, v := range values {
+			total += v
+		}
+		return total
+	})
+	register("words", func(s string) []string { return strings.Fields(s) })
+	register("join", func(sep string, values []string) string { return strings.Join(values, sep) })
+	register("origin", func() point { return point{Label: "origin", hidden: true, Skip: "x"} })
+	register("norm", func(p point) int { return p.X*p.X + p.Y*p.Y })
+	register("counts", func() map[string]int { return map[string]int{"a": 1} })
+	register("huge", func() uint64 { return 1 << 63 })
+	register("big", func(b *big.Int) *big.Int { return new(big.Int).Mul(b, b) })
+	register("fail", func(fail bool) (int, error) {
+		if fail {
+			return 0, errors.New("failed on purpose")
+		}
+		return 1, nil
+	})
+	register("nothing", func() {})
+	register("apply", func(ctx *std2.Context, fn std2.CometObject, arg int) std2.CometObject {
+		return ctx.CallFunction(fn, &std2.CometInt{Value: int64(arg)})
+	})
+	register("maybe", func(p *point) bool { return p == nil })
+	register("identity", func(v interface{}) interface{} { return v })
+
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"add(1, 2)", "CometInt(3)"},
+		{"half(3)", "CometFloat(1.5)"},
+		{"half(half(1))", "CometFloat(0.25)"},
+		{`shout("hey")`, `CometStr("HEY!")`},
+		{"sum()", "CometInt(0)"},
+		{"sum(1, 2, 3)", "CometInt(6)"},
+		{`words(" a b  c ")`, `[CometStr("a"), CometStr("b"), CometStr("c")]`},
+		{`join("-", words("a b c"))`, `CometStr("a-b-c")`},
+		{"origin().label", `CometStr("origin")`},
+		{"origin().X", "CometInt(0)"},
+		{"origin().hidden", "CometNil"},
+		{"origin().Skip", "CometNil"},
+		{"origin()", "CometInstance(Type=point)"},
+		{"var p = origin()\n p.X = 3\n p.Y = 4\n norm(p)", "CometInt(25)"},
+		{"counts().a", "CometInt(1)"},
+		{"huge()", "CometBigInt(9223372036854775808)"},
+		{"big(3000000000)", "CometBigInt(9000000000000000000)"},
+		{"fail(false)", "CometInt(1)"},
+		{"fail(true)", "Comet error: \n\n\tfailed on purpose (line 1, column 1)"},
+		{"nothing()", "CometNop"},
+		{"func double(x) { return x * 2 }\n apply(double, 21)", "CometInt(42)"},
+		{"maybe(nil)", "CometBool(true)"},
+		{"identity([1, [2]])", "[CometInt(1), [CometInt(2)]]"},
+		{"var a = [1]\n identity([a, a])", "[[CometInt(1)], [CometInt(1)]]"},
+		{"var a = []\n push(a, a)\n identity(a)", "Comet error: \n\n\tArgument 1 of builtin 'identity': cannot convert a cyclic array to a Go value (line 3, column 2)"},
+		{"struct Node { }\n var n = new Node()\n n.next = [n]\n identity(n)", "Comet error: \n\n\tArgument 1 of builtin 'identity': cannot convert a cyclic instance of 'Node' to a Go value (line 4, column 2)"},
+		{"add(1)", "Comet error: \n\n\tBuiltin 'add' expects 2 arguments, got 1 (line 1, column 1)"},
+		{`add(1, "2")`, "Comet error: \n\n\tArgument 2 of builtin 'add': cannot convert value of type STR to Go type int (line 1, column 1)"},
+		{`join("-", [1])`, "Comet error: \n\n\tArgument 2 of builtin 'join': cannot convert value of type INTEGER to Go type string (line 1, column 1)"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+}
+
+func TestEvaluator_Register_Errors(t *testing.T) {
+	evaluator := NewEvaluator()
+	assert.EqualError(t, evaluator.Register("println", func() {}), "cannot register 'println', a builtin with the same name exists")
+	assert.EqualError(t, evaluator.Register("one", 1), "cannot register 'one', expected a function, got int")
+	assert.EqualError(t, evaluator.Register("pair", func() (int, int) { return 1, 2 }), "cannot register 'pair', expected at most a value and an error as results, got func() (int, int)")
+}
+
+func TestEvaluator_Call(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.Eval(parseOrDie(`
+func fib(n) {
+  if n < 2 { return n }
+  return fib(n - 1) + fib(n - 2)
+}
+func describe(p) { return p.label + ":" + toString(p.X) }
+func pair(a, b) { return [a, b] }
+func fail() { return 1 / 0 }
+func cycle() {
+  var a = []
+  push(a, a)
+  return a
+}
+var notAFunction = 1
+`))
+	result, err := evaluator.Call("fib", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(55), result)
+
+	result, err = evaluator.Call("describe", point{X: 3, Label: "p"})
+	assert.NoError(t, err)
+	assert.Equal(t, "p:3", result)
+
+	result, err = evaluator.Call("pair", "a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", nil}, result)
+
+	_, err = evaluator.Call("fail")
+	assert.EqualError(t, err, "Division by zero")
+	_, err = evaluator.Call("cycle")
+	assert.EqualError(t, err, "cannot convert a cyclic array to a Go value")
+	_, err = evaluator.Call("fib")
+	assert.EqualError(t, err, "Function 'fib' expects 1 arguments, 0 were given")
+	_, err = evaluator.Call("missing")
+	assert.EqualError(t, err, "cannot find callable symbol missing")
+	_, err = evaluator.Call("notAFunction")
+	assert.EqualError(t, err, "cannot invoke none callable object of type INTEGER")
+	_, err = evaluator.Call("fib", make(chan int))
+	assert.EqualError(t, err, "argument 1 of 'fib': cannot convert value of Go type chan int to a Comet value")
+	assert.Empty(t, evaluator.frames)
+}
+
+type counter struct {
+	Count int
+	Step  int `comet:"step"`
+	Name  string
+}
+
+func (c *counter) Add(n int) int {
+	c.Count += n * c.Step
+	return c.Count
+}
+
+func (c *counter) Reset() {
+	c.Count = 0
+}
+
+func (c *counter) Check(limit int) error {
+	if c.Count > limit {
+		return fmt.Errorf("count %d exceeds %d", c.Count, limit)
+	}
+	return nil
+}
+
+// registry is a NativeObject implemented without reflection.
+type registry struct {
+	values map[string]std2.CometObject
+}
+
+func (r *registry) Type() std2.CometType {
+	return std2.NativeType
+}
+
+func (r *registry) ToString() string {
+	return "Registry"
+}
+
+func (r *registry) GetField(name string) std2.CometObject {
+	value, found := r.values[name]
+	if !found {
+		return std2.NilObject
+	}
+	return value
+}
+
+func (r *registry) SetField(name string, value std2.CometObject) std2.CometObject {
+	if name == "readonly" {
+		return std2.CreateError("Field '%s' is read only", name)
+	}
+	r.values[name] = value
+	return nil
+}
+
+func (r *registry) CallMethod(ctx *std2.Context, name string, args ...std2.CometObject) std2.CometObject {
+	if name != "size" {
+		return ctx.Errorf("Unknown method '%s'", name)
+	}
+	return &std2.CometInt{Value: int64(len(r.values))}
+}
+
+func TestEvaluator_RegisterType(t *testing.T) {
+	evaluator := NewEvaluator()
+	assert.NoError(t, evaluator.RegisterType("Counter", counter{}))
+	assert.NoError(t, evaluator.RegisterType("PointerCounter", &counter{}))
+	assert.NoError(t, evaluator.RegisterType("StepCounter", func(step int) *counter { return &counter{Step: step} }))
+	assert.NoError(t, evaluator.RegisterType("Failing", func() (*counter, error) { return nil, errors.New("cannot create") }))
+	shared := &counter{Step: 1, Name: "shared"}
+	assert.NoError(t, evaluator.Register("shared", func() *counter { return shared }))
+	assert.NoError(t, evaluator.Register("registry", func() std2.CometObject {
+		return &registry{values: map[string]std2.CometObject{}}
+	}))
+
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"new Counter()", "Native(Type=counter)"},
+		{"new PointerCounter().count", "CometInt(0)"},
+		{"new Counter(1, 2)", "Comet error: \n\n\tBuiltin 'Counter.init' expects 0 arguments, got 2"},
+		{"new PointerCounter(1)", "Comet error: \n\n\tBuiltin 'PointerCounter.init' expects 0 arguments, got 1"},
+		{"var c = new StepCounter(2)\n c.add(3)\n c.Add(1)", "CometInt(8)"},
+		{"var c = new StepCounter(2)\n c.add(3)\n c.count", "CometInt(6)"},
+		{"var c = new Counter()\n c.step = 5\n c.step += 1\n c.add(1)", "CometInt(6)"},
+		{"var c = new StepCounter(1)\n c.add(5)\n c.reset()\n c.count", "CometInt(0)"},
+		{"var c = new StepCounter(10)\n c.add(1)\n c.check(5)", "Comet error: \n\n\tcount 10 exceeds 5 (line 3, column 4)"},
+		{"new StepCounter(1).check(5)", "CometNop"},
+		{"shared().add(2)\n shared().add(3)", "CometInt(5)"},
+		{"shared().name", `CometStr("shared")`},
+		{"new Counter().missing", "Comet error: \n\n\tField 'missing' not found on native type 'counter'"},
+		{"new Counter().missing()", "Comet error: \n\n\tCould not find method 'missing' on native type 'counter'"},
+		{`new Counter().count = "a"`, "Comet error: \n\n\tField 'count' of native type 'counter': cannot convert value of type STR to Go type int"},
+		{"new Counter().add()", "Comet error: \n\n\tBuiltin 'counter.add' expects 1 argument, got 0 (line 1, column 15)"},
+		{"new StepCounter()", "Comet error: \n\n\tBuiltin 'StepCounter.init' expects 1 argument, got 0"},
+		{"new Failing()", "Comet error: \n\n\tcannot create"},
+		{"var r = registry()\n r.a = 1\n r.b = 2\n r.a + r.size()", "CometInt(3)"},
+		{"var r = registry()\n r.readonly = 1", "Comet error: \n\n\tField 'readonly' is read only"},
+		{"registry().other()", "Comet error: \n\n\tUnknown method 'other' (line 1, column 12)"},
+		{"toString(new Counter())", `CometStr("Native(Type=counter)")`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+	assert.Equal(t, 5, shared.Count)
+
+	assert.EqualError(t, evaluator.RegisterType("Counter", counter{}), "cannot register type 'Counter', a type with the same name exists")
+	assert.EqualError(t, evaluator.RegisterType("Number", 1), "cannot register type 'Number', expected a struct or a function returning a pointer to a struct, got int")
+}
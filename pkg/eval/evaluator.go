@@ -1,9 +1,14 @@
 package eval
 
 import (
+	"context"
 	lexer2 "github.com/chermehdi/comet/pkg/lexer"
 	parser2 "github.com/chermehdi/comet/pkg/parser"
 	std2 "github.com/chermehdi/comet/pkg/std"
+	"io"
+	"math"
+	"math/big"
+	"os"
 	"strings"
 )
 
@@ -11,6 +16,60 @@ type Evaluator struct {
 	Scope    *Scope
 	Builtins map[string]*std2.Builtin
 	Types    map[string]*std2.CometStruct
+
+	// The streams used by the builtins, the standard streams of the process by default.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	// Strict disables truthiness rules, conditions (if, !, &&, ||) only accept
+	// CometBool values and report an error for any other type.
+	Strict bool
+
+	// MaxCallDepth is the maximum number of nested function calls, exceeding it reports an error
+	// instead of overflowing the stack. There is no limit if it's not positive.
+	MaxCallDepth int
+
+	// MaxSteps is the maximum number of nodes evaluated by EvalContext, there is no limit if it's
+	// not positive.
+	MaxSteps int64
+
+	// MaxCollectionSize is the maximum number of elements of the arrays, and of bytes of the strings,
+	// created by EvalContext. There is no limit if it's not positive.
+	MaxCollectionSize int
+
+	// Dir is the directory of the main program, its imports are relative to it. The working
+	// directory is used if it's empty.
+	Dir string
+
+	// SearchPaths are the directories searched for the imported modules that are not found
+	// relatively to the importing module.
+	SearchPaths []string
+
+	// Capabilities grant the programs access to the file system and the process, nothing is
+	// granted by default.
+	Capabilities std2.Capabilities
+
+	// The calls being evaluated, innermost last.
+	frames []*callFrame
+
+	// The constructors of the host types registered with RegisterType.
+	nativeTypes map[string]*std2.Builtin
+
+	// The imported modules by absolute path, and the modules being imported, innermost last.
+	modules   map[string]*Module
+	importing []*Module
+	// The module being evaluated, nil for the main program.
+	module *Module
+	// The global scope of the main program, set by the first import.
+	mainScope *Scope
+	// The module declaring each function declared by a module.
+	functionModules map[*std2.CometFunc]*Module
+
+	// The state of the evaluation started by EvalContext, ctx is nil otherwise.
+	ctx       context.Context
+	steps     int64
+	interrupt error
 }
 
 // Param is a named parameter within the interpreter
@@ -27,6 +86,15 @@ func NewEvaluator() *Evaluator {
 		Builtins: make(map[string]*std2.Builtin),
 		Types:    make(map[string]*std2.CometStruct),
 		Scope:    NewScope(nil),
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Stdin:    os.Stdin,
+
+		MaxCallDepth: DefaultMaxCallDepth,
+
+		nativeTypes:     make(map[string]*std2.Builtin),
+		modules:         make(map[string]*Module),
+		functionModules: make(map[*std2.CometFunc]*Module),
 	}
 	for _, builtin := range std2.Builtins {
 		ev.registerBuiltin(builtin)
@@ -38,6 +106,9 @@ type Scope struct {
 	// The variables bound to this Scope instance
 	Variables map[string]std2.CometObject
 
+	// The names of the variables declared as constants in this Scope instance
+	Constants map[string]bool
+
 	// The parent Scope if we are inside a function
 	// if this is nil, this is the global Scope instance.
 	Parent *Scope
@@ -48,6 +119,7 @@ func NewScope(parent *Scope) *Scope {
 	store := make(map[string]std2.CometObject)
 	return &Scope{
 		Variables: store,
+		Constants: make(map[string]bool),
 		Parent:    parent,
 	}
 }
@@ -87,8 +159,27 @@ func (sc *Scope) Declare(varName string, obj std2.CometObject) {
 	sc.Variables[varName] = obj
 }
 
+// DeclareConstant creates a symbol reference in the local scope that can't be reassigned.
+// Constants only protect the binding, the bound object itself can still be modified (e.g. an array's elements).
+func (sc *Scope) DeclareConstant(varName string, obj std2.CometObject) {
+	sc.Variables[varName] = obj
+	sc.Constants[varName] = true
+}
+
+// IsConstant reports whether the closest binding of varName is a constant.
+func (sc *Scope) IsConstant(varName string) bool {
+	if _, ok := sc.Variables[varName]; ok {
+		return sc.Constants[varName]
+	}
+	if sc.Parent != nil {
+		return sc.Parent.IsConstant(varName)
+	}
+	return false
+}
+
 func (sc *Scope) Clear(name string) {
 	delete(sc.Variables, name)
+	delete(sc.Constants, name)
 }
 
 // Evaluates the given node into a CometObject
@@ -96,6 +187,11 @@ func (sc *Scope) Clear(name string) {
 // Errors are CometObject instances as well, and they are designed to block
 // the evaluation process.
 func (ev *Evaluator) Eval(node parser2.Node) std2.CometObject {
+	if ev.ctx != nil {
+		if err := ev.step(); err != nil {
+			return err
+		}
+	}
 	switch n := node.(type) {
 	case *parser2.RootNode:
 		return ev.evalRootNode(n.Statements)
@@ -103,6 +199,12 @@ func (ev *Evaluator) Eval(node parser2.Node) std2.CometObject {
 		return ev.evalPrefixExpression(n)
 	case *parser2.NumberLiteral:
 		return &std2.CometInt{Value: n.ActualValue}
+	case *parser2.BigIntLiteral:
+		return &std2.CometBigInt{Value: n.ActualValue}
+	case *parser2.FloatLiteral:
+		return &std2.CometFloat{Value: n.ActualValue}
+	case *parser2.NilLiteral:
+		return std2.NilObject
 	case *parser2.BooleanLiteral:
 		if n.ActualValue {
 			return std2.TrueObject
@@ -119,9 +221,19 @@ func (ev *Evaluator) Eval(node parser2.Node) std2.CometObject {
 		return ev.Eval(n.Expression)
 	case *parser2.IfStatement:
 		return ev.evalConditional(n)
+	case *parser2.ConditionalExpression:
+		return ev.evalConditionalExpression(n)
 	case *parser2.BlockStatement:
 		return ev.evalStatements(n.Statements)
 	case *parser2.ReturnStatement:
+		if call, ok := n.Expression.(*parser2.CallExpression); ok {
+			if tail := ev.tailCall(call); tail != nil {
+				if isError(tail) {
+					return tail
+				}
+				return &std2.CometReturnWrapper{Value: tail}
+			}
+		}
 		result := ev.Eval(n.Expression)
 		if isError(result) {
 			return result
@@ -140,10 +252,30 @@ func (ev *Evaluator) Eval(node parser2.Node) std2.CometObject {
 		return ev.EvalAssignExpression(n)
 	case *parser2.IndexAccess:
 		return ev.evalArrayAccess(n)
+	case *parser2.SliceExpression:
+		return ev.evalSliceExpression(n)
+	case *parser2.IndexAssignExpression:
+		return ev.evalIndexAssignExpression(n)
 	case *parser2.ForStatement:
-		return unwrap(ev.evalForStatement(n))
+		return ev.evalForStatement(n)
+	case *parser2.ForClauseStatement:
+		return ev.evalForClauseStatement(n)
+	case *parser2.WhileStatement:
+		return ev.evalWhileStatement(n)
+	case *parser2.SwitchStatement:
+		return ev.evalSwitchStatement(n)
+	case *parser2.MatchExpression:
+		return ev.evalMatchExpression(n)
+	case *parser2.DestructuringStatement:
+		return ev.evalDestructuringStatement(n)
+	case *parser2.BreakStatement:
+		return std2.BreakInstance
+	case *parser2.ContinueStatement:
+		return std2.ContinueInstance
 	case *parser2.StructDeclarationStatement:
 		return ev.evalStructDecl(n)
+	case *parser2.ImportStatement:
+		return ev.evalImportStatement(n)
 	case *parser2.NewCallExpr:
 		return ev.evalNewCall(n)
 	}
@@ -158,8 +290,35 @@ func unwrap(result std2.CometObject) std2.CometObject {
 	return result
 }
 
+// functionResult computes the value of a function call from the result of evaluating its body.
+// Functions that complete without a return statement yield nil.
+func functionResult(result std2.CometObject) std2.CometObject {
+	switch result.Type() {
+	case std2.ReturnWrapper:
+		return unwrap(result)
+	case std2.ErrorType:
+		return result
+	default:
+		return std2.NilObject
+	}
+}
+
 func (ev *Evaluator) evalNewCall(expr *parser2.NewCallExpr) std2.CometObject {
-	t, found := ev.Types[expr.Type]
+	if constructor, found := ev.nativeTypes[expr.Type]; found {
+		return ev.evalNativeNewCall(constructor, expr)
+	}
+	types := ev.types()
+	if expr.Module != "" {
+		module, err := ev.lookupModule(expr.Module)
+		if err != nil {
+			return err
+		}
+		if err := module.checkExported(expr.Type); err != nil {
+			return err
+		}
+		types = module.Types
+	}
+	t, found := types[expr.Type]
 	if !found {
 		return std2.CreateError("Type '%s' not found", expr.Type)
 	}
@@ -185,26 +344,23 @@ func (ev *Evaluator) evalNewCall(expr *parser2.NewCallExpr) std2.CometObject {
 			Val:  v,
 		}
 	}
-	res := ev.callOnObject("init", instance, params...)
+	res := ev.callOnObject("init", lexer2.Token{}, instance, params...)
 	if res.Type() == std2.ErrorType {
 		return res
 	}
 	return instance
 }
 
-func (ev *Evaluator) callOnObject(name string, object *std2.CometInstance, params ...Param) std2.CometObject {
+// callOnObject calls the method of the given instance, site is the token of the call expression.
+func (ev *Evaluator) callOnObject(name string, site lexer2.Token, object *std2.CometInstance, params ...Param) std2.CometObject {
 	constructor, found := object.Struct.Methods[name]
 	if found {
-		callSiteScope := NewScope(ev.Scope)
+		callSiteScope := ev.callScope(constructor)
 		callSiteScope.Variables["this"] = object
 		for _, p := range params {
 			callSiteScope.Variables[p.Name] = p.Val
 		}
-		oldScope := ev.Scope
-		ev.Scope = callSiteScope
-		res := ev.Eval(constructor.Body)
-		ev.Scope = oldScope
-		return unwrap(res)
+		return ev.call(object.Struct.Name+"."+name, site, constructor, callSiteScope)
 	}
 	return std2.CreateError("Method '%s' Not found on instance of type '%s'", name, object.Struct.Name)
 }
@@ -241,9 +397,10 @@ func (ev *Evaluator) evalStructDecl(decl *parser2.StructDeclarationStatement) st
 		if err := s.Add(fn); err != nil {
 			return std2.CreateError(err.Error())
 		}
+		ev.declareInModule(fn)
 	}
 
-	ev.Types[s.Name] = s
+	ev.types()[s.Name] = s
 	return std2.NopInstance
 }
 
@@ -256,6 +413,8 @@ func (ev *Evaluator) evalStatements(statements []parser2.Statement) std2.CometOb
 			return cur
 		case *std2.CometError:
 			return cur
+		case *std2.CometBreak, *std2.CometContinue:
+			return cur
 		}
 	}
 	return res
@@ -268,157 +427,418 @@ func (ev *Evaluator) evalPrefixExpression(n *parser2.PrefixExpression) std2.Come
 	}
 	switch n.Op.Type {
 	case lexer2.Minus:
-		if res.Type() != std2.IntType {
-			return std2.CreateError("Cannot apply operator (-) on none INTEGER type %s", res.Type())
-		}
-		result := res.(*std2.CometInt)
-		result.Value *= -1
-		return result
+		return Negate(res)
 	case lexer2.Bang:
-		if res.Type() != std2.BoolType {
+		value, ok := ev.truthValue(res)
+		if !ok {
 			return std2.CreateError("Cannot apply operator (!) on none BOOLEAN type %s", res.Type())
 		}
-		result := res.(*std2.CometBool)
-		if result.Value {
-			return std2.FalseObject
-		} else {
-			return std2.TrueObject
-		}
+		return boolValue(!value)
 	default:
 		return std2.CreateError("Unrecognized prefix operator %s", n.Op.Literal)
 	}
 }
 
-func (ev *Evaluator) SetField(instance *std2.CometInstance, name string, value parser2.Expression) {
-	val := ev.Eval(value)
-	instance.Fields[name] = val
-}
-
 func (ev *Evaluator) evalBinaryExpression(n *parser2.BinaryExpression) std2.CometObject {
+	// Prioritize the dot operation
+	if isMemberAccess(n) {
+		value, _ := ev.evalMemberChain(n)
+		return value
+	}
 	left := ev.Eval(n.Left)
 	if isError(left) {
 		return left
 	}
 
-	// Prioritize the dot operation
-	if n.Op.Type == lexer2.Dot {
-		as, ok := n.Right.(*parser2.AssignExpression)
-		if ok {
-			instance := left.(*std2.CometInstance)
-			ev.SetField(instance, as.VarName, as.Value)
-			return std2.NopInstance
-		}
-		id, ok := n.Right.(*parser2.IdentifierExpression)
-		if ok {
-			instance := left.(*std2.CometInstance)
-			return instance.Fields[id.Name]
-		}
-		fn, ok := n.Right.(*parser2.CallExpression)
-		if !ok {
-			return std2.CreateError("Used '.' operator with none function element")
-		}
-		if left.Type() != std2.ObjType {
-			// You can't call methods on none object types
-			return std2.CreateError("Cannot call method '%s' on none object type", fn.Name)
-		}
-
-		instance := left.(*std2.CometInstance)
-		method, found := instance.Struct.GetMethod(fn.Name)
-
-		if !found {
-			return std2.CreateError("Could not find method '%s' on type '%s'", fn.Name, instance.Struct.Name)
-		}
-
-		params := make([]Param, len(fn.Arguments))
-		if len(method.Params) > len(fn.Arguments) {
-			return std2.CreateError("Method '%s' on type '%s' expects at least %d parameters, %d were given",
-				method.Name,
-				instance.Struct.Name,
-				len(method.Params),
-				len(fn.Arguments))
-		}
-
-		for i, p := range method.Params {
-			v := ev.Eval(fn.Arguments[i])
-			if v.Type() == std2.ErrorType {
-				return v
-			}
-			params[i] = Param{
-				Name: p.Name,
-				Val:  v,
-			}
+	switch n.Op.Type {
+	case lexer2.ANDAND, lexer2.OROR:
+		return ev.evalLogicalExpression(n.Op, left, n.Right)
+	case lexer2.Coalesce:
+		// The right side is only evaluated if the left side is nil.
+		if left.Type() != std2.NilType {
+			return left
 		}
-		return ev.callOnObject(fn.Name, instance, params...)
+		return ev.Eval(n.Right)
 	}
 
 	right := ev.Eval(n.Right)
 	if isError(right) {
 		return right
 	}
+	if err := ev.checkOperation(n.Op, left, right); err != nil {
+		return err
+	}
+	return ApplyBinaryOperator(n.Op, left, right)
+}
+
+// evalMemberChain evaluates a chain of '.' and '?.' operators. Safe navigation: accessing anything
+// on nil with '?.' yields nil, and skips the rest of the chain, the second returned value is true
+// if the chain was skipped.
+func (ev *Evaluator) evalMemberChain(n *parser2.BinaryExpression) (std2.CometObject, bool) {
+	var left std2.CometObject
+	if inner, ok := n.Left.(*parser2.BinaryExpression); ok && isMemberAccess(inner) {
+		value, skipped := ev.evalMemberChain(inner)
+		if skipped {
+			return value, true
+		}
+		left = value
+	} else {
+		left = ev.Eval(n.Left)
+	}
+	if isError(left) {
+		return left, false
+	}
+	if n.Op.Type == lexer2.QuestionDot && left.Type() == std2.NilType {
+		return std2.NilObject, true
+	}
+	return ev.evalDotAccess(left, n.Right), false
+}
+
+// isMemberAccess returns true for the '.' and '?.' operators.
+func isMemberAccess(n *parser2.BinaryExpression) bool {
+	return n.Op.Type == lexer2.Dot || n.Op.Type == lexer2.QuestionDot
+}
+
+// ApplyBinaryOperator applies the operator on the already evaluated operands.
+// This is shared by binary expressions and compound assignments, so that a += b
+// behaves exactly like a = a + b. The vm package uses it as well to produce the same results.
+func ApplyBinaryOperator(op lexer2.Token, left std2.CometObject, right std2.CometObject) std2.CometObject {
 
 	if left.Type() == std2.IntType && right.Type() == std2.IntType {
-		return applyOp(n.Op.Type, left, right)
+		return applyOp(op.Type, left, right)
+	}
+	if isInteger(left) && isInteger(right) {
+		// At least one of the operands is a bigint, the other one is promoted.
+		return applyBigOp(op.Type, toBigInt(left), toBigInt(right))
+	}
+	if isNumber(left) && isNumber(right) {
+		// At least one of the operands is a float, the other one is converted.
+		return applyFloatOp(op.Type, toFloat(left), toFloat(right))
 	}
 	if left.Type() == std2.BoolType && right.Type() == std2.BoolType {
-		return applyBoolOp(n.Op.Type, left, right)
+		return applyBoolOp(op.Type, left, right)
 	}
 	if left.Type() == std2.StrType && right.Type() == std2.StrType {
-		return applyStrOp(n.Op.Type, left, right)
+		return applyStrOp(op.Type, left, right)
 	}
 	if left.Type() == std2.StrType || right.Type() == std2.StrType {
 		// one of the two is a string, the other one should be promoted to a string
-		if n.Op.Type == lexer2.Plus {
-			return applyStrOp(n.Op.Type, std2.ToString(left), std2.ToString(right))
-		} else if n.Op.Type == lexer2.Mul && (left.Type() == std2.IntType || right.Type() == std2.IntType) {
+		if op.Type == lexer2.Plus {
+			return applyStrOp(op.Type, std2.ToString(left), std2.ToString(right))
+		} else if op.Type == lexer2.Mul && (left.Type() == std2.IntType || right.Type() == std2.IntType) {
+			str, count := left, right
 			if left.Type() == std2.IntType {
-				leftValue := left.(*std2.CometInt)
-				rightValue := right.(*std2.CometStr)
-				return &std2.CometStr{Value: strings.Repeat(rightValue.Value, int(leftValue.Value)), Size: int(leftValue.Value) * rightValue.Size}
-			} else {
-				leftValue := left.(*std2.CometStr)
-				rightValue := right.(*std2.CometInt)
-				return &std2.CometStr{Value: strings.Repeat(leftValue.Value, int(rightValue.Value)), Size: int(rightValue.Value) * leftValue.Size}
+				str, count = right, left
+			}
+			result, err := std2.Repeat(str.(*std2.CometStr).Value, count.(*std2.CometInt).Value)
+			if err != nil {
+				return std2.CreateError("%s", err)
 			}
+			return result
 		} else {
-			return std2.CreateError("Cannot apply operation '%s' on operands of type '%s' and '%s'", n.Op.Literal, left.Type(), right.Type())
+			return std2.CreateError("Cannot apply operation '%s' on operands of type '%s' and '%s'", op.Literal, left.Type(), right.Type())
+		}
+	}
+	if left.Type() == std2.NilType && right.Type() == std2.NilType {
+		switch op.Type {
+		case lexer2.EQ:
+			return std2.TrueObject
+		case lexer2.NEQ:
+			return std2.FalseObject
 		}
 	}
 	if left.Type() != right.Type() {
 		// operators == and != are applicable here, Objects with different types are always not equal in comet.
-		switch n.Op.Type {
+		switch op.Type {
 		case lexer2.EQ:
 			return std2.FalseObject
 		case lexer2.NEQ:
 			return std2.TrueObject
 		}
 	}
-	return std2.CreateError("Cannot apply operator %s on given types %v and %v", n.Op.Literal, left.Type(), right.Type())
+	return std2.CreateError("Cannot apply operator %s on given types %v and %v", op.Literal, left.Type(), right.Type())
+}
+
+// evalLogicalExpression evaluates the && and || operators, the right side is only
+// evaluated if the left side does not determine the result.
+func (ev *Evaluator) evalLogicalExpression(op lexer2.Token, left std2.CometObject, right parser2.Expression) std2.CometObject {
+	leftValue, ok := ev.truthValue(left)
+	if !ok {
+		return std2.CreateError("Cannot apply operator (%s) on none BOOLEAN type %s", op.Literal, left.Type())
+	}
+	if op.Type == lexer2.ANDAND && !leftValue {
+		return std2.FalseObject
+	}
+	if op.Type == lexer2.OROR && leftValue {
+		return std2.TrueObject
+	}
+	rightObj := ev.Eval(right)
+	if isError(rightObj) {
+		return rightObj
+	}
+	rightValue, ok := ev.truthValue(rightObj)
+	if !ok {
+		return std2.CreateError("Cannot apply operator (%s) on none BOOLEAN type %s", op.Literal, rightObj.Type())
+	}
+	return boolValue(rightValue)
+}
+
+// truthValue returns the boolean value of the object when used as a condition, see TruthValue.
+func (ev *Evaluator) truthValue(obj std2.CometObject) (bool, bool) {
+	return TruthValue(obj, ev.Strict)
+}
+
+// evalDotAccess evaluates the right side of a '.' operator (field assignment, field access
+// or method call) against the already evaluated left side.
+func (ev *Evaluator) evalDotAccess(left std2.CometObject, right parser2.Expression) std2.CometObject {
+	if native, ok := left.(std2.NativeObject); ok {
+		return ev.evalNativeAccess(native, right)
+	}
+	as, ok := right.(*parser2.AssignExpression)
+	if ok {
+		if left.Type() != std2.ObjType {
+			return std2.CreateError("Cannot set field '%s' on none object type %s", as.VarName, left.Type())
+		}
+		instance := left.(*std2.CometInstance)
+		current, found := instance.Fields[as.VarName]
+		if !found {
+			current = std2.NilObject
+		}
+		value := ev.evalAssignedValue(as.Op, current, as.Value)
+		if isError(value) {
+			return value
+		}
+		instance.Fields[as.VarName] = value
+		return value
+	}
+	id, ok := right.(*parser2.IdentifierExpression)
+	if ok {
+		if left.Type() != std2.ObjType {
+			return std2.CreateError("Cannot access field '%s' on none object type %s", id.Name, left.Type())
+		}
+		instance := left.(*std2.CometInstance)
+		value, found := instance.Fields[id.Name]
+		if !found {
+			return std2.NilObject
+		}
+		return value
+	}
+	fn, ok := right.(*parser2.CallExpression)
+	if !ok {
+		return std2.CreateError("Used '.' operator with none function element")
+	}
+	if left.Type() != std2.ObjType {
+		// You can't call methods on none object types
+		return std2.CreateError("Cannot call method '%s' on none object type", fn.Name)
+	}
+
+	instance := left.(*std2.CometInstance)
+	method, found := instance.Struct.GetMethod(fn.Name)
+
+	if !found {
+		return std2.CreateError("Could not find method '%s' on type '%s'", fn.Name, instance.Struct.Name)
+	}
+
+	params := make([]Param, len(fn.Arguments))
+	if len(method.Params) > len(fn.Arguments) {
+		return std2.CreateError("Method '%s' on type '%s' expects at least %d parameters, %d were given",
+			method.Name,
+			instance.Struct.Name,
+			len(method.Params),
+			len(fn.Arguments))
+	}
+
+	for i, p := range method.Params {
+		v := ev.Eval(fn.Arguments[i])
+		if v.Type() == std2.ErrorType {
+			return v
+		}
+		params[i] = Param{
+			Name: p.Name,
+			Val:  v,
+		}
+	}
+	return ev.callOnObject(fn.Name, fn.Token, instance, params...)
 }
 
 func (ev *Evaluator) evalConditional(n *parser2.IfStatement) std2.CometObject {
 	predicateRes := ev.Eval(n.Test)
-	if predicateRes.Type() != std2.BoolType {
+	if isError(predicateRes) {
+		return predicateRes
+	}
+	result, ok := ev.truthValue(predicateRes)
+	if !ok {
 		return std2.CreateError("Test part of the if statement should evaluate to CometBool, evaluated to %s instead", predicateRes.ToString())
 	}
-	result := predicateRes.(*std2.CometBool)
-	if result.Value {
-		return ev.Eval(&n.Then)
+	var value std2.CometObject
+	if result {
+		value = ev.Eval(&n.Then)
 	} else {
-		return ev.Eval(&n.Else)
+		value = ev.Eval(&n.Else)
 	}
+	if value.Type() == std2.Nop {
+		// if can be used as an expression, an empty branch yields nil.
+		return std2.NilObject
+	}
+	return value
+}
+
+func (ev *Evaluator) evalConditionalExpression(n *parser2.ConditionalExpression) std2.CometObject {
+	predicateRes := ev.Eval(n.Test)
+	if isError(predicateRes) {
+		return predicateRes
+	}
+	result, ok := ev.truthValue(predicateRes)
+	if !ok {
+		return std2.CreateError("Test part of the conditional expression should evaluate to CometBool, evaluated to %s instead", predicateRes.ToString())
+	}
+	if result {
+		return ev.Eval(n.Then)
+	}
+	return ev.Eval(n.Else)
+}
+
+func (ev *Evaluator) evalSwitchStatement(n *parser2.SwitchStatement) std2.CometObject {
+	subject := ev.Eval(n.Subject)
+	if isError(subject) {
+		return subject
+	}
+	for _, switchCase := range n.Cases {
+		for _, value := range switchCase.Values {
+			candidate := ev.Eval(value)
+			if isError(candidate) {
+				return candidate
+			}
+			if MatchesCase(subject, candidate) {
+				return ev.Eval(switchCase.Body)
+			}
+		}
+	}
+	return ev.Eval(n.Default)
+}
+
+// MatchesCase reports whether the subject of a switch statement matches a case value.
+// Ranges match integers between their bounds (inclusive), other values match if they are equal.
+func MatchesCase(subject std2.CometObject, candidate std2.CometObject) bool {
+	if candidate.Type() == std2.RangeType && subject.Type() == std2.IntType {
+		rangeObj := candidate.(*std2.CometRange)
+		value := subject.(*std2.CometInt).Value
+		return rangeObj.From.Value <= value && value <= rangeObj.To.Value
+	}
+	equal := ApplyBinaryOperator(lexer2.NewToken(lexer2.EQ, lexer2.EQ), subject, candidate)
+	return equal == std2.TrueObject
+}
+
+// evalMatchExpression evaluates the body of the first arm matching the subject, in a scope
+// holding the names bound by the arm's pattern.
+func (ev *Evaluator) evalMatchExpression(n *parser2.MatchExpression) std2.CometObject {
+	subject := ev.Eval(n.Subject)
+	if isError(subject) {
+		return subject
+	}
+	for _, arm := range n.Arms {
+		bindings := NewScope(ev.Scope)
+		matched, err := ev.matchPattern(arm.Pattern, subject, bindings)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		oldScope := ev.Scope
+		ev.Scope = bindings
+		result := ev.Eval(arm.Body)
+		ev.Scope = oldScope
+		if result.Type() == std2.Nop {
+			// match is an expression, arms with an empty body yield nil.
+			return std2.NilObject
+		}
+		return result
+	}
+	return std2.CreateError("No pattern matched the value %s", subject.ToString())
+}
+
+func (ev *Evaluator) evalDestructuringStatement(n *parser2.DestructuringStatement) std2.CometObject {
+	value := ev.Eval(n.Expression)
+	if isError(value) {
+		return value
+	}
+	// Names are only declared if the whole pattern matches.
+	bindings := NewScope(ev.Scope)
+	matched, err := ev.matchPattern(n.Pattern, value, bindings)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return std2.CreateError("Cannot destructure %s with the pattern %s", value.ToString(), n.Pattern.Literal())
+	}
+	for name := range bindings.Variables {
+		if err := ev.checkRedeclaration(name); err != nil {
+			return err
+		}
+	}
+	for name, obj := range bindings.Variables {
+		ev.declare(name, obj, n.Constant)
+	}
+	return value
+}
+
+// matchPattern reports whether the value matches the pattern, the names bound by the pattern
+// are declared in the bindings scope.
+func (ev *Evaluator) matchPattern(pattern parser2.Pattern, value std2.CometObject, bindings *Scope) (bool, std2.CometObject) {
+	return MatchPattern(pattern, value, &scopeMatcher{ev: ev, bindings: bindings})
+}
+
+// scopeMatcher evaluates the literal patterns in the current scope and declares the bound names
+// in a bindings scope.
+type scopeMatcher struct {
+	ev       *Evaluator
+	bindings *Scope
+}
+
+func (m *scopeMatcher) LiteralValue(pattern *parser2.LiteralPattern) std2.CometObject {
+	return m.ev.Eval(pattern.Value)
+}
+
+func (m *scopeMatcher) LookupType(name string) (*std2.CometStruct, bool) {
+	t, found := m.ev.types()[name]
+	return t, found
+}
+
+func (m *scopeMatcher) Bind(name string, value std2.CometObject) {
+	m.bindings.Declare(name, value)
 }
 
 func (ev *Evaluator) evalDeclareStatement(n *parser2.DeclarationStatement) std2.CometObject {
+	if err := ev.checkRedeclaration(n.Identifier.Literal); err != nil {
+		return err
+	}
 	value := ev.Eval(n.Expression)
 	if isError(value) {
 		return value
 	}
-	// TODO(chermehdi): add a shadowing diagnostic message if the store is overriding
-	// an existing variable
-	ev.Scope.Declare(n.Identifier.Literal, value)
+	ev.declare(n.Identifier.Literal, value, n.Constant)
 	return value
 }
 
+// checkRedeclaration reports an error if name is a constant of the current scope.
+// Redeclaring a variable is allowed at runtime (e.g. from the REPL), the parser diagnoses
+// redeclarations within the same source.
+func (ev *Evaluator) checkRedeclaration(name string) std2.CometObject {
+	if ev.Scope.Constants[name] {
+		return std2.CreateError("Cannot redeclare constant '%s'", name)
+	}
+	return nil
+}
+
+func (ev *Evaluator) declare(name string, value std2.CometObject, constant bool) {
+	if constant {
+		ev.Scope.DeclareConstant(name, value)
+	} else {
+		ev.Scope.Declare(name, value)
+	}
+}
+
 func (ev *Evaluator) evalIdentifier(n *parser2.IdentifierExpression) std2.CometObject {
 	obj, found := ev.Scope.Lookup(n.Name)
 	if !found {
@@ -428,43 +848,80 @@ func (ev *Evaluator) evalIdentifier(n *parser2.IdentifierExpression) std2.CometO
 }
 
 func (ev *Evaluator) registerFunc(n *parser2.FunctionStatement) std2.CometObject {
+	if err := ev.checkRedeclaration(n.Name); err != nil {
+		return err
+	}
 	function := &std2.CometFunc{
 		Name:   n.Name,
 		Params: n.Parameters,
 		Body:   n.Block,
 	}
+	ev.declareInModule(function)
 	ev.Scope.Declare(n.Name, function)
 	return function
 }
 
 func (ev *Evaluator) evalCallExpression(n *parser2.CallExpression) std2.CometObject {
 	funcName := n.Name
-	if ev.isBuiltinFunc(funcName) {
-		args := make([]std2.CometObject, 0)
-		for i := range n.Arguments {
-			args = append(args, ev.Eval(n.Arguments[i]))
+	// The functions and variables of the program take precedence over the builtins.
+	function, found := ev.Scope.Lookup(funcName)
+	if !found && ev.isBuiltinFunc(funcName) {
+		args, err := ev.evalArguments(n.Arguments)
+		if err != nil {
+			return err
 		}
-		return ev.invokeBuiltin(funcName, args...)
+		return ev.invokeBuiltin(funcName, n.Token, args...)
 	}
-
-	function, found := ev.Scope.Lookup(funcName)
 	if !found {
 		return std2.CreateError("Cannot find callable symbol %s", funcName)
 	}
+	if builtin, ok := function.(*std2.Builtin); ok {
+		// Builtins bound to a name, imported from a module of the standard library.
+		args, err := ev.evalArguments(n.Arguments)
+		if err != nil {
+			return err
+		}
+		return builtin.Invoke(ev.builtinContext(n.Token), args...)
+	}
 	if function.Type() != std2.FuncType {
 		return std2.CreateError("Cannot invoke none callable object of type %s", function.Type())
 	}
 
 	funObj, _ := function.(*std2.CometFunc)
-	callSiteScope := NewScope(ev.Scope)
-	for i, param := range funObj.Params {
-		callSiteScope.Variables[param.Name] = ev.Eval(n.Arguments[i])
+	callSiteScope := ev.callScope(funObj)
+	if err := ev.bindArguments(funObj, n.Arguments, callSiteScope); err != nil {
+		return err
 	}
-	oldScope := ev.Scope
-	ev.Scope = callSiteScope
-	result := ev.Eval(funObj.Body)
-	ev.Scope = oldScope
-	return result
+	return ev.call(funObj.Name, n.Token, funObj, callSiteScope)
+}
+
+// bindArguments evaluates the arguments of a call and declares them in the scope of the call. All
+// the arguments are evaluated, the extra ones are ignored.
+func (ev *Evaluator) bindArguments(function *std2.CometFunc, arguments []parser2.Expression, scope *Scope) std2.CometObject {
+	args, err := ev.evalArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(args) < len(function.Params) {
+		return std2.CreateError("Function '%s' expects %d arguments, %d were given", function.Name, len(function.Params), len(args))
+	}
+	for i, param := range function.Params {
+		scope.Variables[param.Name] = args[i]
+	}
+	return nil
+}
+
+// evalArguments evaluates the arguments of a call, it returns the error of the first argument
+// evaluated to an error.
+func (ev *Evaluator) evalArguments(arguments []parser2.Expression) ([]std2.CometObject, std2.CometObject) {
+	args := make([]std2.CometObject, len(arguments))
+	for i, arg := range arguments {
+		args[i] = ev.Eval(arg)
+		if isError(args[i]) {
+			return nil, args[i]
+		}
+	}
+	return args, nil
 }
 
 func (ev *Evaluator) isBuiltinFunc(name string) bool {
@@ -476,33 +933,177 @@ func (ev *Evaluator) registerBuiltin(builtin *std2.Builtin) {
 	ev.Builtins[builtin.Name] = builtin
 }
 
-func (ev *Evaluator) invokeBuiltin(name string, args ...std2.CometObject) std2.CometObject {
-	return ev.Builtins[name].Func(args...)
+func (ev *Evaluator) invokeBuiltin(name string, site lexer2.Token, args ...std2.CometObject) std2.CometObject {
+	return ev.Builtins[name].Invoke(ev.builtinContext(site), args...)
+}
+
+// builtinContext gives the builtins access to the evaluator and its streams.
+func (ev *Evaluator) builtinContext(site lexer2.Token) *std2.Context {
+	return &std2.Context{Interpreter: ev, Stdout: ev.Stdout, Stderr: ev.Stderr, Stdin: ev.Stdin, Site: site, Capabilities: ev.Capabilities}
+}
+
+// CallFunction invokes a function value with the given arguments, the scope of the call has the
+// current scope as parent like the calls of the program. It's used by the builtins taking callbacks,
+// which can also be builtins imported from the standard library.
+func (ev *Evaluator) CallFunction(function std2.CometObject, args ...std2.CometObject) std2.CometObject {
+	if builtin, ok := function.(*std2.Builtin); ok {
+		return builtin.Invoke(ev.builtinContext(lexer2.Token{}), args...)
+	}
+	funObj, ok := function.(*std2.CometFunc)
+	if !ok {
+		return std2.CreateError("Cannot invoke none callable object of type %s", function.Type())
+	}
+	if len(args) < len(funObj.Params) {
+		return std2.CreateError("Function '%s' expects %d arguments, %d were given", funObj.Name, len(funObj.Params), len(args))
+	}
+	scope := ev.callScope(funObj)
+	for i, param := range funObj.Params {
+		scope.Variables[param.Name] = args[i]
+	}
+	return ev.call(funObj.Name, lexer2.Token{}, funObj, scope)
+}
+
+// Lookup returns the value bound to the given name in the current scope.
+func (ev *Evaluator) Lookup(name string) (std2.CometObject, bool) {
+	return ev.Scope.Lookup(name)
 }
 
 func (ev *Evaluator) evalForStatement(n *parser2.ForStatement) std2.CometObject {
 	obj := ev.Eval(n.Range)
+	if isError(obj) {
+		return obj
+	}
+	oldScope := ev.Scope
+	defer func() { ev.Scope = oldScope }()
 	switch obj.Type() {
 	case std2.RangeType:
 		rangeObj := obj.(*std2.CometRange)
-		oldScope := ev.Scope
-		curScope := NewScope(oldScope)
-		ev.Scope = curScope
 		for i := rangeObj.From.Value; i <= rangeObj.To.Value; i++ {
+			// Every iteration gets its own scope, declarations in the body don't leak
+			// to the next iteration.
+			if err := ev.checkContext(); err != nil {
+				return err
+			}
+			ev.Scope = NewScope(oldScope)
 			ev.Scope.Declare(n.Key.Name, &std2.CometInt{Value: i})
 			ev.Scope.Declare(n.Value.Name, &std2.CometInt{Value: i})
-			ev.Eval(n.Body)
+			if stop, res := loopControl(ev.Eval(n.Body)); stop {
+				return res
+			}
 		}
-		ev.Scope.Clear(n.Key.Name)
-		ev.Scope.Clear(n.Value.Name)
-		ev.Scope = oldScope
 		return std2.NopInstance
+	case std2.ArrayType:
+		array := obj.(*std2.CometArray)
+		for i := 0; i < array.Length; i++ {
+			if err := ev.checkContext(); err != nil {
+				return err
+			}
+			ev.Scope = NewScope(oldScope)
+			ev.Scope.Declare(n.Key.Name, &std2.CometInt{Value: int64(i)})
+			ev.Scope.Declare(n.Value.Name, array.Values[i])
+			if stop, res := loopControl(ev.Eval(n.Body)); stop {
+				return res
+			}
+		}
+		return std2.NopInstance
+	default:
+		return std2.CreateError("Cannot iterate over value of type %s", obj.Type())
+	}
+}
+
+func (ev *Evaluator) evalForClauseStatement(n *parser2.ForClauseStatement) std2.CometObject {
+	oldScope := ev.Scope
+	defer func() { ev.Scope = oldScope }()
+	// Variables declared in the init clause live for the whole loop.
+	loopScope := NewScope(oldScope)
+	ev.Scope = loopScope
+	if n.Init != nil {
+		if res := ev.Eval(n.Init); isError(res) {
+			return res
+		}
+	}
+	for {
+		if err := ev.checkContext(); err != nil {
+			return err
+		}
+		if n.Test != nil {
+			ev.Scope = loopScope
+			test, err := ev.evalLoopTest(n.Test, "for")
+			if err != nil {
+				return err
+			}
+			if !test {
+				break
+			}
+		}
+		ev.Scope = NewScope(loopScope)
+		if stop, res := loopControl(ev.Eval(n.Body)); stop {
+			return res
+		}
+		if n.Post != nil {
+			ev.Scope = loopScope
+			if res := ev.Eval(n.Post); isError(res) {
+				return res
+			}
+		}
+	}
+	return std2.NopInstance
+}
+
+func (ev *Evaluator) evalWhileStatement(n *parser2.WhileStatement) std2.CometObject {
+	oldScope := ev.Scope
+	defer func() { ev.Scope = oldScope }()
+	for {
+		if err := ev.checkContext(); err != nil {
+			return err
+		}
+		ev.Scope = oldScope
+		test, err := ev.evalLoopTest(n.Test, "while")
+		if err != nil {
+			return err
+		}
+		if !test {
+			break
+		}
+		ev.Scope = NewScope(oldScope)
+		if stop, res := loopControl(ev.Eval(n.Body)); stop {
+			return res
+		}
+	}
+	return std2.NopInstance
+}
+
+// evalLoopTest evaluates the condition of a loop statement, the returned object is non nil
+// if the evaluation failed.
+func (ev *Evaluator) evalLoopTest(test parser2.Expression, statement string) (bool, std2.CometObject) {
+	res := ev.Eval(test)
+	if isError(res) {
+		return false, res
+	}
+	value, ok := ev.truthValue(res)
+	if !ok {
+		return false, std2.CreateError("Test part of the %s statement should evaluate to CometBool, evaluated to %s instead", statement, res.ToString())
+	}
+	return value, nil
+}
+
+// loopControl inspects the result of evaluating the body of a loop, and reports whether
+// the loop should stop, and if so, the value the loop statement evaluates to.
+func loopControl(res std2.CometObject) (bool, std2.CometObject) {
+	switch res.Type() {
+	case std2.BreakType:
+		return true, std2.NopInstance
+	case std2.ReturnWrapper, std2.ErrorType:
+		return true, res
 	default:
-		panic("not implemented yet!!")
+		return false, nil
 	}
 }
 
 func (ev *Evaluator) evalArrayElements(arr *parser2.ArrayLiteral) std2.CometObject {
+	if err := ev.checkSize(int64(len(arr.Elements))); err != nil {
+		return err
+	}
 	array := &std2.CometArray{
 		Length: len(arr.Elements),
 	}
@@ -516,45 +1117,201 @@ func (ev *Evaluator) evalArrayElements(arr *parser2.ArrayLiteral) std2.CometObje
 	return array
 }
 
+// evalArrayAccess evaluates an index access on an array or a string, see IndexAccess.
 func (ev *Evaluator) evalArrayAccess(arr *parser2.IndexAccess) std2.CometObject {
-	array := ev.Eval(arr.Identifier)
-	if array.Type() != std2.ArrayType {
-		return std2.CreateError("Expected CometArray got %s", array.Type())
+	target := ev.Eval(arr.Identifier)
+	if isError(target) {
+		return target
 	}
 	index := ev.Eval(arr.Index)
-	if index.Type() != std2.IntType {
-		return std2.CreateError("Expected CometInt got %s", index.Type())
+	if isError(index) {
+		return index
+	}
+	return IndexAccess(target, index)
+}
+
+// evalSliceExpression evaluates a[start:stop:step] on an array or a string, see Slice.
+func (ev *Evaluator) evalSliceExpression(n *parser2.SliceExpression) std2.CometObject {
+	target := ev.Eval(n.Target)
+	if isError(target) {
+		return target
+	}
+	bounds := make([]std2.CometObject, 3)
+	for i, bound := range []parser2.Expression{n.Start, n.Stop, n.Step} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = ev.Eval(bound)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+	return Slice(target, bounds[0], bounds[1], bounds[2])
+}
+
+// NormalizeIndex converts a possibly negative index into an offset in a sequence of the given length.
+// The second returned value is false if the index is out of bounds.
+func NormalizeIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
 	}
-	indexVal := index.(*std2.CometInt)
-	arrayVal := array.(*std2.CometArray)
-	if indexVal.Value < 0 || indexVal.Value >= int64(arrayVal.Length) {
-		return std2.CreateError("Array access out of bounds, array of length %d, index was: %d", arrayVal.Length, indexVal.Value)
+	if index < 0 || index >= int64(length) {
+		return 0, false
 	}
-	return arrayVal.Values[int(indexVal.Value)]
+	return int(index), true
+}
+
+// SliceIndexes computes the offsets selected by start:stop:step in a sequence of the given length.
+// nil bounds take their default value, negative bounds are counted from the end and bounds
+// out of the sequence are clamped, a negative step walks the sequence backwards.
+func SliceIndexes(length int, start, stop, step *int64) ([]int, std2.CometObject) {
+	stepVal := int64(1)
+	if step != nil {
+		stepVal = *step
+	}
+	if stepVal == 0 {
+		return nil, std2.CreateError("Slice step cannot be zero")
+	}
+	n := int64(length)
+	// Bounds are clamped to [lower, upper], a backward slice can stop before the first element.
+	lower, upper := int64(0), n
+	startVal, stopVal := int64(0), n
+	if stepVal < 0 {
+		lower, upper = -1, n-1
+		startVal, stopVal = n-1, -1
+	}
+	clamp := func(bound *int64, defaultVal int64) int64 {
+		if bound == nil {
+			return defaultVal
+		}
+		val := *bound
+		if val < 0 {
+			val += n
+		}
+		if val < lower {
+			return lower
+		}
+		if val > upper {
+			return upper
+		}
+		return val
+	}
+	startVal = clamp(start, startVal)
+	stopVal = clamp(stop, stopVal)
+	indexes := make([]int, 0)
+	for i := startVal; (stepVal > 0 && i < stopVal) || (stepVal < 0 && i > stopVal); i += stepVal {
+		indexes = append(indexes, int(i))
+	}
+	return indexes, nil
 }
 
 func (ev *Evaluator) EvalAssignExpression(n *parser2.AssignExpression) std2.CometObject {
-	_, found := ev.Scope.Lookup(n.VarName)
+	current, found := ev.Scope.Lookup(n.VarName)
 	if !found {
 		return std2.CreateError("Identifier (%s) is not bounded to any value, have you tried declaring it?", n.VarName)
 	}
-	result := unwrap(ev.Eval(n.Value))
+	if ev.Scope.IsConstant(n.VarName) {
+		return std2.CreateError("Cannot assign to constant '%s'", n.VarName)
+	}
+	result := ev.evalAssignedValue(n.Op, current, n.Value)
+	if isError(result) {
+		return result
+	}
 	ev.Scope.Store(n.VarName, result)
 	return result
 }
 
+func (ev *Evaluator) evalIndexAssignExpression(n *parser2.IndexAssignExpression) std2.CometObject {
+	target := ev.Eval(n.Target.Identifier)
+	if isError(target) {
+		return target
+	}
+	index := ev.Eval(n.Target.Index)
+	if isError(index) {
+		return index
+	}
+	array, i, err := IndexTarget(target, index)
+	if err != nil {
+		return err
+	}
+	result := ev.evalAssignedValue(n.Op, array.Values[i], n.Value)
+	if isError(result) {
+		return result
+	}
+	// The target is checked again, evaluating the value can change the length of the array.
+	if array, i, err = IndexTarget(target, index); err != nil {
+		return err
+	}
+	array.Values[i] = result
+	return result
+}
+
+// evalAssignedValue computes the value to store by an assignment, given the current value of the target.
+// For compound assignments (op is not the zero Token) the target is only evaluated once, and the
+// operator is applied exactly like in the expanded form: target = target op value.
+func (ev *Evaluator) evalAssignedValue(op lexer2.Token, current std2.CometObject, value parser2.Expression) std2.CometObject {
+	result := unwrap(ev.Eval(value))
+	if isError(result) || op.Type == "" {
+		return result
+	}
+	if err := ev.checkOperation(op, current, result); err != nil {
+		return err
+	}
+	return ApplyBinaryOperator(op, current, result)
+}
+
+// applyOp applies the operator on two CometInt operands.
+// Arithmetic operations that would overflow an int64 are transparently
+// promoted to a CometBigInt.
 func applyOp(op lexer2.TokenType, left std2.CometObject, right std2.CometObject) std2.CometObject {
 	leftInt := left.(*std2.CometInt)
 	rightInt := right.(*std2.CometInt)
+	a, b := leftInt.Value, rightInt.Value
 	switch op {
 	case lexer2.Plus:
-		return &std2.CometInt{Value: leftInt.Value + rightInt.Value}
+		r := a + b
+		if (a^r)&(b^r) < 0 {
+			return applyBigOp(op, std2.NewBigInt(leftInt), std2.NewBigInt(rightInt))
+		}
+		return &std2.CometInt{Value: r}
 	case lexer2.Minus:
-		return &std2.CometInt{Value: leftInt.Value - rightInt.Value}
+		r := a - b
+		if (a^b)&(a^r) < 0 {
+			return applyBigOp(op, std2.NewBigInt(leftInt), std2.NewBigInt(rightInt))
+		}
+		return &std2.CometInt{Value: r}
 	case lexer2.Mul:
-		return &std2.CometInt{Value: leftInt.Value * rightInt.Value}
+		r := a * b
+		if a != 0 && (r/a != b || (a == -1 && b == math.MinInt64)) {
+			return applyBigOp(op, std2.NewBigInt(leftInt), std2.NewBigInt(rightInt))
+		}
+		return &std2.CometInt{Value: r}
 	case lexer2.Div:
-		return &std2.CometInt{Value: leftInt.Value / rightInt.Value}
+		if b == 0 {
+			return std2.CreateError("Division by zero")
+		}
+		if a == math.MinInt64 && b == -1 {
+			return applyBigOp(op, std2.NewBigInt(leftInt), std2.NewBigInt(rightInt))
+		}
+		return &std2.CometInt{Value: a / b}
+	case lexer2.Mod:
+		if b == 0 {
+			return std2.CreateError("Division by zero")
+		}
+		return &std2.CometInt{Value: a % b}
+	case lexer2.LSHIFT:
+		if b < 0 {
+			return std2.CreateError("Negative shift count %d", b)
+		}
+		if b >= 63 || (a<<uint(b))>>uint(b) != a {
+			return applyBigOp(op, std2.NewBigInt(leftInt), std2.NewBigInt(rightInt))
+		}
+		return &std2.CometInt{Value: a << uint(b)}
+	case lexer2.RSHIFT:
+		if b < 0 {
+			return std2.CreateError("Negative shift count %d", b)
+		}
+		return &std2.CometInt{Value: a >> uint(b)}
 	case lexer2.EQ:
 		return boolValue(leftInt.Value == rightInt.Value)
 	case lexer2.NEQ:
@@ -574,6 +1331,101 @@ func applyOp(op lexer2.TokenType, left std2.CometObject, right std2.CometObject)
 	}
 }
 
+// applyBigOp applies the operator on two CometBigInt operands.
+// Results of arithmetic operations that fit in an int64 are demoted to CometInt values, so that
+// (9223372036854775807 + 1) - 1 is the CometInt it started from.
+func applyBigOp(op lexer2.TokenType, left *std2.CometBigInt, right *std2.CometBigInt) std2.CometObject {
+	switch op {
+	case lexer2.Plus:
+		return bigIntResult(new(big.Int).Add(left.Value, right.Value))
+	case lexer2.Minus:
+		return bigIntResult(new(big.Int).Sub(left.Value, right.Value))
+	case lexer2.Mul:
+		return bigIntResult(new(big.Int).Mul(left.Value, right.Value))
+	case lexer2.Div:
+		if right.Value.Sign() == 0 {
+			return std2.CreateError("Division by zero")
+		}
+		// Quo truncates towards zero, which is consistent with CometInt division.
+		return bigIntResult(new(big.Int).Quo(left.Value, right.Value))
+	case lexer2.Mod:
+		if right.Value.Sign() == 0 {
+			return std2.CreateError("Division by zero")
+		}
+		return bigIntResult(new(big.Int).Rem(left.Value, right.Value))
+	case lexer2.LSHIFT, lexer2.RSHIFT:
+		if right.Value.Sign() < 0 {
+			return std2.CreateError("Negative shift count %s", right.Value.String())
+		}
+		if !right.Value.IsInt64() || right.Value.Int64() > math.MaxInt32 {
+			return std2.CreateError("Shift count %s is too large", right.Value.String())
+		}
+		if op == lexer2.LSHIFT {
+			return bigIntResult(new(big.Int).Lsh(left.Value, uint(right.Value.Int64())))
+		}
+		return bigIntResult(new(big.Int).Rsh(left.Value, uint(right.Value.Int64())))
+	case lexer2.EQ:
+		return boolValue(left.Value.Cmp(right.Value) == 0)
+	case lexer2.NEQ:
+		return boolValue(left.Value.Cmp(right.Value) != 0)
+	case lexer2.LTE:
+		return boolValue(left.Value.Cmp(right.Value) <= 0)
+	case lexer2.LT:
+		return boolValue(left.Value.Cmp(right.Value) < 0)
+	case lexer2.GTE:
+		return boolValue(left.Value.Cmp(right.Value) >= 0)
+	case lexer2.GT:
+		return boolValue(left.Value.Cmp(right.Value) > 0)
+	default:
+		return std2.CreateError("Cannot apply operator %s on bigint operands", op)
+	}
+}
+
+// bigIntResult returns the result of a bigint operation, as a CometInt if it fits in an int64.
+func bigIntResult(value *big.Int) std2.CometObject {
+	if value.IsInt64() {
+		return &std2.CometInt{Value: value.Int64()}
+	}
+	return &std2.CometBigInt{Value: value}
+}
+
+// applyFloatOp applies the operator on two float operands, like the integer operators dividing by
+// zero is an error.
+func applyFloatOp(op lexer2.TokenType, a float64, b float64) std2.CometObject {
+	switch op {
+	case lexer2.Plus:
+		return &std2.CometFloat{Value: a + b}
+	case lexer2.Minus:
+		return &std2.CometFloat{Value: a - b}
+	case lexer2.Mul:
+		return &std2.CometFloat{Value: a * b}
+	case lexer2.Div:
+		if b == 0 {
+			return std2.CreateError("Division by zero")
+		}
+		return &std2.CometFloat{Value: a / b}
+	case lexer2.Mod:
+		if b == 0 {
+			return std2.CreateError("Division by zero")
+		}
+		return &std2.CometFloat{Value: math.Mod(a, b)}
+	case lexer2.EQ:
+		return boolValue(a == b)
+	case lexer2.NEQ:
+		return boolValue(a != b)
+	case lexer2.LTE:
+		return boolValue(a <= b)
+	case lexer2.LT:
+		return boolValue(a < b)
+	case lexer2.GTE:
+		return boolValue(a >= b)
+	case lexer2.GT:
+		return boolValue(a > b)
+	default:
+		return std2.CreateError("Cannot apply operator %s on float operands", op)
+	}
+}
+
 func applyStrOp(op lexer2.TokenType, left std2.CometObject, right std2.CometObject) std2.CometObject {
 	leftStr := left.(*std2.CometStr)
 	rightStr := right.(*std2.CometStr)
@@ -584,6 +1436,10 @@ func applyStrOp(op lexer2.TokenType, left std2.CometObject, right std2.CometObje
 		sb.WriteString(leftStr.Value)
 		sb.WriteString(rightStr.Value)
 		return &std2.CometStr{Value: sb.String(), Size: leftStr.Size + rightStr.Size}
+	case lexer2.EQ:
+		return boolValue(leftStr.Value == rightStr.Value)
+	case lexer2.NEQ:
+		return boolValue(leftStr.Value != rightStr.Value)
 	default:
 		return std2.CreateError("Cannot execute binary operator '%s' on strings", op)
 	}
@@ -609,6 +1465,39 @@ func boolValue(condition bool) *std2.CometBool {
 	return std2.FalseObject
 }
 
+func isInteger(obj std2.CometObject) bool {
+	return obj.Type() == std2.IntType || obj.Type() == std2.BigIntType
+}
+
+func isNumber(obj std2.CometObject) bool {
+	return isInteger(obj) || obj.Type() == std2.FloatType
+}
+
+// toFloat converts a number to a float64, big integers are rounded to the nearest float.
+func toFloat(obj std2.CometObject) float64 {
+	switch n := obj.(type) {
+	case *std2.CometInt:
+		return float64(n.Value)
+	case *std2.CometBigInt:
+		value, _ := new(big.Float).SetInt(n.Value).Float64()
+		return value
+	default:
+		return obj.(*std2.CometFloat).Value
+	}
+}
+
+// toBigInt converts an integer object (CometInt or CometBigInt) to a CometBigInt.
+func toBigInt(obj std2.CometObject) *std2.CometBigInt {
+	if obj.Type() == std2.IntType {
+		return std2.NewBigInt(obj.(*std2.CometInt))
+	}
+	return obj.(*std2.CometBigInt)
+}
+
+func newStr(value string) *std2.CometStr {
+	return &std2.CometStr{Value: value, Size: len(value)}
+}
+
 func isError(obj std2.CometObject) bool {
 	return obj.Type() == std2.ErrorType
 }
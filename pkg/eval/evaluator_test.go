@@ -1,11 +1,16 @@
 package eval
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	parser2 "github.com/chermehdi/comet/pkg/parser"
 	std2 "github.com/chermehdi/comet/pkg/std"
 	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -222,6 +227,21 @@ func TestEvaluator_Eval_Errors(t *testing.T) {
 			"-false",
 			"Cannot apply operator (-) on none INTEGER type BOOLEAN",
 		},
+	}
+
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		rootNode := parseOrDie(test.Src)
+		v := evaluator.Eval(rootNode)
+		assertError(t, v, test.ExpectedErrorMsg)
+	}
+}
+
+func TestEvaluator_Eval_StrictModeErrors(t *testing.T) {
+	tests := []struct {
+		Src              string
+		ExpectedErrorMsg string
+	}{
 		{
 			"!1",
 			"Cannot apply operator (!) on none BOOLEAN type INTEGER",
@@ -235,9 +255,22 @@ func TestEvaluator_Eval_Errors(t *testing.T) {
 				`,
 			"Cannot apply operator (!) on none BOOLEAN type INTEGER",
 		},
+		{
+			`if 1 { 2 }`,
+			"Test part of the if statement should evaluate to CometBool, evaluated to CometInt(1) instead",
+		},
+		{
+			`true && 1`,
+			"Cannot apply operator (&&) on none BOOLEAN type INTEGER",
+		},
+		{
+			`nil || true`,
+			"Cannot apply operator (||) on none BOOLEAN type NIL",
+		},
 	}
 
 	evaluator := NewEvaluator()
+	evaluator.Strict = true
 	for _, test := range tests {
 		rootNode := parseOrDie(test.Src)
 		v := evaluator.Eval(rootNode)
@@ -245,6 +278,42 @@ func TestEvaluator_Eval_Errors(t *testing.T) {
 	}
 }
 
+func TestEvaluator_Eval_Truthiness(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected bool
+	}{
+		{"!0", true},
+		{"!1", false},
+		{`!""`, true},
+		{`!"a"`, false},
+		{"![]", true},
+		{"![0]", false},
+		{"!nil", true},
+		{"!bigint(0)", true},
+		{"bool(42)", true},
+		{`bool("")`, false},
+		{"if 0 { true } else { false }", false},
+		{`if "comet" { true } else { false }`, true},
+		{"if nil { true } else { false }", false},
+		{"true && false", false},
+		{"true || false", true},
+		{"1 && 2", true},
+		{`0 || ""`, false},
+		{"1 < 2 && 2 < 3", true},
+		{"!false && true", true},
+		{"false && undefinedName", false},
+		{"true || undefinedName", true},
+	}
+
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		rootNode := parseOrDie(test.Src)
+		v := evaluator.Eval(rootNode)
+		assertBoolean(t, v, test.Expected)
+	}
+}
+
 func TestEvaluator_Eval_Declarations(t *testing.T) {
 	tests := []struct {
 		Src        string
@@ -419,6 +488,10 @@ func TestEvaluator_Eval_StringOperations(t *testing.T) {
 		evaluator.Eval(rootNode)
 		test.AssertFunc(evaluator)
 	}
+
+	// The repetitions are checked before allocating the result.
+	assertError(t, NewEvaluator().Eval(parseOrDie(`"ab" * 9223372036854775807`)), "Cannot repeat a string of 2 bytes 9223372036854775807 times, the result is too large")
+	assertError(t, NewEvaluator().Eval(parseOrDie(`-1 * "ab"`)), "Cannot repeat a string a negative number of times, got -1")
 }
 
 func TestEvaluator_Eval_FunctionDeclarationTest(t *testing.T) {
@@ -539,6 +612,620 @@ func TestEvaluator_Eval_EvaluateForStatement(t *testing.T) {
 	}
 }
 
+func TestEvaluator_Eval_EvaluateLoops(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{
+			Name: "While",
+			Src: `
+				var a = 0
+				while a < 10 {
+					a = a + 3
+				}
+				a
+			`,
+			Expected: 12,
+		},
+		{
+			Name: "ForClause",
+			Src: `
+				var sum = 0
+				for var i = 1; i < 10; i = i + 1 {
+					sum = sum + i
+				}
+				sum
+			`,
+			Expected: 45,
+		},
+		{
+			Name: "ForClauseWithoutVar",
+			Src: `
+				var sum = 0
+				for i = 1; i <= 4; i = i + 1 {
+					sum = sum + i
+				}
+				sum
+			`,
+			Expected: 10,
+		},
+		{
+			Name: "Break",
+			Src: `
+				var a = 0
+				for ;; {
+					a = a + 1
+					if a == 5 {
+						break
+					}
+				}
+				a
+			`,
+			Expected: 5,
+		},
+		{
+			Name: "Continue",
+			Src: `
+				var sum = 0
+				for i in 1..10 {
+					if i / 2 * 2 == i {
+						continue
+					}
+					sum = sum + i
+				}
+				sum
+			`,
+			Expected: 25,
+		},
+		{
+			Name: "BreakInnerLoopOnly",
+			Src: `
+				var count = 0
+				for i in 1..3 {
+					while true {
+						count = count + 1
+						break
+					}
+				}
+				count
+			`,
+			Expected: 3,
+		},
+		{
+			Name: "ReturnFromLoop",
+			Src: `
+				func find() {
+					for var i = 0; i < 100; i = i + 1 {
+						if i * i > 50 {
+							return i
+						}
+					}
+					return -1
+				}
+				find()
+			`,
+			Expected: 8,
+		},
+		{
+			Name: "PerIterationScope",
+			Src: `
+				var total = 0
+				for var i = 0; i < 3; i = i + 1 {
+					var local = i
+					total = total + local
+				}
+				total
+			`,
+			Expected: 3,
+		},
+		{
+			Name: "ArrayIteration",
+			Src: `
+				var sum = 0
+				for i, v in [10, 20, 30] {
+					sum = sum + i * v
+				}
+				sum
+			`,
+			Expected: 80,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			rootNode := parseOrDie(test.Src)
+			assertInteger(t, evaluator.Eval(rootNode), test.Expected)
+		})
+	}
+}
+
+func TestEvaluator_Eval_LoopVariablesDontLeak(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.Eval(parseOrDie(`
+		for var i = 0; i < 3; i = i + 1 {
+			var inner = i
+		}
+		while false {}
+	`))
+	_, found := evaluator.Scope.Lookup("i")
+	assert.False(t, found)
+	_, found = evaluator.Scope.Lookup("inner")
+	assert.False(t, found)
+}
+
+func TestEvaluator_Eval_CompoundAssignment(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{"PlusAssign", "var a = 1\n a += 2\n a", 3},
+		{"MinusAssign", "var a = 1\n a -= 2\n a", -1},
+		{"MulAssign", "var a = 3\n a *= 4\n a", 12},
+		{"DivAssign", "var a = 12\n a /= 4\n a", 3},
+		{"ModAssign", "var a = 14\n a %= 4\n a", 2},
+		{"LShiftAssign", "var a = 1\n a <<= 4\n a", 16},
+		{"RShiftAssign", "var a = 16\n a >>= 2\n a", 4},
+		{"Increment", "var a = 1\n a++\n a", 2},
+		{"Decrement", "var a = 1\n a--\n a", 0},
+		{"AssignmentValue", "var a = 1\n a += 41", 42},
+		{"IndexAssign", "var a = [1, 2]\n a[1] = 5\n a[1]", 5},
+		{"IndexCompoundAssign", "var a = [1, 2]\n a[1] *= 5\n a[1]", 10},
+		{"IndexIncrement", "var a = [[1], [2]]\n a[1][0]++\n a[1][0]", 3},
+		{
+			Name: "FieldCompoundAssign",
+			Src: `
+				struct A { func init() { this.count = 1 } }
+				var a = new A()
+				a.count += 10
+				a.count++
+				a.count
+			`,
+			Expected: 12,
+		},
+		{
+			Name: "FieldIndexAssign",
+			Src: `
+				struct A { func init() { this.items = [1, 2, 3] } }
+				var a = new A()
+				a.items[2] -= 3
+				a.items[2]
+			`,
+			Expected: 0,
+		},
+		{
+			Name: "ForClauseIncrement",
+			Src: `
+				var sum = 0
+				for i = 1; i < 10; i += 1 {
+					sum += i
+				}
+				sum
+			`,
+			Expected: 45,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			rootNode := parseOrDie(test.Src)
+			assertInteger(t, evaluator.Eval(rootNode), test.Expected)
+		})
+	}
+}
+
+func TestEvaluator_Eval_ElseIfAndSwitch(t *testing.T) {
+	classify := `
+		func classify(n) {
+			if n < 0 {
+				return "negative"
+			} else if n == 0 {
+				return "zero"
+			} else if n < 10 {
+				return "small"
+			} else {
+				return "large"
+			}
+		}
+	`
+	grade := `
+		func grade(n) {
+			var result = ""
+			switch n {
+				case 0 { result = "none" }
+				case 1, 2, 3 { result = "few" }
+				case 4..9 { result = "some" }
+				default { result = "many" }
+			}
+			return result
+		}
+	`
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected string
+	}{
+		{"ElseIfNegative", classify + "classify(-5)", "negative"},
+		{"ElseIfZero", classify + "classify(0)", "zero"},
+		{"ElseIfSmall", classify + "classify(3)", "small"},
+		{"ElseIfLarge", classify + "classify(30)", "large"},
+		{"SwitchLiteral", grade + "grade(0)", "none"},
+		{"SwitchAlternatives", grade + "grade(2)", "few"},
+		{"SwitchRange", grade + "grade(9)", "some"},
+		{"SwitchDefault", grade + "grade(10)", "many"},
+		{
+			Name: "SwitchStrings",
+			Src: `
+				var result = ""
+				switch "b" + "ar" {
+					case "foo" { result = "first" }
+					case "bar" { result = "second" }
+				}
+				result
+			`,
+			Expected: "second",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertStr(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		})
+	}
+}
+
+func TestEvaluator_Eval_SwitchControlFlow(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{
+			Name: "NoFallthrough",
+			Src: `
+				var count = 0
+				switch 1 {
+					case 1 { count += 1 }
+					case 1 { count += 10 }
+					default { count += 100 }
+				}
+				count
+			`,
+			Expected: 1,
+		},
+		{
+			Name: "NoMatchWithoutDefault",
+			Src: `
+				var count = 0
+				switch 5 { case 1 { count = 1 } }
+				count
+			`,
+			Expected: 0,
+		},
+		{
+			Name: "SubjectEvaluatedOnce",
+			Src: `
+				var calls = 0
+				func next() {
+					calls += 1
+					return calls
+				}
+				switch next() { case 5 { } case 6 { } }
+				calls
+			`,
+			Expected: 1,
+		},
+		{
+			Name: "BreakFromEnclosingLoop",
+			Src: `
+				var sum = 0
+				for i in 0..10 {
+					switch i {
+						case 3 { continue }
+						case 5 { break }
+					}
+					sum += i
+				}
+				sum
+			`,
+			Expected: 7,
+		},
+		{
+			Name: "ReturnFromSwitch",
+			Src: `
+				func f(n) {
+					switch n { case 1 { return 10 } }
+					return 20
+				}
+				f(1) + f(2)
+			`,
+			Expected: 30,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		})
+	}
+}
+
+func TestEvaluator_Eval_MatchExpression(t *testing.T) {
+	describe := `
+		struct Point {
+			func init(x, y) {
+				this.x = x
+				this.y = y
+			}
+		}
+		struct Person {
+			func init(name) { this.name = name }
+		}
+		func describe(v) {
+			return match v {
+				[] => "empty",
+				[a] => "single " + a,
+				[a, b, ...rest] => {
+					var total = a + b
+					for _, r in rest { total += r }
+					"sum " + total
+				}
+				Point(0, y) => "vertical " + y,
+				Point(x, y) => "point " + x + " " + y,
+				{name: "root"} => "admin",
+				{name: n} => "named " + n,
+				1..9 => "digit",
+				"hello" => "greeting",
+				nil => "nothing",
+				_ => "unknown"
+			}
+		}
+	`
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected string
+	}{
+		{"EmptyArray", "describe([])", "empty"},
+		{"SingleElement", "describe([1])", "single 1"},
+		{"RestElements", "describe([1, 2, 3, 4])", "sum 10"},
+		{"EmptyRest", "describe([1, 2])", "sum 3"},
+		{"StructLiteralField", "describe(new Point(0, 5))", "vertical 5"},
+		{"StructBindings", "describe(new Point(1, 2))", "point 1 2"},
+		{"ObjectLiteralField", `describe(new Person("root"))`, "admin"},
+		{"ObjectBinding", `describe(new Person("ann"))`, "named ann"},
+		{"Range", "describe(7)", "digit"},
+		{"String", `describe("hello")`, "greeting"},
+		{"Nil", "describe(nil)", "nothing"},
+		{"Wildcard", "describe(true)", "unknown"},
+		{"WildcardOutOfRange", "describe(10)", "unknown"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertStr(t, evaluator.Eval(parseOrDie(describe+test.Src)), test.Expected)
+		})
+	}
+}
+
+func TestEvaluator_Eval_MatchBindings(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{
+			Name:     "ArmBindingsDontLeak",
+			Src:      "var a = 1\n var b = match [5] { [a] => a }\n a + b",
+			Expected: 6,
+		},
+		{
+			Name:     "NestedArrays",
+			Src:      "match [[1, 2], [3]] { [[a, b], [c]] => a * 100 + b * 10 + c }",
+			Expected: 123,
+		},
+		{
+			Name:     "NestedRest",
+			Src:      "match [1, 2, 3] { [_, ...[b, c]] => b + c }",
+			Expected: 5,
+		},
+		{
+			Name:     "FirstMatchingArm",
+			Src:      "match 3 { x => 1, 3 => 2 }",
+			Expected: 1,
+		},
+		{
+			Name:     "EmptyBodyYieldsNil",
+			Src:      "var a = match 1 { _ => {} }\n a ?? 42",
+			Expected: 42,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		})
+	}
+	v := NewEvaluator().Eval(parseOrDie("match 1 { [a] => a, 2 => 2 }"))
+	assertError(t, v, "No pattern matched the value CometInt(1)")
+	v = NewEvaluator().Eval(parseOrDie("match 1 { Unknown(a) => a }"))
+	assertError(t, v, "Type 'Unknown' not found")
+	v = NewEvaluator().Eval(parseOrDie("struct A { func init(a) {} }\n match 1 { A(a, b) => a }"))
+	assertError(t, v, "Pattern A(a, b) expects 2 fields, the constructor of 'A' has 1 parameters")
+}
+
+func TestEvaluator_Eval_Destructuring(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{"Array", "var [a, b] = [1, 2]\n a * 10 + b", 12},
+		{"ArrayRest", "var [a, ...rest] = [1, 2, 3]\n rest[1]", 3},
+		{"Wildcard", "var [_, b] = [1, 2]\n b", 2},
+		{
+			Name: "Object",
+			Src: `
+				struct Point { func init(x, y) {
+					this.x = x
+					this.y = y
+				} }
+				var {x, y: py} = new Point(3, 4)
+				x * 10 + py
+			`,
+			Expected: 34,
+		},
+		{
+			Name: "Struct",
+			Src: `
+				struct Point { func init(x, y) {
+					this.x = x
+					this.y = y
+				} }
+				var Point(a, b) = new Point(5, 6)
+				a * b
+			`,
+			Expected: 30,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		})
+	}
+
+	evaluator := NewEvaluator()
+	v := evaluator.Eval(parseOrDie("var [a, b] = [1, 2, 3]"))
+	assertError(t, v, "Cannot destructure [CometInt(1), CometInt(2), CometInt(3)] with the pattern [a, b]")
+	// Nothing is declared when the pattern does not match.
+	_, found := evaluator.Scope.Lookup("a")
+	assert.False(t, found)
+	v = evaluator.Eval(parseOrDie("var {x} = 1"))
+	assertError(t, v, "Cannot destructure CometInt(1) with the pattern {x: x}")
+}
+
+func TestEvaluator_Eval_ConditionalExpressions(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{"TernaryThen", "true ? 1 : 2", 1},
+		{"TernaryElse", "1 > 2 ? 1 : 2", 2},
+		{"TernaryTruthiness", "var a = []\n a ? 1 : 2", 2},
+		{"TernaryChain", "var n = 15\n n < 10 ? 1 : n < 20 ? 2 : 3", 2},
+		{"TernaryNestedThen", "true ? false ? 1 : 2 : 3", 2},
+		{"TernaryInArithmetic", "1 + (true ? 10 : 20)", 11},
+		{"TernaryOnlyEvaluatesSelectedBranch", "true ? 1 : undefinedVariable", 1},
+		{"TernaryAssignment", "var a = 0\n a = a == 0 ? 5 : 6\n a", 5},
+		{"IfExpressionThen", "var a = if 1 < 2 { 10 } else { 20 }\n a", 10},
+		{"IfExpressionElse", "var a = if 1 > 2 { 10 } else { 20 }\n a", 20},
+		{"IfExpressionLastValue", "var a = if true { var b = 2\n b * 21 }\n a", 42},
+		{"IfExpressionElseIf", "var a = if false { 1 } else if true { 2 } else { 3 }\n a", 2},
+		{"IfExpressionEmptyBranch", "var a = if false { 1 }\n a ?? 7", 7},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		})
+	}
+
+	evaluator := NewEvaluator()
+	evaluator.Strict = true
+	v := evaluator.Eval(parseOrDie("1 ? 2 : 3"))
+	assertError(t, v, "Test part of the conditional expression should evaluate to CometBool, evaluated to CometInt(1) instead")
+}
+
+func TestEvaluator_Eval_Constants(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Src      string
+		Expected int64
+	}{
+		{"Declaration", "const a = 42\n a", 42},
+		{"BoundObjectIsMutable", "const a = [1]\n a[0] = 5\n a[0]", 5},
+		{"FunctionScope", "func f(x) {\n const y = x * 2\n return y\n }\n f(1) + f(2)", 6},
+		{"LoopScope", "var s = 0\n for i in 0..2 {\n const d = i * 2\n s += d\n }\n s", 6},
+		{"ShadowingInFunction", "const a = 1\n func f() {\n var a = 2\n a = 3\n return a\n }\n f() + a", 4},
+		{"Destructuring", "const [a, b] = [1, 2]\n a + b", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		})
+	}
+
+	// Sources evaluated separately (e.g. from the REPL) are checked at runtime.
+	evaluator := NewEvaluator()
+	evaluator.Eval(parseOrDie("const a = 1\n const [b] = [2]\n var c = 3"))
+	assertError(t, evaluator.Eval(parseOrDie("a = 2")), "Cannot assign to constant 'a'")
+	assertError(t, evaluator.Eval(parseOrDie("a++")), "Cannot assign to constant 'a'")
+	assertError(t, evaluator.Eval(parseOrDie("b += 1")), "Cannot assign to constant 'b'")
+	assertError(t, evaluator.Eval(parseOrDie("var a = 2")), "Cannot redeclare constant 'a'")
+	assertError(t, evaluator.Eval(parseOrDie("const a = 2")), "Cannot redeclare constant 'a'")
+	assertError(t, evaluator.Eval(parseOrDie("var [a] = [2]")), "Cannot redeclare constant 'a'")
+	assertError(t, evaluator.Eval(parseOrDie("func a() {}")), "Cannot redeclare constant 'a'")
+	assertError(t, evaluator.Eval(parseOrDie("func f() { a = 2 }\n f()")), "Cannot assign to constant 'a'")
+	assertInteger(t, evaluator.Eval(parseOrDie("a")), 1)
+	// Variables can be redeclared, and turned into constants.
+	assertInteger(t, evaluator.Eval(parseOrDie("var c = 4\n c")), 4)
+	assertInteger(t, evaluator.Eval(parseOrDie("const c = 5\n c")), 5)
+	assert.True(t, evaluator.Scope.IsConstant("c"))
+}
+
+func TestEvaluator_Eval_CompoundAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		Compound string
+		Expanded string
+	}{
+		{"var a = 1\n a += true", "var a = 1\n a = a + true"},
+		{"var a = true\n a -= 1", "var a = true\n a = a - 1"},
+		{"var a = \"s\"\n a *= \"s\"", "var a = \"s\"\n a = a * \"s\""},
+		{"var a = 1\n a /= 0", "var a = 1\n a = a / 0"},
+		{"var a = [true]\n a[0]++", "var a = [true]\n a[0] = a[0] + 1"},
+	}
+	for _, test := range tests {
+		compound := NewEvaluator().Eval(parseOrDie(test.Compound))
+		expanded := NewEvaluator().Eval(parseOrDie(test.Expanded))
+		expectedErr, ok := expanded.(*std2.CometError)
+		assert.True(t, ok)
+		assertError(t, compound, expectedErr.Message)
+	}
+	v := NewEvaluator().Eval(parseOrDie("b += 1"))
+	assertError(t, v, "Identifier (b) is not bounded to any value, have you tried declaring it?")
+	v = NewEvaluator().Eval(parseOrDie("var a = [1]\n a[3] = 1"))
+	assertError(t, v, "Array access out of bounds, array of length 1, index was: 3")
+	// The value can remove the assigned element.
+	v = NewEvaluator().Eval(parseOrDie("var a = [1]\n a[0] = pop(a)"))
+	assertError(t, v, "Array access out of bounds, array of length 0, index was: 0")
+	v = NewEvaluator().Eval(parseOrDie("var a = [1]\n a[0] += pop(a)"))
+	assertError(t, v, "Array access out of bounds, array of length 0, index was: 0")
+}
+
+func TestEvaluator_Eval_ModuloAndShifts(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected int64
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"1 << 10", 1024},
+		{"1024 >> 3", 128},
+		{"1 + 2 % 2", 1},
+	}
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+	}
+	assertBigInteger(t, evaluator.Eval(parseOrDie("1 << 64")), "18446744073709551616")
+	assertInteger(t, evaluator.Eval(parseOrDie("bigint(100) % 7")), 2)
+}
+
 func TestEvaluator_Eval_EvaluateArrayDeclaration(t *testing.T) {
 	tests := []struct {
 		Src        string
@@ -682,6 +1369,84 @@ func TestEvaluator_Eval_EvaluateArrayAccess(t *testing.T) {
 	}
 }
 
+func TestEvaluator_Eval_NegativeIndexAndStringIndex(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.Eval(parseOrDie(`var a = [1, 2, 3]
+		var s = "héllo"`))
+	assertInteger(t, evaluator.Eval(parseOrDie("a[-1]")), 3)
+	assertInteger(t, evaluator.Eval(parseOrDie("a[-3]")), 1)
+	assertStr(t, evaluator.Eval(parseOrDie("s[0]")), "h")
+	assertStr(t, evaluator.Eval(parseOrDie("s[1]")), "é")
+	assertStr(t, evaluator.Eval(parseOrDie("s[-1]")), "o")
+	assertInteger(t, evaluator.Eval(parseOrDie("a[-1] = 5\n a[2]")), 5)
+
+	assert.Equal(t, std2.NilObject, evaluator.Eval(parseOrDie("a[-4]")))
+	assert.Equal(t, std2.NilObject, evaluator.Eval(parseOrDie("a[3]")))
+	assertError(t, evaluator.Eval(parseOrDie("s[5]")), "String access out of bounds, string of length 5, index was: 5")
+	assertError(t, evaluator.Eval(parseOrDie("s[0] = \"a\"")), "Cannot assign to an index of a CometStr, strings are immutable")
+	assertError(t, evaluator.Eval(parseOrDie("1[0]")), "Expected CometArray or CometStr got INTEGER")
+	assertError(t, evaluator.Eval(parseOrDie("a[\"0\"]")), "Expected CometInt got STR")
+}
+
+func TestEvaluator_Eval_Slices(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected []int64
+	}{
+		{"a[1:3]", []int64{1, 2}},
+		{"a[:2]", []int64{0, 1}},
+		{"a[3:]", []int64{3, 4}},
+		{"a[:]", []int64{0, 1, 2, 3, 4}},
+		{"a[-2:]", []int64{3, 4}},
+		{"a[:-3]", []int64{0, 1}},
+		{"a[::2]", []int64{0, 2, 4}},
+		{"a[1::2]", []int64{1, 3}},
+		{"a[::-1]", []int64{4, 3, 2, 1, 0}},
+		{"a[3:0:-1]", []int64{3, 2, 1}},
+		{"a[-1:-3:-1]", []int64{4, 3}},
+		{"a[2:100]", []int64{2, 3, 4}},
+		{"a[-100:1]", []int64{0}},
+		{"a[3:1]", []int64{}},
+		{"a[nil:2]", []int64{0, 1}},
+		{"a[1:3][1:]", []int64{2}},
+	}
+	for _, test := range tests {
+		t.Run(test.Src, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			v := evaluator.Eval(parseOrDie("var a = [0, 1, 2, 3, 4]\n" + test.Src))
+			assertIntegers(t, v, test.Expected)
+		})
+	}
+
+	strTests := []struct {
+		Src      string
+		Expected string
+	}{
+		{`"comet"[2:]`, "met"},
+		{`"comet"[:-2]`, "com"},
+		{`"comet"[::-1]`, "temoc"},
+		{`"héllo"[1:3]`, "él"},
+		{`""[1:]`, ""},
+	}
+	for _, test := range strTests {
+		assertStr(t, NewEvaluator().Eval(parseOrDie(test.Src)), test.Expected)
+	}
+
+	// Slices are copies of the sliced array.
+	evaluator := NewEvaluator()
+	v := evaluator.Eval(parseOrDie(`
+		var a = [1, 2, 3]
+		var b = a[:]
+		b[0] = 10
+		a[0]
+	`))
+	assertInteger(t, v, 1)
+
+	assertError(t, NewEvaluator().Eval(parseOrDie("[1][::0]")), "Slice step cannot be zero")
+	assertError(t, NewEvaluator().Eval(parseOrDie("[1][true:]")), "Slice bounds should be CometInt got BOOLEAN")
+	assertError(t, NewEvaluator().Eval(parseOrDie("1[1:]")), "Cannot slice value of type INTEGER")
+}
+
 func TestEvaluator_Eval_EvaluateStructDeclaration(t *testing.T) {
 	tests := []struct {
 		Src        string
@@ -976,6 +1741,563 @@ func TestEvaluator_Eval_EvaluateFieldSetting(t *testing.T) {
 	}
 }
 
+func TestEvaluator_Eval_BigIntegers(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{
+			"9223372036854775808",
+			"9223372036854775808",
+		},
+		{
+			"9223372036854775807 + 1",
+			"9223372036854775808",
+		},
+		{
+			"(-9223372036854775807) - 2",
+			"-9223372036854775809",
+		},
+		{
+			"4294967296 * 4294967296",
+			"18446744073709551616",
+		},
+		{
+			"bigint(10) * 9223372036854775807",
+			"92233720368547758070",
+		},
+		{
+			`bigint("123456789012345678901234567890") / 10`,
+			"12345678901234567890123456789",
+		},
+		{
+			`
+				func fact(n) {
+					if n <= 1 {
+						return 1
+					}
+					return n * fact(n - 1)
+				}
+				fact(25)
+			`,
+			"15511210043330985984000000",
+		},
+	}
+
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		rootNode := parseOrDie(test.Src)
+		v := evaluator.Eval(rootNode)
+		assertBigInteger(t, v, test.Expected)
+	}
+}
+
+// The results of bigint operations that fit in an int64 are CometInt values.
+func TestEvaluator_Eval_BigIntegerDemotion(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected int64
+	}{
+		{"(9223372036854775807 + 1) - 1", 9223372036854775807},
+		{"(-9223372036854775807 - 2) + 2", -9223372036854775807},
+		{"(4294967296 * 4294967296) / 4294967296", 4294967296},
+		{"bigint(10) * 2", 20},
+		{"(1 << 64) >> 60", 16},
+		{"9223372036854775808 % 10", 8},
+		{"-(-9223372036854775807 - 1) - 1", 9223372036854775807},
+	}
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+	}
+}
+
+func TestEvaluator_Eval_BigIntegerComparisons(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected bool
+	}{
+		{"bigint(1) == 1", true},
+		{"1 == bigint(1)", true},
+		{"bigint(2) != 1", true},
+		{"9223372036854775808 > 9223372036854775807", true},
+		{"bigint(3) <= 2", false},
+	}
+
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		rootNode := parseOrDie(test.Src)
+		v := evaluator.Eval(rootNode)
+		assertBoolean(t, v, test.Expected)
+	}
+	v := evaluator.Eval(parseOrDie("toString(18446744073709551616)"))
+	assertStr(t, v, "18446744073709551616")
+}
+
+func TestEvaluator_Eval_BigIntegerErrors(t *testing.T) {
+	tests := []struct {
+		Src              string
+		ExpectedErrorMsg string
+	}{
+		{
+			"1 / 0",
+			"Division by zero",
+		},
+		{
+			"bigint(1) / 0",
+			"Division by zero",
+		},
+		{
+			`bigint("abc")`,
+			"Cannot convert 'abc' to a bigint",
+		},
+		{
+			"bigint(1) + true",
+			"Cannot apply operator + on given types BIGINT and BOOLEAN",
+		},
+	}
+
+	evaluator := NewEvaluator()
+	for _, test := range tests {
+		rootNode := parseOrDie(test.Src)
+		v := evaluator.Eval(rootNode)
+		assertError(t, v, test.ExpectedErrorMsg)
+	}
+}
+
+func TestEvaluator_Eval_Floats(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"1.5", "CometFloat(1.5)"},
+		{"1.5 + 1", "CometFloat(2.5)"},
+		{"3 / 2.0", "CometFloat(1.5)"},
+		{"2.5 * bigint(2)", "CometFloat(5)"},
+		{"7.5 % 2", "CometFloat(1.5)"},
+		{"-0.25 - 1", "CometFloat(-1.25)"},
+		{"1.5 > 1", "CometBool(true)"},
+		{"2.0 == 2", "CometBool(true)"},
+		{"0.1 + 0.2 == 0.3", "CometBool(false)"},
+		{`"x" + 1.5`, `CometStr("x1.5")`},
+		{"toString(0.5)", `CometStr("0.5")`},
+		{"var x = 1.0\n x += 0.5\n x", "CometFloat(1.5)"},
+		{"1.0 / 0", "Comet error: \n\n\tDivision by zero"},
+		{"1.5 % 0.0", "Comet error: \n\n\tDivision by zero"},
+		{"1.5 << 1", "Comet error: \n\n\tCannot apply operator << on float operands"},
+		{"1.5 + true", "Comet error: \n\n\tCannot apply operator + on given types FLOAT and BOOLEAN"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, NewEvaluator().Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+}
+
+func TestEvaluator_Eval_Nil(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Src        string
+		AssertFunc func(std2.CometObject)
+	}{
+		{
+			Name: "NilLiteral",
+			Src:  `nil`,
+			AssertFunc: func(v std2.CometObject) {
+				assert.Equal(t, std2.NilObject, v)
+			},
+		},
+		{
+			Name: "NilEquality",
+			Src:  `nil == nil`,
+			AssertFunc: func(v std2.CometObject) {
+				assertBoolean(t, v, true)
+			},
+		},
+		{
+			Name: "NilInequality",
+			Src:  `nil != 1`,
+			AssertFunc: func(v std2.CometObject) {
+				assertBoolean(t, v, true)
+			},
+		},
+		{
+			Name: "MissingField",
+			Src: `
+				struct A {}
+				var a = new A()
+				a.missing
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assert.Equal(t, std2.NilObject, v)
+			},
+		},
+		{
+			Name: "FunctionWithoutReturn",
+			Src: `
+				func a() { var b = 1 }
+				a()
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assert.Equal(t, std2.NilObject, v)
+			},
+		},
+		{
+			Name: "Coalesce",
+			Src:  `nil ?? 42`,
+			AssertFunc: func(v std2.CometObject) {
+				assertInteger(t, v, 42)
+			},
+		},
+		{
+			Name: "CoalesceShortCircuits",
+			Src:  `1 ?? undefinedName`,
+			AssertFunc: func(v std2.CometObject) {
+				assertInteger(t, v, 1)
+			},
+		},
+		{
+			Name: "SafeNavigation",
+			Src: `
+				struct A {}
+				var a = new A()
+				a.next?.value?.get() ?? 10
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assertInteger(t, v, 10)
+			},
+		},
+		{
+			Name: "SafeNavigationOnValue",
+			Src: `
+				struct A {}
+				var a = new A()
+				a.value = 3
+				a?.value
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assertInteger(t, v, 3)
+			},
+		},
+		{
+			Name: "SafeNavigationSkipsTheChain",
+			Src: `
+				var a = nil
+				a?.b.c.d()
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assert.Equal(t, std2.NilObject, v)
+			},
+		},
+		{
+			Name: "SafeNavigationInTheChain",
+			Src: `
+				struct A {}
+				var a = new A()
+				a.b?.c.d ?? a.e?.f
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assert.Equal(t, std2.NilObject, v)
+			},
+		},
+		{
+			Name: "SafeNavigationOnlySkipsNil",
+			Src: `
+				struct A {}
+				var a = new A()
+				a?.b.c
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assertError(t, v, "Cannot access field 'c' on none object type NIL")
+			},
+		},
+		{
+			Name: "ArrayHole",
+			Src: `
+				var a = [1, 2]
+				toString([a[2], a[-3], a[2] ?? 3])
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assertStr(t, v, "[nil, nil, 3]")
+			},
+		},
+		{
+			Name: "FieldAccessOnNil",
+			Src: `
+				var a = nil
+				a.value
+			`,
+			AssertFunc: func(v std2.CometObject) {
+				assertError(t, v, "Cannot access field 'value' on none object type NIL")
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			evaluator := NewEvaluator()
+			rootNode := parseOrDie(test.Src)
+			test.AssertFunc(evaluator.Eval(rootNode))
+		})
+	}
+}
+
+func TestEvaluator_Eval_MaxCallDepth(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.MaxCallDepth = 50
+	src := "func f(n) {\n return 1 + f(n + 1)\n }\n f(0)"
+	trace := "maximum recursion depth exceeded (50 nested calls)\nTraceback (most recent call last):\n\t  ... 41 more calls" +
+		strings.Repeat("\n\t  f (line 2, column 13)", 10)
+	assertError(t, evaluator.Eval(parseOrDie(src)), trace)
+	// The evaluator can still be used after the error.
+	assert.Empty(t, evaluator.frames)
+	assertInteger(t, evaluator.Eval(parseOrDie("func g(n) {\n if n == 0 { return 0 }\n return 1 + g(n - 1)\n }\n g(49)")), 49)
+
+	// Deep recursions report an error instead of overflowing the stack.
+	err := NewEvaluator().Eval(parseOrDie("func f(n) {\n return 1 + f(n + 1)\n }\n f(0)"))
+	assert.True(t, isError(err))
+	assert.True(t, strings.HasPrefix(err.(*std2.CometError).Message, "maximum recursion depth exceeded (5000 nested calls)"))
+
+	// Methods and constructors are calls too.
+	evaluator = NewEvaluator()
+	evaluator.MaxCallDepth = 3
+	src = "struct A {\n func init() { this.x = new A() }\n }\n new A()"
+	assertError(t, evaluator.Eval(parseOrDie(src)), "maximum recursion depth exceeded (3 nested calls)\nTraceback (most recent call last):\n\t  A.init\n\t  A.init\n\t  A.init\n\t  A.init")
+}
+
+func TestEvaluator_Eval_TailCalls(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected int64
+	}{
+		{"func sum(n, acc) {\n if n == 0 { return acc }\n return sum(n - 1, acc + n)\n }\n sum(100000, 0)", 5000050000},
+		{"func even(n) {\n if n == 0 { return 1 }\n return odd(n - 1)\n }\n func odd(n) {\n if n == 0 { return 0 }\n return even(n - 1)\n }\n even(100001)", 0},
+		{"func count(n) {\n while true {\n if n == 0 { return 7 }\n return count(n - 1)\n }\n }\n count(50000)", 7},
+		// Functions declared inside the call see its variables, their calls are not tail calls.
+		{"func outer(n) {\n func helper() { return n * 2 }\n return helper()\n }\n outer(21)", 42},
+		{"struct A {\n func get(n) { return sum(n, 0) }\n }\n func sum(n, acc) {\n if n == 0 { return acc }\n return sum(n - 1, acc + 1)\n }\n new A().get(20000)", 20000},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		assertInteger(t, evaluator.Eval(parseOrDie(test.Src)), test.Expected)
+		assert.Empty(t, evaluator.frames)
+	}
+}
+
+func TestEvaluator_Eval_CallArguments(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"func f(a, b) { return a }\n f(1)", "Comet error: \n\n\tFunction 'f' expects 2 arguments, 1 were given"},
+		{"func f(a, b) { return a }\n func g() { return f(1) }\n g()", "Comet error: \n\n\tFunction 'f' expects 2 arguments, 1 were given"},
+		{"func f(a) { return 2 }\n f(1 / 0)", "Comet error: \n\n\tDivision by zero"},
+		{"func f(a) { return 2 }\n func g() { return f(1 / 0) }\n g()", "Comet error: \n\n\tDivision by zero"},
+		// The extra arguments are evaluated and ignored.
+		{"func f(a) { return a }\n func g() { return f(1, 2 / 0) }\n g()", "Comet error: \n\n\tDivision by zero"},
+		{"var a = [1]\n func f(x) { return x }\n func g() { return f(2, push(a, 3)) }\n g() + len(a)", "CometInt(4)"},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(test.Src)).ToString(), test.Src)
+		assert.Empty(t, evaluator.frames, test.Src)
+	}
+}
+
+func TestEvaluator_Eval_BuiltinSignatures(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"toString(1, 2)", "Builtin 'toString' expects 1 argument, got 2 (line 1, column 1)"},
+		{"println(1, 2)", "Builtin 'println' expects 0 or 1 arguments, got 2 (line 1, column 1)"},
+		{"printf()", "Builtin 'printf' expects at least 1 argument, got 0 (line 1, column 1)"},
+		{"printf(1)", "Argument 1 of builtin 'printf' expected to be STR, got INTEGER instead (line 1, column 1)"},
+		{`printf("%d", 1)`, "Builtin 'printf' expects 0 arguments for the format, got 1 (line 1, column 1)"},
+		{`printf("{")`, "Invalid format string, the '{' at offset 0 should be doubled (line 1, column 1)"},
+		{"var x = 1\n  bigint()", "Builtin 'bigint' expects 1 argument, got 0 (line 2, column 3)"},
+		// The errors of the arguments are returned before calling the builtin.
+		{"println(1 / 0)\n 2", "Division by zero"},
+		{"len(1 / 0)", "Division by zero"},
+		{"printf(\"{} {}\", 1, 1 / 0)", "Division by zero"},
+	}
+	for _, test := range tests {
+		assertError(t, NewEvaluator().Eval(parseOrDie(test.Src)), test.Expected)
+	}
+}
+
+func TestEvaluator_Eval_ArrayBuiltins(t *testing.T) {
+	// Expected is a program evaluating to the expected value.
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"len([1, 2, 3])", "3"},
+		{`len("héllo")`, "5"},
+		{"var a = [1]\n push(a, 2, 3)\n a", "[1, 2, 3]"},
+		{"var a = []\n push(a, 1)\n len(a)", "1"},
+		{"var a = [1, 2]\n var b = [pop(a), a]\n b", "[2, [1]]"},
+		{"func double(x) { return x * 2 }\n map([1, 2, 3], double)", "[2, 4, 6]"},
+		{"func withIndex(x, i) { return x + i }\n map([10, 10], withIndex)", "[10, 11]"},
+		{"func isEven(x) { return x % 2 == 0 }\n filter(range(10), isEven)", "[0, 2, 4, 6, 8]"},
+		{"func add(a, b) { return a + b }\n reduce([1, 2, 3, 4], add)", "10"},
+		{"func add(a, b) { return a + b }\n reduce([], add, 0)", "0"},
+		{"func concat(acc, x, i) { return acc + toString(i) + x }\n reduce([\"a\", \"b\"], concat, \"\")", `"0a1b"`},
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, `["a", "b", "c"]`},
+		{"sort([bigint(5), 1, 3])", "[1, 3, bigint(5)]"},
+		{"var a = [2, 1]\n sort(a)\n a", "[2, 1]"},
+		{"func byFirst(a, b) { return a[0] < b[0] }\n sort([[2, \"a\"], [1, \"b\"], [2, \"c\"], [1, \"d\"]], byFirst)", `[[1, "b"], [1, "d"], [2, "a"], [2, "c"]]`},
+		{"func desc(a, b) { return a > b }\n sort([1, 3, 2], desc)", "[3, 2, 1]"},
+		{"reverse([1, 2, 3])", "[3, 2, 1]"},
+		{"reverse([])", "[]"},
+		{"contains([1, 2, 3], 2)", "true"},
+		{"contains([1, 2, 3], bigint(3))", "true"},
+		{`contains([1, 2, 3], "1")`, "false"},
+		{"contains([[1, 2], nil], [1, 2])", "true"},
+		{"contains([[1, 2], nil], nil)", "true"},
+		{"zip([1, 2, 3], [\"a\", \"b\"])", `[[1, "a"], [2, "b"]]`},
+		{"zip([1], [2], [3])", "[[1, 2, 3]]"},
+		{"range(3)", "[0, 1, 2]"},
+		{"range(2, 5)", "[2, 3, 4]"},
+		{"range(5, 0, 0 - 2)", "[5, 3, 1]"},
+		{"range(5, 0)", "[]"},
+		{"range(9223372036854775800, 9223372036854775807, 5)", "[9223372036854775800, 9223372036854775805]"},
+		{"range(0 - 9223372036854775800, 0 - 9223372036854775807, 0 - 5)", "[0 - 9223372036854775800, 0 - 9223372036854775805]"},
+		{"toString([1, [2.5, \"a\"], nil])", `"[1, [2.5, a], nil]"`},
+		{"var a = [1]\n push(a, a)\n toString(a)", `"[1, [...]]"`},
+		{"toString(println())", `"nil"`},
+		{"func f() {}\n toString([f, toString(f)])", `"[CometFunc, CometFunc]"`},
+		// The declarations of the program shadow the builtins.
+		{"func reverse(x) { return 42 }\n reverse([1])", "42"},
+		{"func contains(a, b) { return \"mine\" }\n contains([1], 1)", `"mine"`},
+		{"func twice(x) { return x * 2 }\n func apply(map) { return map(4) }\n apply(twice)", "8"},
+		{"var a = reverse([1, 2])\n func reverse(x) { return 0 }\n a", "[2, 1]"},
+	}
+	for _, test := range tests {
+		expected := NewEvaluator().Eval(parseOrDie(test.Expected))
+		assert.Equal(t, expected.ToString(), NewEvaluator().Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+
+	failures := []struct {
+		Src      string
+		Expected string
+	}{
+		{"len(1)", "Builtin 'len' expects an array or a string, got INTEGER (line 1, column 1)"},
+		{"pop([])", "Cannot pop an element from an empty array (line 1, column 1)"},
+		{"func add(a, b) { return a + b }\n reduce([], add)", "Cannot reduce an empty array without an initial value (line 2, column 2)"},
+		{`sort([1, "a"])`, "Cannot compare values of type STR and INTEGER, sort them with a callback instead (line 1, column 1)"},
+		{"zip([1], 2)", "Argument 2 of builtin 'zip' expected to be ARRAY, got INTEGER instead (line 1, column 1)"},
+		{"range(0, 5, 0)", "The step of a range can't be 0 (line 1, column 1)"},
+		{"func fail(x) { return x / 0 }\n map([1], fail)", "Division by zero"},
+		{"func fail(x) { return x / 0 }\n filter([1], fail)", "Division by zero"},
+		{"func fail(a, b) { return a / 0 }\n reduce([1, 2], fail)", "Division by zero"},
+		{"func fail(a, b) { return a / 0 }\n sort([1, 2], fail)", "Division by zero"},
+		{"map([1], 2)", "Cannot invoke none callable object of type INTEGER"},
+		{"var len = 3\n len([1])", "Cannot invoke none callable object of type INTEGER"},
+	}
+	for _, test := range failures {
+		assertError(t, NewEvaluator().Eval(parseOrDie(test.Src)), test.Expected)
+	}
+}
+
+func TestEvaluator_Eval_Output(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{`println("hello")`, "hello\n"},
+		{`println(1 + 2)`, "3\n"},
+		{`printf("{}-{}", 1, "a")`, "1-a"},
+		{`printf("{{{}}}: {}", [1, "a"], nil)`, `{[1, a]}: nil`},
+		{"func greet(name) { println(\"hi \" + name) }\n greet(\"bob\")\n greet(\"alice\")", "hi bob\nhi alice\n"},
+	}
+	for _, test := range tests {
+		var stdout bytes.Buffer
+		evaluator := NewEvaluator()
+		evaluator.Stdout = &stdout
+		evaluator.Eval(parseOrDie(test.Src))
+		assert.Equal(t, test.Expected, stdout.String(), test.Src)
+	}
+}
+
+func TestEvaluator_EvalContext_Cancellation(t *testing.T) {
+	tests := []string{
+		"for i in 1..1000000000 {}",
+		"var i = 0\n while true { i += 1 }",
+		"for var i = 0; true; i += 1 {}",
+		"func f() { return f() }\n f()",
+		"func f(n) { while true {} }\n println(f(1))",
+		"range(0, 10000000000)",
+	}
+	for _, src := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		evaluator := NewEvaluator()
+		result, err := evaluator.EvalContext(ctx, parseOrDie(src))
+		cancel()
+		var cancelled *CancelledError
+		assert.True(t, errors.As(err, &cancelled), src)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), src)
+		assertError(t, result, "evaluation cancelled: context deadline exceeded")
+		assert.Empty(t, evaluator.frames)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewEvaluator().EvalContext(ctx, parseOrDie("while true {}"))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestEvaluator_EvalContext_Limits(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.MaxSteps = 1000
+	result, err := evaluator.EvalContext(context.Background(), parseOrDie("var i = 0\n while true { i += 1 }"))
+	assert.Equal(t, &StepLimitError{Limit: 1000}, err)
+	assertError(t, result, "evaluation exceeded the limit of 1000 steps")
+	// Steps are counted per evaluation, and the evaluator can still be used.
+	result, err = evaluator.EvalContext(context.Background(), parseOrDie("i > 0"))
+	assert.NoError(t, err)
+	assertBoolean(t, result, true)
+
+	evaluator = NewEvaluator()
+	evaluator.MaxCallDepth = 10
+	_, err = evaluator.EvalContext(context.Background(), parseOrDie("func f(n) { return 1 + f(n) }\n f(0)"))
+	var depth *CallDepthError
+	if assert.True(t, errors.As(err, &depth)) {
+		assert.Equal(t, 10, depth.Limit)
+		assert.True(t, strings.HasPrefix(depth.Message, "maximum recursion depth exceeded (10 nested calls)"))
+	}
+
+	sizes := []struct {
+		Src  string
+		Size int64
+	}{
+		{`"ab" * 1000`, 2000},
+		{"var s = \"\"\n for i in 0..200 { s += \"x\" }", 101},
+		{"var s = \"x\"\n s *= 101", 101},
+		{"[" + strings.Repeat("1, ", 100) + "1]", 101},
+		{`"x" * 99 + 50`, 101},
+		{`true + "x" * 97`, 101},
+		{`"ab" * 9223372036854775807`, math.MaxInt64},
+		{"len(range(0, 100000))", 100000},
+		{"range(0, 9223372036854775807)", math.MaxInt64},
+		{"var a = []\n for i in 0..1000 { push(a, i) }", 101},
+		{"var a = range(100)\n push(a, 1, 2)", 102},
+	}
+	for _, test := range sizes {
+		evaluator = NewEvaluator()
+		evaluator.MaxCollectionSize = 100
+		_, err = evaluator.EvalContext(context.Background(), parseOrDie(test.Src))
+		assert.Equal(t, &CollectionSizeError{Limit: 100, Size: test.Size}, err, test.Src)
+	}
+
+	// Errors of the program are not reported as errors of the evaluation.
+	evaluator = NewEvaluator()
+	evaluator.MaxSteps, evaluator.MaxCollectionSize = 100, 100
+	result, err = evaluator.EvalContext(context.Background(), parseOrDie("1 / 0"))
+	assert.NoError(t, err)
+	assertError(t, result, "Division by zero")
+	// The limits of the collections only apply to EvalContext.
+	assertStr(t, evaluator.Eval(parseOrDie(`"a" * 200`)), strings.Repeat("a", 200))
+}
+
 func assertError(t *testing.T, v std2.CometObject, ExpectedErrorMsg string) {
 	err, ok := v.(*std2.CometError)
 	assert.True(t, ok)
@@ -994,6 +2316,25 @@ func assertInteger(t *testing.T, v std2.CometObject, expected int64) {
 	assert.Equal(t, expected, integer.Value)
 }
 
+func assertBigInteger(t *testing.T, v std2.CometObject, expected string) {
+	integer, ok := v.(*std2.CometBigInt)
+	assert.True(t, ok)
+	assert.Equal(t, expected, integer.Value.String())
+}
+
+func assertIntegers(t *testing.T, v std2.CometObject, expected []int64) {
+	array, ok := v.(*std2.CometArray)
+	assert.True(t, ok, "expected CometArray got %s", v.ToString())
+	assert.Equal(t, len(expected), array.Length)
+	values := make([]int64, 0, len(array.Values))
+	for _, value := range array.Values {
+		integer, ok := value.(*std2.CometInt)
+		assert.True(t, ok)
+		values = append(values, integer.Value)
+	}
+	assert.Equal(t, expected, values)
+}
+
 func assertStr(t *testing.T, v std2.CometObject, expected string) {
 	str, ok := v.(*std2.CometStr)
 	assert.True(t, ok)
@@ -0,0 +1,181 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	lexer2 "github.com/chermehdi/comet/pkg/lexer"
+	parser2 "github.com/chermehdi/comet/pkg/parser"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"math"
+)
+
+// CancelledError is returned by EvalContext when the context is done before the end of the evaluation.
+type CancelledError struct {
+	Err error
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("evaluation cancelled: %s", e.Err)
+}
+
+// Unwrap returns the error of the context (context.Canceled or context.DeadlineExceeded).
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
+// StepLimitError is returned by EvalContext when the evaluation needs more than MaxSteps steps.
+type StepLimitError struct {
+	Limit int64
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the limit of %d steps", e.Limit)
+}
+
+// CallDepthError is returned by EvalContext when the calls are nested deeper than MaxCallDepth.
+type CallDepthError struct {
+	Limit int
+	// Message describes the calls being evaluated when the limit was exceeded.
+	Message string
+}
+
+func (e *CallDepthError) Error() string {
+	return e.Message
+}
+
+// CollectionSizeError is returned by EvalContext when the evaluation creates an array or a string
+// larger than MaxCollectionSize.
+type CollectionSizeError struct {
+	Limit int
+	Size  int64
+}
+
+func (e *CollectionSizeError) Error() string {
+	return fmt.Sprintf("collection of size %d exceeds the limit of %d", e.Size, e.Limit)
+}
+
+// EvalContext evaluates the node like Eval, but stops the evaluation when ctx is done or when a
+// limit of the evaluator (MaxSteps, MaxCallDepth, MaxCollectionSize) is exceeded. The context is
+// checked at every loop iteration and every call.
+// The returned error is non nil only if the evaluation was stopped, it is one of CancelledError,
+// StepLimitError, CallDepthError or CollectionSizeError. The errors of the program itself are
+// returned as CometError values, like Eval does.
+func (ev *Evaluator) EvalContext(ctx context.Context, node parser2.Node) (std2.CometObject, error) {
+	ev.ctx, ev.steps, ev.interrupt = ctx, 0, nil
+	defer func() {
+		ev.ctx, ev.interrupt = nil, nil
+	}()
+	result := ev.Eval(node)
+	if ev.interrupt != nil {
+		return std2.CreateError("%s", ev.interrupt), ev.interrupt
+	}
+	return result, nil
+}
+
+// stop interrupts the evaluation started by EvalContext with the given error. Once interrupted,
+// every node evaluates to an error so that the evaluation unwinds even where errors are ignored.
+func (ev *Evaluator) stop(err error) std2.CometObject {
+	if ev.interrupt == nil {
+		ev.interrupt = err
+	}
+	return std2.CreateError("%s", ev.interrupt)
+}
+
+// interrupted returns a non nil error if the evaluation was stopped.
+func (ev *Evaluator) interrupted() std2.CometObject {
+	if ev.interrupt == nil {
+		return nil
+	}
+	return std2.CreateError("%s", ev.interrupt)
+}
+
+// step is called before evaluating every node, it returns a non nil error if the evaluation
+// should stop.
+func (ev *Evaluator) step() std2.CometObject {
+	if err := ev.interrupted(); err != nil {
+		return err
+	}
+	if ev.MaxSteps > 0 {
+		ev.steps++
+		if ev.steps > ev.MaxSteps {
+			return ev.stop(&StepLimitError{Limit: ev.MaxSteps})
+		}
+	}
+	return nil
+}
+
+// checkContext is called at every loop iteration and every call, it returns a non nil error if the
+// context of the evaluation is done.
+func (ev *Evaluator) checkContext() std2.CometObject {
+	if ev.ctx == nil {
+		return nil
+	}
+	if err := ev.ctx.Err(); err != nil {
+		return ev.stop(&CancelledError{Err: err})
+	}
+	return nil
+}
+
+// checkSize returns a non nil error if a collection of the given size can't be created.
+func (ev *Evaluator) checkSize(size int64) std2.CometObject {
+	if ev.ctx == nil || ev.MaxCollectionSize <= 0 || size <= int64(ev.MaxCollectionSize) {
+		return nil
+	}
+	return ev.stop(&CollectionSizeError{Limit: ev.MaxCollectionSize, Size: size})
+}
+
+// CheckSize returns a non nil error if the evaluation was stopped, or if a collection of the given
+// size exceeds MaxCollectionSize. It's used by the builtins, the limits only apply to EvalContext.
+func (ev *Evaluator) CheckSize(size int64) std2.CometObject {
+	if err := ev.interrupted(); err != nil {
+		return err
+	}
+	if err := ev.checkContext(); err != nil {
+		return err
+	}
+	return ev.checkSize(size)
+}
+
+// checkOperation checks the size of the strings created by the binary operator before they are
+// allocated.
+func (ev *Evaluator) checkOperation(op lexer2.Token, left std2.CometObject, right std2.CometObject) std2.CometObject {
+	if ev.ctx == nil || ev.MaxCollectionSize <= 0 {
+		return nil
+	}
+	leftStr, leftIsStr := left.(*std2.CometStr)
+	rightStr, rightIsStr := right.(*std2.CometStr)
+	switch {
+	case op.Type == lexer2.Plus && (leftIsStr || rightIsStr):
+		// The other operand is converted to a string.
+		return ev.checkSize(addSizes(strSize(left), strSize(right)))
+	case op.Type == lexer2.Mul && leftIsStr:
+		if count, ok := right.(*std2.CometInt); ok {
+			return ev.checkSize(mulSizes(int64(leftStr.Size), count.Value))
+		}
+	case op.Type == lexer2.Mul && rightIsStr:
+		if count, ok := left.(*std2.CometInt); ok {
+			return ev.checkSize(mulSizes(int64(rightStr.Size), count.Value))
+		}
+	}
+	return nil
+}
+
+func strSize(object std2.CometObject) int64 {
+	return int64(len(std2.ToString(object).Value))
+}
+
+// addSizes and mulSizes compute the sizes of collections, the results are capped at math.MaxInt64
+// instead of overflowing.
+func addSizes(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func mulSizes(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
@@ -0,0 +1,287 @@
+package eval
+
+import (
+	"fmt"
+	parser2 "github.com/chermehdi/comet/pkg/parser"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleExtension is the extension added to the imported paths that don't have one.
+const ModuleExtension = ".comet"
+
+// SearchPathEnv is the environment variable listing the directories searched for the imported
+// modules, separated like the PATH variable.
+const SearchPathEnv = "COMET_PATH"
+
+// Module is an imported source file. Each module has its own global scope and types, and is only
+// evaluated once by an evaluator.
+// The members of a module are accessed with the '.' operator, the names starting with an
+// underscore are private to the module.
+type Module struct {
+	// Name is the path of the first import of the module.
+	Name string
+	// Path is the absolute path of the source file.
+	Path  string
+	Scope *Scope
+	Types map[string]*std2.CometStruct
+
+	// Set while the module is evaluated, importing it again is an import cycle.
+	loading bool
+}
+
+func (m *Module) Type() std2.CometType {
+	return std2.ModuleType
+}
+
+func (m *Module) ToString() string {
+	return fmt.Sprintf("Module(%s)", m.Name)
+}
+
+func (m *Module) GetField(name string) std2.CometObject {
+	if err := m.checkExported(name); err != nil {
+		return err
+	}
+	value, found := m.Scope.Variables[name]
+	if !found {
+		return std2.CreateError("Module '%s' has no member '%s'", m.Name, name)
+	}
+	return value
+}
+
+func (m *Module) SetField(name string, value std2.CometObject) std2.CometObject {
+	return std2.CreateError("Cannot assign '%s', the members of module '%s' are read only", name, m.Name)
+}
+
+func (m *Module) CallMethod(ctx *std2.Context, name string, args ...std2.CometObject) std2.CometObject {
+	function := m.GetField(name)
+	if isError(function) {
+		return function
+	}
+	return ctx.CallFunction(function, args...)
+}
+
+func (m *Module) checkExported(name string) std2.CometObject {
+	if strings.HasPrefix(name, "_") {
+		return std2.CreateError("'%s' is private to module '%s'", name, m.Name)
+	}
+	return nil
+}
+
+// SearchPaths returns the directories listed by the given value, separated like the PATH
+// environment variable. Empty entries are ignored.
+func SearchPaths(list string) []string {
+	paths := make([]string, 0)
+	for _, path := range filepath.SplitList(list) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// evalImportStatement imports a module of the standard library, or a source file. The modules of
+// the standard library take precedence: `import "strings"` never reads a local strings.comet,
+// which is imported with an explicit relative path like "./strings" or "strings.comet".
+func (ev *Evaluator) evalImportStatement(n *parser2.ImportStatement) std2.CometObject {
+	if native, found := std2.Modules[n.Path]; found {
+		return ev.importNativeModule(n, native)
+	}
+	module, err := ev.importModule(n.Path)
+	if err != nil {
+		return err
+	}
+	if n.Alias != "" {
+		if err := ev.checkRedeclaration(n.Alias); err != nil {
+			return err
+		}
+		ev.Scope.DeclareConstant(n.Alias, module)
+		return std2.NopInstance
+	}
+	for _, name := range n.Names {
+		if err := module.checkExported(name.Name); err != nil {
+			return err
+		}
+		if value, found := module.Scope.Variables[name.Name]; found {
+			if err := ev.checkRedeclaration(name.Name); err != nil {
+				return err
+			}
+			ev.Scope.DeclareConstant(name.Name, value)
+		} else if t, found := module.Types[name.Name]; found {
+			ev.types()[name.Name] = t
+		} else {
+			return std2.CreateError("Module '%s' has no member '%s'", module.Name, name.Name)
+		}
+	}
+	return std2.NopInstance
+}
+
+// importNativeModule binds the standard library module, or the given members of the module.
+func (ev *Evaluator) importNativeModule(n *parser2.ImportStatement, module *std2.NativeModule) std2.CometObject {
+	if n.Alias != "" {
+		if err := ev.checkRedeclaration(n.Alias); err != nil {
+			return err
+		}
+		ev.Scope.DeclareConstant(n.Alias, module)
+		return std2.NopInstance
+	}
+	for _, name := range n.Names {
+		value := module.GetField(name.Name)
+		if isError(value) {
+			return value
+		}
+		if err := ev.checkRedeclaration(name.Name); err != nil {
+			return err
+		}
+		ev.Scope.DeclareConstant(name.Name, value)
+	}
+	return std2.NopInstance
+}
+
+// importModule returns the module of the given path, evaluating it on its first import.
+func (ev *Evaluator) importModule(path string) (*Module, std2.CometObject) {
+	file, err := ev.findModule(path)
+	if err != nil {
+		return nil, err
+	}
+	if module, found := ev.modules[file]; found {
+		if module.loading {
+			return nil, ev.importCycleError(module)
+		}
+		return module, nil
+	}
+	source, readErr := ioutil.ReadFile(file)
+	if readErr != nil {
+		return nil, std2.CreateError("Cannot read module '%s': %s", path, readErr)
+	}
+	p := parser2.New(string(source))
+	root := p.Parse()
+	if p.Errors.HasAny() {
+		return nil, std2.CreateError("Cannot parse module '%s':\n%s", path, p.Errors.String())
+	}
+	if ev.module == nil {
+		ev.mainScope = ev.Scope
+		for ev.mainScope.Parent != nil {
+			ev.mainScope = ev.mainScope.Parent
+		}
+	}
+	module := &Module{
+		Name:    path,
+		Path:    file,
+		Scope:   NewScope(nil),
+		Types:   make(map[string]*std2.CometStruct),
+		loading: true,
+	}
+	ev.modules[file] = module
+	ev.importing = append(ev.importing, module)
+	oldScope, oldModule := ev.Scope, ev.module
+	ev.Scope, ev.module = module.Scope, module
+	result := ev.Eval(root)
+	ev.Scope, ev.module = oldScope, oldModule
+	ev.importing = ev.importing[:len(ev.importing)-1]
+	module.loading = false
+	if isError(result) {
+		// The module can be imported again once fixed, in the REPL.
+		delete(ev.modules, file)
+		return nil, std2.CreateError("Error in module '%s': %s", path, result.(*std2.CometError).Message)
+	}
+	return module, nil
+}
+
+// findModule returns the absolute path of the file of an imported module. Relative paths are
+// searched in the directory of the importing module, or Dir for the main program, then in the
+// SearchPaths.
+func (ev *Evaluator) findModule(path string) (string, std2.CometObject) {
+	candidates := []string{path}
+	if filepath.Ext(path) == "" {
+		candidates = append(candidates, path+ModuleExtension)
+	}
+	dirs := []string{""}
+	if !filepath.IsAbs(path) {
+		dirs = []string{ev.Dir}
+		if ev.module != nil {
+			dirs[0] = filepath.Dir(ev.module.Path)
+		}
+		dirs = append(dirs, ev.SearchPaths...)
+	}
+	for _, dir := range dirs {
+		for _, candidate := range candidates {
+			file := filepath.Join(dir, candidate)
+			if info, err := os.Stat(file); err == nil && !info.IsDir() {
+				absolute, err := filepath.Abs(file)
+				if err != nil {
+					return "", std2.CreateError("Cannot import module '%s': %s", path, err)
+				}
+				return absolute, nil
+			}
+		}
+	}
+	return "", std2.CreateError("Cannot find module '%s'", path)
+}
+
+func (ev *Evaluator) importCycleError(module *Module) std2.CometObject {
+	names := make([]string, 0, len(ev.importing)+1)
+	for i := len(ev.importing) - 1; i >= 0; i-- {
+		names = append([]string{ev.importing[i].Name}, names...)
+		if ev.importing[i] == module {
+			break
+		}
+	}
+	return std2.CreateError("Import cycle: %s -> %s", strings.Join(names, " -> "), module.Name)
+}
+
+// types returns the types declared by the module being evaluated.
+func (ev *Evaluator) types() map[string]*std2.CometStruct {
+	if ev.module != nil {
+		return ev.module.Types
+	}
+	return ev.Types
+}
+
+// moduleOf returns the module declaring the function, nil for the main program.
+func (ev *Evaluator) moduleOf(function *std2.CometFunc) *Module {
+	return ev.functionModules[function]
+}
+
+// declareInModule records that the function is declared by the module being evaluated.
+func (ev *Evaluator) declareInModule(function *std2.CometFunc) {
+	if ev.module != nil {
+		ev.functionModules[function] = ev.module
+	}
+}
+
+// callScope creates the scope of a call of the function, the parent of the scope is the current
+// scope, or the global scope of the module of the function if it's declared by another module.
+func (ev *Evaluator) callScope(function *std2.CometFunc) *Scope {
+	return NewScope(ev.callParent(function, ev.Scope))
+}
+
+// callParent returns the parent of the scope of a call of the function made from the given scope.
+func (ev *Evaluator) callParent(function *std2.CometFunc, scope *Scope) *Scope {
+	module := ev.moduleOf(function)
+	if module == ev.module {
+		return scope
+	}
+	if module == nil {
+		return ev.mainScope
+	}
+	return module.Scope
+}
+
+func (ev *Evaluator) lookupModule(name string) (*Module, std2.CometObject) {
+	value, found := ev.Scope.Lookup(name)
+	if !found {
+		return nil, std2.CreateError("Identifier (%s) is not bounded to any value, have you tried declaring it?", name)
+	}
+	module, ok := value.(*Module)
+	if native, isNative := value.(*std2.NativeModule); isNative {
+		return nil, std2.CreateError("Module '%s' of the standard library declares no types", native.Name)
+	}
+	if !ok {
+		return nil, std2.CreateError("'%s' is not a module, got %s", name, value.Type())
+	}
+	return module, nil
+}
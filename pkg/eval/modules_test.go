@@ -0,0 +1,358 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeModules writes the given files in a temporary directory and returns its path.
+func writeModules(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "comet-modules")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(source), 0644))
+	}
+	return dir
+}
+
+func TestEvaluator_Eval_Imports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.comet": `
+var pi = 3
+func square(x) { return x * x }
+func area(r) { return pi * square(r) }
+func _helper() { return 1 }
+func apply(f, x) { return f(x) }
+func loop(n) {
+  if n == 0 { return pi }
+  return loop(n - 1)
+}
+`,
+		"lib/geo.comet": `
+import "math.comet" as math
+struct Point {
+  func init(x, y) {
+    this.x = x
+    this.y = y
+  }
+  func norm() { return math.square(this.x) + math.square(this.y) }
+}
+`,
+		"bad.comet":     "var a = 1 / 0",
+		"syntax.comet":  "var = 1",
+		"cycle/a.comet": `import "b.comet" as b`,
+		"cycle/b.comet": `import "a.comet" as a`,
+		"strings.comet": "var local = true",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"import \"lib/math.comet\" as m\n m.area(2)", "CometInt(12)"},
+		{"import \"lib/math.comet\"\n math.pi", "CometInt(3)"},
+		{"import \"lib/math\" as m\n m.square(5)", "CometInt(25)"},
+		{"import { area, pi } from \"lib/math.comet\"\n area(1) + pi", "CometInt(6)"},
+		{"import \"lib/math.comet\" as m\n var sq = m.square\n sq(3)", "CometInt(9)"},
+		// Functions are evaluated with the globals of their module.
+		{"var pi = 100\n import \"lib/math.comet\" as m\n m.area(1)", "CometInt(3)"},
+		{"var k = 10\n func addK(x) { return x + k }\n import \"lib/math.comet\" as m\n m.apply(addK, 1)", "CometInt(11)"},
+		{"import \"lib/math.comet\" as m\n m.loop(20000)", "CometInt(3)"},
+		{"import { loop } from \"lib/math.comet\"\n func f() { return loop(100) }\n f()", "CometInt(3)"},
+		{"import \"lib/geo.comet\" as geo\n var p = new geo.Point(3, 4)\n p.norm()", "CometInt(25)"},
+		{"import { Point } from \"lib/geo.comet\"\n new Point(1, 2).norm()", "CometInt(5)"},
+		{"struct Point {}\n import \"lib/geo.comet\" as geo\n new Point()", "CometInstance(Type=Point)"},
+		{"import \"lib/math.comet\" as m\n m", "Module(lib/math.comet)"},
+		{"import \"lib/math.comet\" as m\n m._helper()", "Comet error: \n\n\t'_helper' is private to module 'lib/math.comet'"},
+		{"import { _helper } from \"lib/math.comet\"", "Comet error: \n\n\t'_helper' is private to module 'lib/math.comet'"},
+		{"import { missing } from \"lib/math.comet\"", "Comet error: \n\n\tModule 'lib/math.comet' has no member 'missing'"},
+		{"import \"lib/math.comet\" as m\n m.missing", "Comet error: \n\n\tModule 'lib/math.comet' has no member 'missing'"},
+		{"import \"lib/math.comet\" as m\n m.pi = 4", "Comet error: \n\n\tCannot assign 'pi', the members of module 'lib/math.comet' are read only"},
+		{"import \"lib/math.comet\" as m\n new m.Point()", "Comet error: \n\n\tType 'Point' not found"},
+		{"var m = 1\n new m.Point()", "Comet error: \n\n\t'm' is not a module, got INTEGER"},
+		{`import "missing.comet" as m`, "Comet error: \n\n\tCannot find module 'missing.comet'"},
+		// The modules of the standard library take precedence, a local file with the same name is
+		// imported with an explicit relative path.
+		{"import \"strings\" as s\n s.upper(\"a\")", `CometStr("A")`},
+		{"import \"./strings\" as s\n s.local", "CometBool(true)"},
+		{"import \"strings.comet\" as s\n s.local", "CometBool(true)"},
+		{`import "bad.comet" as bad`, "Comet error: \n\n\tError in module 'bad.comet': Division by zero"},
+		{`import "cycle/a.comet" as a`, "Comet error: \n\n\tError in module 'cycle/a.comet': Error in module 'b.comet': Import cycle: cycle/a.comet -> b.comet -> cycle/a.comet"},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		evaluator.Dir = dir
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(test.Src)).ToString(), test.Src)
+		assert.Empty(t, evaluator.frames)
+	}
+
+	evaluator := NewEvaluator()
+	evaluator.Dir = dir
+	result := evaluator.Eval(parseOrDie(`import "syntax.comet" as s`))
+	assert.Contains(t, result.ToString(), "Cannot parse module 'syntax.comet'")
+}
+
+func TestEvaluator_Eval_ImportsAreCached(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"counter.comet": "println(\"loading\")\n var count = [0]\n func next() {\n count[0] += 1\n return count[0]\n }",
+		"user.comet":    "import \"counter.comet\" as c\n var first = c.next()",
+	})
+	defer os.RemoveAll(dir)
+
+	var stdout bytes.Buffer
+	evaluator := NewEvaluator()
+	evaluator.Dir, evaluator.Stdout = dir, &stdout
+	result := evaluator.Eval(parseOrDie("import \"counter.comet\" as a\n import \"./counter.comet\" as b\n import \"user.comet\" as u\n a.next()\n b.next()"))
+	assert.Equal(t, "CometInt(3)", result.ToString())
+	assert.Equal(t, "loading\n", stdout.String())
+	assert.Len(t, evaluator.modules, 2)
+}
+
+func TestEvaluator_Eval_ImportSearchPaths(t *testing.T) {
+	lib := writeModules(t, map[string]string{"strings/pad.comet": "func pad(s) { return \" \" + s }"})
+	defer os.RemoveAll(lib)
+	dir := writeModules(t, map[string]string{"strings/pad.comet": "func pad(s) { return \"local\" }"})
+	defer os.RemoveAll(dir)
+
+	evaluator := NewEvaluator()
+	evaluator.SearchPaths = SearchPaths(string(filepath.ListSeparator) + lib)
+	assert.Equal(t, `CometStr(" a")`, evaluator.Eval(parseOrDie("import \"strings/pad\" as p\n p.pad(\"a\")")).ToString())
+
+	// The directory of the main program is searched first.
+	evaluator = NewEvaluator()
+	evaluator.Dir, evaluator.SearchPaths = dir, []string{lib}
+	assert.Equal(t, `CometStr("local")`, evaluator.Eval(parseOrDie("import \"strings/pad\" as p\n p.pad(\"a\")")).ToString())
+}
+
+func TestEvaluator_Eval_StringsModule(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{`import "strings"` + "\n" + `strings.len("héllo")`, "CometInt(5)"},
+		{`import "strings" as s` + "\n" + `s.len("")`, "CometInt(0)"},
+		{`import "strings" as s` + "\n" + `s.upper("ça é")`, `CometStr("ÇA É")`},
+		{`import "strings" as s` + "\n" + `s.lower("ÉCOLE")`, `CometStr("école")`},
+		{`import "strings" as s` + "\n" + `s.trim("  a b  ")`, `CometStr("a b")`},
+		{`import "strings" as s` + "\n" + `s.trim("--a-", "-")`, `CometStr("a")`},
+		{`import "strings" as s` + "\n" + `s.split("a,b,,c", ",")`, `[CometStr("a"), CometStr("b"), CometStr(""), CometStr("c")]`},
+		{`import "strings" as s` + "\n" + `s.split("日本", "")`, `[CometStr("日"), CometStr("本")]`},
+		{`import "strings" as s` + "\n" + `s.join(["a", "b", "c"], ", ")`, `CometStr("a, b, c")`},
+		{`import "strings" as s` + "\n" + `s.join([], ", ")`, `CometStr("")`},
+		{`import "strings" as s` + "\n" + `s.join(["a", 1], "")`, "Comet error: \n\n\tElement 1 of the array given to builtin 'strings.join' expected to be STR, got INTEGER instead (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.replace("aaa", "a", "b")`, `CometStr("bbb")`},
+		{`import "strings" as s` + "\n" + `s.replace("aaa", "a", "b", 2)`, `CometStr("bba")`},
+		{`import "strings" as s` + "\n" + `s.contains("comet", "met")`, "CometBool(true)"},
+		{`import "strings" as s` + "\n" + `s.contains("comet", "x")`, "CometBool(false)"},
+		{`import "strings" as s` + "\n" + `s.startsWith("comet", "co")`, "CometBool(true)"},
+		{`import "strings" as s` + "\n" + `s.endsWith("comet", "co")`, "CometBool(false)"},
+		{`import "strings" as s` + "\n" + `s.indexOf("héllo", "l")`, "CometInt(2)"},
+		{`import "strings" as s` + "\n" + `s.indexOf("hello", "x")`, "CometInt(-1)"},
+		{`import "strings" as s` + "\n" + `s.repeat("ab", 3)`, `CometStr("ababab")`},
+		{`import "strings" as s` + "\n" + `s.repeat("ab", 0 - 1)`, "Comet error: \n\n\tCannot repeat a string a negative number of times, got -1 (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.repeat("ab", 9000000000)`, "Comet error: \n\n\tCannot repeat a string of 2 bytes 9000000000 times, the result is too large (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.substring("héllo", 1, 3)`, `CometStr("él")`},
+		{`import "strings" as s` + "\n" + `s.substring("héllo", 3)`, `CometStr("lo")`},
+		{`import "strings" as s` + "\n" + `s.substring("héllo", 2, 6)`, "Comet error: \n\n\tSubstring bounds [2, 6) out of range for a string of length 5 (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.chars("añb")`, `[CometStr("a"), CometStr("ñ"), CometStr("b")]`},
+		{`import "strings" as s` + "\n" + `s.format("{} is {}", "x", 3)`, `CometStr("x is 3")`},
+		{`import "strings" as s` + "\n" + `s.format("{} and {}", [1, [2.5, "a"]], nil)`, `CometStr("[1, [2.5, a]] and nil")`},
+		{`import "strings" as s` + "\n" + `s.format("{{}} {}%d", true)`, `CometStr("{} true%d")`},
+		{`import "strings" as s` + "\n" + `s.format("none")`, `CometStr("none")`},
+		{`import "strings" as s` + "\n" + `s.format("{} and {}", 1)`, "Comet error: \n\n\tBuiltin 'strings.format' expects 2 arguments for the format, got 1 (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.format("{}", 1, 2)`, "Comet error: \n\n\tBuiltin 'strings.format' expects 1 argument for the format, got 2 (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.format("a {b}", 1)`, "Comet error: \n\n\tInvalid format string, the '{' at offset 2 should be doubled (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.format("a }")`, "Comet error: \n\n\tInvalid format string, the '}' at offset 2 should be doubled (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.upper(1)`, "Comet error: \n\n\tArgument 1 of builtin 'strings.upper' expected to be STR, got INTEGER instead (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.len()`, "Comet error: \n\n\tBuiltin 'strings.len' expects 1 argument, got 0 (line 2, column 3)"},
+		{`import "strings" as s` + "\n" + `s.missing("a")`, "Comet error: \n\n\tModule 'strings' has no member 'missing'"},
+		{`import "strings" as s` + "\n" + `s.upper = 1`, "Comet error: \n\n\tCannot assign 'upper', the members of module 'strings' are read only"},
+		{`import "strings" as s` + "\n" + `new s.Builder()`, "Comet error: \n\n\tModule 'strings' of the standard library declares no types"},
+		{`import "strings" as s` + "\n" + `s`, "Module(strings)"},
+		{`import "strings" as s` + "\n" + `toString(s)`, `CometStr("Module(strings)")`},
+		{`import { upper, len } from "strings"` + "\n" + `len(upper("ab"))`, "CometInt(2)"},
+		{`import { len } from "strings"` + "\n" + `len([1, 2])`, "Comet error: \n\n\tArgument 1 of builtin 'strings.len' expected to be STR, got ARRAY instead (line 2, column 1)"},
+		{`import { upper } from "strings"` + "\n" + `toString(upper)`, `CometStr("Builtin(strings.upper)")`},
+		{`import { upper } from "strings"` + "\n" + `upper(1 / 0)`, "Comet error: \n\n\tDivision by zero"},
+		{`import { nope } from "strings"`, "Comet error: \n\n\tModule 'strings' has no member 'nope'"},
+		{`import "strings" as s` + "\n" + `var up = s.upper` + "\n" + `up("a")`, `CometStr("A")`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, NewEvaluator().Eval(parseOrDie(test.Src)).ToString(), test.Src)
+	}
+}
+
+func TestEvaluator_EvalContext_StringsModuleLimits(t *testing.T) {
+	tests := []struct {
+		Src  string
+		Size int64
+	}{
+		{`strings.repeat("x", 101)`, 101},
+		{`strings.split(s, "")`, 200},
+		{`strings.split(s, "b")`, 101},
+		{`strings.chars(s)`, 200},
+		{`strings.join(["a", "b", "c"], s)`, 403},
+		{`strings.replace("aaa", "a", s)`, 600},
+		{`strings.replace("aaa", "a", s, 1)`, 202},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		evaluator.MaxCollectionSize = 100
+		// The limits only apply to EvalContext.
+		evaluator.Eval(parseOrDie("import \"strings\"\n var s = \"ab\" * 100"))
+		_, err := evaluator.EvalContext(context.Background(), parseOrDie(test.Src))
+		assert.Equal(t, &CollectionSizeError{Limit: 100, Size: test.Size}, err, test.Src)
+	}
+}
+
+func TestEvaluator_Eval_MathModule(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"math.pi", "CometFloat(3.141592653589793)"},
+		{"math.e", "CometFloat(2.718281828459045)"},
+		{"math.abs(0 - 3)", "CometInt(3)"},
+		{"math.abs(-2.5)", "CometFloat(2.5)"},
+		{"math.abs(-9223372036854775807 - 1)", "CometBigInt(9223372036854775808)"},
+		{"math.abs(bigint(-3))", "CometInt(3)"},
+		{"math.min(3, 1.5, 2)", "CometFloat(1.5)"},
+		{"math.max(3, bigint(4), 2)", "CometBigInt(4)"},
+		{"math.max(1)", "CometInt(1)"},
+		{`math.max(1, "2")`, "Comet error: \n\n\tArgument 2 of builtin 'math.max' expected to be a number, got STR instead (line 2, column 7)"},
+		{"math.pow(2, 10)", "CometInt(1024)"},
+		{"math.pow(2, 64)", "CometBigInt(18446744073709551616)"},
+		{"math.pow(bigint(3), 2)", "CometInt(9)"},
+		{"math.pow(2, -1)", "CometFloat(0.5)"},
+		{"math.pow(2.5, 2)", "CometFloat(6.25)"},
+		{"math.pow(0, -1)", "Comet error: \n\n\tBuiltin 'math.pow' is not defined for 0 and -1 (line 2, column 7)"},
+		{"math.pow(-8, 0.5)", "Comet error: \n\n\tBuiltin 'math.pow' is not defined for -8 and 0.5 (line 2, column 7)"},
+		{"math.pow(3, 100000000)", "Comet error: \n\n\tThe result of builtin 'math.pow' is too large (line 2, column 7)"},
+		{"math.pow(1, 100000000)", "CometInt(1)"},
+		{"math.sqrt(16)", "CometFloat(4)"},
+		{"math.sqrt(-1)", "Comet error: \n\n\tBuiltin 'math.sqrt' is not defined for -1 (line 2, column 7)"},
+		{`math.sqrt("4")`, "Comet error: \n\n\tArgument 1 of builtin 'math.sqrt' expected to be a number, got STR instead (line 2, column 7)"},
+		{"math.floor(2.7)", "CometInt(2)"},
+		{"math.floor(-2.5)", "CometInt(-3)"},
+		{"math.ceil(2.1)", "CometInt(3)"},
+		{"math.round(2.5)", "CometInt(3)"},
+		{"math.round(7)", "CometInt(7)"},
+		{"math.floor(10000000000000000000.5)", "CometBigInt(10000000000000000000)"},
+		{"math.sin(0)", "CometFloat(0)"},
+		{"math.cos(0)", "CometFloat(1)"},
+		{"math.tan(0)", "CometFloat(0)"},
+		{"math.asin(1) * 2 == math.pi", "CometBool(true)"},
+		{"math.acos(2)", "Comet error: \n\n\tBuiltin 'math.acos' is not defined for 2 (line 2, column 7)"},
+		{"math.atan(0)", "CometFloat(0)"},
+		{"math.atan2(1, 1) * 4 == math.pi", "CometBool(true)"},
+		{"math.exp(0)", "CometFloat(1)"},
+		{"math.exp(1000)", "Comet error: \n\n\tBuiltin 'math.exp' is not defined for 1000 (line 2, column 7)"},
+		{"math.log(math.e)", "CometFloat(1)"},
+		{"math.log(8, 2)", "CometFloat(3)"},
+		{"math.log(0)", "Comet error: \n\n\tBuiltin 'math.log' is not defined for 0 (line 2, column 7)"},
+		{"math.log(8, 1)", "Comet error: \n\n\tBuiltin 'math.log' is not defined for the base 1 (line 2, column 7)"},
+		{"math.log2(1024)", "CometFloat(10)"},
+		{"math.log10(1000)", "CometFloat(3)"},
+		{"math.gcd(12, -18)", "CometInt(6)"},
+		{"math.gcd(0, 0)", "CometInt(0)"},
+		{"math.gcd(bigint(12), 8)", "CometInt(4)"},
+		{"math.gcd(1.5, 3)", "Comet error: \n\n\tArgument 1 of builtin 'math.gcd' expected to be an integer, got FLOAT instead (line 2, column 7)"},
+		{"math.lcm(4, 6)", "CometInt(12)"},
+		{"math.lcm(0, 6)", "CometInt(0)"},
+		{"math.lcm(9223372036854775807, 2)", "CometBigInt(18446744073709551614)"},
+		{"math.modpow(2, 10, 1000)", "CometInt(24)"},
+		{"math.modpow(-2, 3, 5)", "CometInt(2)"},
+		{"math.modpow(2, -1, 5)", "Comet error: \n\n\tBuiltin 'math.modpow' expects a positive exponent, got -1 (line 2, column 7)"},
+		{"math.modpow(2, 3, 0)", "Comet error: \n\n\tBuiltin 'math.modpow' expects a positive modulus, got 0 (line 2, column 7)"},
+		{"math.modpow(2, 3, 1.5)", "Comet error: \n\n\tArgument 3 of builtin 'math.modpow' expected to be an integer, got FLOAT instead (line 2, column 7)"},
+		{"math.sqrt()", "Comet error: \n\n\tBuiltin 'math.sqrt' expects 1 argument, got 0 (line 2, column 7)"},
+	}
+	for _, test := range tests {
+		src := "import \"math\"\n " + test.Src
+		assert.Equal(t, test.Expected, NewEvaluator().Eval(parseOrDie(src)).ToString(), test.Src)
+	}
+}
+
+func TestEvaluator_Eval_JSONModule(t *testing.T) {
+	// Comet strings can't contain double quotes, q replaces the single quotes of the JSON documents.
+	q := func(s string) string { return strings.Replace(s, "'", "\"", -1) }
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{`json.parse("42")`, "CometInt(42)"},
+		{`json.parse("-2.5")`, "CometFloat(-2.5)"},
+		{`json.parse("1e2")`, "CometFloat(100)"},
+		{`json.parse("123456789012345678901234")`, "CometBigInt(123456789012345678901234)"},
+		{`json.parse(" true ")`, "CometBool(true)"},
+		{`json.parse("null")`, "CometNil"},
+		{`json.parse(q("'a b'"))`, `CometStr("a b")`},
+		{`json.parse(q("[1, 'a', [false]]"))`, `[CometInt(1), CometStr("a"), [CometBool(false)]]`},
+		{`json.parse(q("{'a': {'b': [1, 2.5]}}"))`, "CometInstance(Type=Map)"},
+		{"var v = json.parse(q(\"{'a': {'b': [1, 2.5]}}\"))\n v.a.b", "[CometInt(1), CometFloat(2.5)]"},
+		{`json.parse(q("{'a': }"))`, "Comet error: \n\n\tCannot parse JSON: invalid character '}' looking for beginning of value (line 2, column 7)"},
+		{`json.parse("[1, 2")`, "Comet error: \n\n\tCannot parse JSON: unexpected end of input (line 2, column 7)"},
+		{`json.parse("")`, "Comet error: \n\n\tCannot parse JSON: unexpected end of input (line 2, column 7)"},
+		{`json.parse("1 2")`, "Comet error: \n\n\tCannot parse JSON: unexpected data after the value at offset 3 (line 2, column 7)"},
+		{`json.parse(1)`, "Comet error: \n\n\tArgument 1 of builtin 'json.parse' expected to be STR, got INTEGER instead (line 2, column 7)"},
+		{`json.stringify(1)`, `CometStr("1")`},
+		{`json.stringify(1.0)`, `CometStr("1.0")`},
+		{`json.stringify(0.5)`, `CometStr("0.5")`},
+		{`json.stringify(bigint(7))`, `CometStr("7")`},
+		{`json.stringify(nil)`, `CometStr("null")`},
+		{`json.stringify([true, "a<b"])`, `CometStr("[true,"a<b"]")`},
+		{`json.stringify(json.parse(q("{'b': [1, {}, []], 'a': 'x'}")))`, `CometStr("{"a":"x","b":[1,{},[]]}")`},
+		{`json.stringify(json.parse(q("{'k': 1e2}")))`, `CometStr("{"k":100.0}")`},
+		{"struct P { func init(x, y) {\n this.y = y\n this.x = x\n } }\n json.stringify([new P(1, nil)])", `CometStr("[{"x":1,"y":null}]")`},
+		{"json.stringify([1, [2, []]], 2)", "CometStr(\"[\n  1,\n  [\n    2,\n    []\n  ]\n]\")"},
+		{`json.stringify(json.parse(q("{'a': [1], 'b': {}}")), "--")`, "CometStr(\"{\n--\"a\": [\n----1\n--],\n--\"b\": {}\n}\")"},
+		{`json.stringify([1], 0)`, `CometStr("[1]")`},
+		{`json.stringify([1], -1)`, "Comet error: \n\n\tThe indent of builtin 'json.stringify' must be between 0 and 16 spaces, got -1 (line 2, column 7)"},
+		{`json.stringify([1], true)`, "Comet error: \n\n\tArgument 2 of builtin 'json.stringify' expected to be an integer or a string, got BOOLEAN instead (line 2, column 7)"},
+		{`json.stringify(json.parse("1e400"))`, "Comet error: \n\n\tCannot convert +Inf to JSON (line 2, column 7)"},
+		{"func f() {}\n json.stringify([f])", "Comet error: \n\n\tCannot convert a value of type FUNCTION to JSON (line 3, column 7)"},
+		{"var a = [1]\n json.stringify([a, a])", `CometStr("[[1],[1]]")`},
+		{"var a = [1]\n push(a, [a])\n json.stringify(a)", "Comet error: \n\n\tCannot convert a cyclic array to JSON (line 4, column 7)"},
+		{"struct N { func init() { this.next = this } }\n json.stringify(new N())", "Comet error: \n\n\tCannot convert a cyclic instance of 'N' to JSON (line 3, column 7)"},
+		{"func longest(a, b) { return len(a) > len(b) }\n json.stringify(json.parse(q(\"{'a': 1, 'name': {'x': 1, 'yy': 2}, 'b': 2, 'id': 3}\")), nil, longest)", `CometStr("{"name":{"yy":2,"x":1},"id":3,"a":1,"b":2}")`},
+		{"func first(a, b) { return a == \"id\" }\n json.stringify(json.parse(q(\"{'b': 1, 'id': 2, 'a': 3}\")), 0, first)", `CometStr("{"id":2,"a":3,"b":1}")`},
+		{"func fail(a, b) { return 1 / 0 }\n json.stringify(json.parse(q(\"{'a': 1, 'b': 2}\")), 0, fail)", "Comet error: \n\n\tDivision by zero"},
+		{`json.stringify([1], 0, 1)`, "Comet error: \n\n\tArgument 3 of builtin 'json.stringify' expected to be FUNCTION, got INTEGER instead (line 2, column 7)"},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		assert.NoError(t, evaluator.Register("q", q))
+		src := "import \"json\"\n " + test.Src
+		assert.Equal(t, test.Expected, evaluator.Eval(parseOrDie(src)).ToString(), test.Src)
+	}
+}
+
+func TestEvaluator_EvalContext_JSONModuleLimits(t *testing.T) {
+	tests := []struct {
+		Src  string
+		Size int64
+	}{
+		{`json.stringify(s)`, 202},
+		{`json.stringify([1, s])`, 205},
+	}
+	for _, test := range tests {
+		evaluator := NewEvaluator()
+		evaluator.MaxCollectionSize = 100
+		// The limits only apply to EvalContext.
+		evaluator.Eval(parseOrDie("import \"json\"\n var s = \"ab\" * 100"))
+		_, err := evaluator.EvalContext(context.Background(), parseOrDie(test.Src))
+		assert.Equal(t, &CollectionSizeError{Limit: 100, Size: test.Size}, err, test.Src)
+	}
+}
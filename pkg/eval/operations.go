@@ -0,0 +1,240 @@
+package eval
+
+import (
+	parser2 "github.com/chermehdi/comet/pkg/parser"
+	std2 "github.com/chermehdi/comet/pkg/std"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// The operations of this file are shared by the evaluator and the vm package, so that both
+// produce the same results.
+
+// TruthValue returns the boolean value of the object when used as a condition.
+// In strict mode only CometBool values have a truth value, the second return value
+// is false for any other type.
+func TruthValue(obj std2.CometObject, strict bool) (bool, bool) {
+	if strict {
+		b, ok := obj.(*std2.CometBool)
+		if !ok {
+			return false, false
+		}
+		return b.Value, true
+	}
+	return std2.IsTruthy(obj), true
+}
+
+// Negate applies the prefix '-' operator, negating the smallest int64 promotes it to a bigint, and
+// negating the bigint 9223372036854775808 demotes it to a CometInt.
+func Negate(value std2.CometObject) std2.CometObject {
+	switch n := value.(type) {
+	case *std2.CometBigInt:
+		return bigIntResult(new(big.Int).Neg(n.Value))
+	case *std2.CometFloat:
+		return &std2.CometFloat{Value: -n.Value}
+	case *std2.CometInt:
+		if n.Value == math.MinInt64 {
+			return &std2.CometBigInt{Value: new(big.Int).Neg(big.NewInt(n.Value))}
+		}
+		return &std2.CometInt{Value: -n.Value}
+	default:
+		return std2.CreateError("Cannot apply operator (-) on none INTEGER type %s", value.Type())
+	}
+}
+
+// IndexAccess reads an index of an array or a string.
+// Negative indexes are counted from the end, a[-1] is the last element. Indexing a string
+// returns a string holding the single character (not byte) at that index. Like the missing
+// fields, the holes outside of an array are nil.
+func IndexAccess(target, index std2.CometObject) std2.CometObject {
+	if target.Type() != std2.ArrayType && target.Type() != std2.StrType {
+		return std2.CreateError("Expected CometArray or CometStr got %s", target.Type())
+	}
+	if index.Type() != std2.IntType {
+		return std2.CreateError("Expected CometInt got %s", index.Type())
+	}
+	indexVal := index.(*std2.CometInt)
+	switch value := target.(type) {
+	case *std2.CometArray:
+		i, ok := NormalizeIndex(indexVal.Value, value.Length)
+		if !ok {
+			return std2.NilObject
+		}
+		return value.Values[i]
+	default:
+		runes := []rune(target.(*std2.CometStr).Value)
+		i, ok := NormalizeIndex(indexVal.Value, len(runes))
+		if !ok {
+			return std2.CreateError("String access out of bounds, string of length %d, index was: %d", len(runes), indexVal.Value)
+		}
+		return newStr(string(runes[i]))
+	}
+}
+
+// IndexTarget checks the target of an index assignment, and returns the array and the offset of
+// the assigned element.
+func IndexTarget(target, index std2.CometObject) (*std2.CometArray, int, std2.CometObject) {
+	if target.Type() == std2.StrType {
+		return nil, 0, std2.CreateError("Cannot assign to an index of a CometStr, strings are immutable")
+	}
+	if target.Type() != std2.ArrayType {
+		return nil, 0, std2.CreateError("Expected CometArray got %s", target.Type())
+	}
+	if index.Type() != std2.IntType {
+		return nil, 0, std2.CreateError("Expected CometInt got %s", index.Type())
+	}
+	indexVal := index.(*std2.CometInt)
+	array := target.(*std2.CometArray)
+	i, ok := NormalizeIndex(indexVal.Value, array.Length)
+	if !ok {
+		return nil, 0, std2.CreateError("Array access out of bounds, array of length %d, index was: %d", array.Length, indexVal.Value)
+	}
+	return array, i, nil
+}
+
+// Slice evaluates target[start:stop:step] on an array or a string, the bounds are nil if they are
+// omitted. Slices are copies: the resulting array does not share its elements storage with the
+// sliced one, assigning to an index of either of them does not affect the other.
+func Slice(target, start, stop, step std2.CometObject) std2.CometObject {
+	var length int
+	switch value := target.(type) {
+	case *std2.CometArray:
+		length = value.Length
+	case *std2.CometStr:
+		length = utf8.RuneCountInString(value.Value)
+	default:
+		return std2.CreateError("Cannot slice value of type %s", target.Type())
+	}
+	bounds := make([]*int64, 3)
+	for i, obj := range []std2.CometObject{start, stop, step} {
+		if obj == nil || obj.Type() == std2.NilType {
+			continue
+		}
+		if obj.Type() != std2.IntType {
+			return std2.CreateError("Slice bounds should be CometInt got %s", obj.Type())
+		}
+		bounds[i] = &obj.(*std2.CometInt).Value
+	}
+	indexes, err := SliceIndexes(length, bounds[0], bounds[1], bounds[2])
+	if err != nil {
+		return err
+	}
+	switch value := target.(type) {
+	case *std2.CometArray:
+		values := make([]std2.CometObject, len(indexes))
+		for i, index := range indexes {
+			values[i] = value.Values[index]
+		}
+		return &std2.CometArray{Length: len(values), Values: values}
+	default:
+		runes := []rune(target.(*std2.CometStr).Value)
+		var sb strings.Builder
+		for _, index := range indexes {
+			sb.WriteRune(runes[index])
+		}
+		return newStr(sb.String())
+	}
+}
+
+// PatternMatcher gives MatchPattern access to the interpreter matching a pattern.
+type PatternMatcher interface {
+	// LiteralValue returns the value of a literal pattern, or a CometError.
+	LiteralValue(pattern *parser2.LiteralPattern) std2.CometObject
+	// LookupType returns the struct named by a struct pattern.
+	LookupType(name string) (*std2.CometStruct, bool)
+	// Bind binds a name of the pattern to the matched value.
+	Bind(name string, value std2.CometObject)
+}
+
+// MatchPattern reports whether the value matches the pattern, the names bound by the pattern
+// are given to the matcher.
+// The second returned value is a CometError if the pattern could not be checked, nil otherwise.
+func MatchPattern(pattern parser2.Pattern, value std2.CometObject, matcher PatternMatcher) (bool, std2.CometObject) {
+	switch p := pattern.(type) {
+	case *parser2.WildcardPattern:
+		return true, nil
+	case *parser2.BindingPattern:
+		matcher.Bind(p.Name, value)
+		return true, nil
+	case *parser2.LiteralPattern:
+		candidate := matcher.LiteralValue(p)
+		if isError(candidate) {
+			return false, candidate
+		}
+		return MatchesCase(value, candidate), nil
+	case *parser2.ArrayPattern:
+		return matchArrayPattern(p, value, matcher)
+	case *parser2.ObjectPattern:
+		instance, ok := value.(*std2.CometInstance)
+		if !ok {
+			return false, nil
+		}
+		for _, field := range p.Fields {
+			fieldValue, found := instance.Fields[field.Name]
+			if !found {
+				return false, nil
+			}
+			if matched, err := MatchPattern(field.Pattern, fieldValue, matcher); !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case *parser2.StructPattern:
+		return matchStructPattern(p, value, matcher)
+	}
+	return false, std2.CreateError("Unsupported pattern %s", pattern.Literal())
+}
+
+func matchArrayPattern(pattern *parser2.ArrayPattern, value std2.CometObject, matcher PatternMatcher) (bool, std2.CometObject) {
+	array, ok := value.(*std2.CometArray)
+	if !ok {
+		return false, nil
+	}
+	if array.Length < len(pattern.Elements) || (pattern.Rest == nil && array.Length != len(pattern.Elements)) {
+		return false, nil
+	}
+	for i, element := range pattern.Elements {
+		if matched, err := MatchPattern(element, array.Values[i], matcher); !matched {
+			return false, err
+		}
+	}
+	if pattern.Rest == nil {
+		return true, nil
+	}
+	rest := make([]std2.CometObject, array.Length-len(pattern.Elements))
+	copy(rest, array.Values[len(pattern.Elements):])
+	return MatchPattern(pattern.Rest, &std2.CometArray{Length: len(rest), Values: rest}, matcher)
+}
+
+// matchStructPattern matches instances of the pattern's type, sub patterns are matched against the
+// fields named after the constructor parameters.
+func matchStructPattern(pattern *parser2.StructPattern, value std2.CometObject, matcher PatternMatcher) (bool, std2.CometObject) {
+	t, found := matcher.LookupType(pattern.Type)
+	if !found {
+		return false, std2.CreateError("Type '%s' not found", pattern.Type)
+	}
+	var params []*parser2.IdentifierExpression
+	if constructor, found := t.GetConstructor(); found {
+		params = constructor.Params
+	}
+	if len(pattern.Elements) != len(params) {
+		return false, std2.CreateError("Pattern %s expects %d fields, the constructor of '%s' has %d parameters",
+			pattern.Literal(), len(pattern.Elements), t.Name, len(params))
+	}
+	instance, ok := value.(*std2.CometInstance)
+	if !ok || instance.Struct != t {
+		return false, nil
+	}
+	for i, element := range pattern.Elements {
+		fieldValue, found := instance.Fields[params[i].Name]
+		if !found {
+			return false, nil
+		}
+		if matched, err := MatchPattern(element, fieldValue, matcher); !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
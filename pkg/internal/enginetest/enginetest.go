@@ -0,0 +1,73 @@
+// Package enginetest holds the helpers shared by the tests of the packages executing programs, the
+// optimizer and the VM are checked against the evaluator with the programs of its tests.
+package enginetest
+
+import (
+	"github.com/chermehdi/comet/pkg/parser"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Parse parses src, the second returned value is false if src has syntax errors.
+func Parse(src string) (*parser.RootNode, bool) {
+	p := parser.New(src)
+	root := p.Parse()
+	return root, !p.Errors.HasAny()
+}
+
+// Program is a program of an evaluator test, Strict is true if the test enabled the strict mode
+// before running it.
+type Program struct {
+	Src    string
+	Strict bool
+}
+
+// TestPrograms are the programs of a test function, in order.
+type TestPrograms struct {
+	Name     string
+	Programs []Program
+}
+
+// EvaluatorPrograms returns the programs of the test functions of the Go file at path: the string
+// literals that parse without errors. The programs of the EvalContext tests are not included, they
+// only terminate because of its limits.
+func EvaluatorPrograms(path string) ([]TestPrograms, error) {
+	file, err := goparser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var tests []TestPrograms
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !strings.HasPrefix(fn.Name.Name, "Test") || strings.HasPrefix(fn.Name.Name, "TestEvaluator_EvalContext") {
+			continue
+		}
+		test := TestPrograms{Name: fn.Name.Name}
+		strict := false
+		ast.Inspect(fn.Body, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.SelectorExpr:
+				if n.Sel.Name == "Strict" {
+					strict = true
+				}
+			case *ast.BasicLit:
+				if n.Kind != token.STRING {
+					return true
+				}
+				src, err := strconv.Unquote(n.Value)
+				if err != nil {
+					return true
+				}
+				if _, ok := Parse(src); ok {
+					test.Programs = append(test.Programs, Program{Src: src, Strict: strict})
+				}
+			}
+			return true
+		})
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
@@ -16,28 +16,67 @@ type Lexer struct {
 
 // Creates an initializes a new lexer from the given input source.
 func NewLexer(src string) *Lexer {
-	return &Lexer{
+	lexer := &Lexer{
 		src:       src,
 		pos:       0,
-		current:   src[0],
 		inputSize: len(src),
 		line:      1,
 		column:    1,
 	}
+	// The current character of an empty source is the EOF.
+	if len(src) > 0 {
+		lexer.current = src[0]
+	}
+	return lexer
 }
 
 func (l *Lexer) Next() Token {
 	var result Token
 	l.ignoreWhiteSpace()
+	// Tokens are positioned at their first character.
+	line, column := l.line, l.column
 	switch l.current {
 	case '+':
-		result = NewTokenWithMeta(Plus, "+", l.line, l.column)
+		if l.peek() == '+' {
+			l.advance()
+			result = NewTokenWithMeta(Increment, "++", l.line, l.column)
+		} else if l.peek() == '=' {
+			l.advance()
+			result = NewTokenWithMeta(PlusAssign, "+=", l.line, l.column)
+		} else {
+			result = NewTokenWithMeta(Plus, "+", l.line, l.column)
+		}
 	case '-':
-		result = NewTokenWithMeta(Minus, "-", l.line, l.column)
+		if l.peek() == '-' {
+			l.advance()
+			result = NewTokenWithMeta(Decrement, "--", l.line, l.column)
+		} else if l.peek() == '=' {
+			l.advance()
+			result = NewTokenWithMeta(MinusAssign, "-=", l.line, l.column)
+		} else {
+			result = NewTokenWithMeta(Minus, "-", l.line, l.column)
+		}
 	case '*':
-		result = NewTokenWithMeta(Mul, "*", l.line, l.column)
+		if l.peek() == '=' {
+			l.advance()
+			result = NewTokenWithMeta(MulAssign, "*=", l.line, l.column)
+		} else {
+			result = NewTokenWithMeta(Mul, "*", l.line, l.column)
+		}
 	case '/':
-		result = NewTokenWithMeta(Div, "/", l.line, l.column)
+		if l.peek() == '=' {
+			l.advance()
+			result = NewTokenWithMeta(DivAssign, "/=", l.line, l.column)
+		} else {
+			result = NewTokenWithMeta(Div, "/", l.line, l.column)
+		}
+	case '%':
+		if l.peek() == '=' {
+			l.advance()
+			result = NewTokenWithMeta(ModAssign, "%=", l.line, l.column)
+		} else {
+			result = NewTokenWithMeta(Mod, "%", l.line, l.column)
+		}
 	case '^':
 		result = NewTokenWithMeta(XOR, "^", l.line, l.column)
 	case '~':
@@ -48,7 +87,12 @@ func (l *Lexer) Next() Token {
 			result = NewTokenWithMeta(GTE, ">=", l.line, l.column)
 		} else if l.peek() == '>' {
 			l.advance()
-			result = NewTokenWithMeta(RSHIFT, ">>", l.line, l.column)
+			if l.peek() == '=' {
+				l.advance()
+				result = NewTokenWithMeta(RShiftAssign, ">>=", l.line, l.column)
+			} else {
+				result = NewTokenWithMeta(RSHIFT, ">>", l.line, l.column)
+			}
 		} else {
 			result = NewTokenWithMeta(GT, ">", l.line, l.column)
 		}
@@ -58,7 +102,12 @@ func (l *Lexer) Next() Token {
 			result = NewTokenWithMeta(LTE, "<=", l.line, l.column)
 		} else if l.peek() == '<' {
 			l.advance()
-			result = NewTokenWithMeta(LSHIFT, "<<", l.line, l.column)
+			if l.peek() == '=' {
+				l.advance()
+				result = NewTokenWithMeta(LShiftAssign, "<<=", l.line, l.column)
+			} else {
+				result = NewTokenWithMeta(LSHIFT, "<<", l.line, l.column)
+			}
 		} else {
 			result = NewTokenWithMeta(LT, "<", l.line, l.column)
 		}
@@ -66,6 +115,9 @@ func (l *Lexer) Next() Token {
 		if l.peek() == '=' {
 			l.advance()
 			result = NewTokenWithMeta(EQ, "==", l.line, l.column)
+		} else if l.peek() == '>' {
+			l.advance()
+			result = NewTokenWithMeta(FatArrow, "=>", l.line, l.column)
 		} else {
 			result = NewTokenWithMeta(Assign, "=", l.line, l.column)
 		}
@@ -105,12 +157,29 @@ func (l *Lexer) Next() Token {
 	case '.':
 		if l.peek() == '.' {
 			l.advance()
-			result = NewTokenWithMeta(DotDot, "..", l.line, l.column)
+			if l.peek() == '.' {
+				l.advance()
+				result = NewTokenWithMeta(Ellipsis, "...", l.line, l.column)
+			} else {
+				result = NewTokenWithMeta(DotDot, "..", l.line, l.column)
+			}
 		} else {
 			result = NewTokenWithMeta(Dot, ".", l.line, l.column)
 		}
+	case '?':
+		if l.peek() == '.' {
+			l.advance()
+			result = NewTokenWithMeta(QuestionDot, "?.", l.line, l.column)
+		} else if l.peek() == '?' {
+			l.advance()
+			result = NewTokenWithMeta(Coalesce, "??", l.line, l.column)
+		} else {
+			result = NewTokenWithMeta(Question, "?", l.line, l.column)
+		}
 	case ';':
 		result = NewTokenWithMeta(SemiCol, ";", l.line, l.column)
+	case ':':
+		result = NewTokenWithMeta(Colon, ":", l.line, l.column)
 	case ',':
 		result = NewTokenWithMeta(Comma, ",", l.line, l.column)
 	case 0:
@@ -125,6 +194,7 @@ func (l *Lexer) Next() Token {
 		}
 	}
 	l.advance()
+	result.LineNumber, result.ColumnNumber = line, column
 	return result
 }
 
@@ -134,7 +204,8 @@ func (l *Lexer) ignoreWhiteSpace() {
 	for isWhiteSpace(l.current) {
 		if l.current == '\n' {
 			l.line++
-			l.column = 1
+			// The column is incremented when advancing past the new line.
+			l.column = 0
 		}
 		l.advance()
 	}
@@ -179,18 +250,24 @@ func identifierCharacter(c byte) bool {
 }
 
 // TODO add support for other kind of formats
-// examples: +1 -2 1.12 1e12 0x16 0777
+// examples: +1 -2 1e12 0x16 0777
+// Decimal numbers (1.12) need digits after the point, so that 1..2 is still a range.
 func (l *Lexer) readNumber() Token {
 	start := l.pos
-	for {
-		if !unicode.IsDigit(rune(l.peek())) {
-			break
-		}
+	l.readDigits()
+	if l.peek() == '.' && l.pos+2 < l.inputSize && unicode.IsDigit(rune(l.src[l.pos+2])) {
 		l.advance()
+		l.readDigits()
 	}
 	return NewTokenWithMeta(Number, l.src[start:l.pos+1], l.line, l.column)
 }
 
+func (l *Lexer) readDigits() {
+	for unicode.IsDigit(rune(l.peek())) {
+		l.advance()
+	}
+}
+
 func (l *Lexer) readString() Token {
 	start := l.pos + 1
 	// "some string"
@@ -15,6 +15,16 @@ func TestLexer_Next(t *testing.T) {
 			NewToken(Plus, "+"),
 			NewToken(Number, "2"),
 		}},
+		{`1.5 * 10.25 1..2 3.`, []Token{
+			NewToken(Number, "1.5"),
+			NewToken(Mul, "*"),
+			NewToken(Number, "10.25"),
+			NewToken(Number, "1"),
+			NewToken(DotDot, ".."),
+			NewToken(Number, "2"),
+			NewToken(Number, "3"),
+			NewToken(Dot, "."),
+		}},
 		{`+ / -  *+ & | ^`, []Token{
 			NewToken(Plus, "+"),
 			NewToken(Div, "/"),
@@ -77,6 +87,70 @@ func TestLexer_Next(t *testing.T) {
 			NewToken(Comma, ","),
 			NewToken(Identifier, "a"),
 		}},
+		{`a?.b ?? nil`, []Token{
+			NewToken(Identifier, "a"),
+			NewToken(QuestionDot, "?."),
+			NewToken(Identifier, "b"),
+			NewToken(Coalesce, "??"),
+			NewToken(Nil, "nil"),
+		}},
+		{`+= -= *= /= %= <<= >>= ++ -- % << >>`, []Token{
+			NewToken(PlusAssign, "+="),
+			NewToken(MinusAssign, "-="),
+			NewToken(MulAssign, "*="),
+			NewToken(DivAssign, "/="),
+			NewToken(ModAssign, "%="),
+			NewToken(LShiftAssign, "<<="),
+			NewToken(RShiftAssign, ">>="),
+			NewToken(Increment, "++"),
+			NewToken(Decrement, "--"),
+			NewToken(Mod, "%"),
+			NewToken(LSHIFT, "<<"),
+			NewToken(RSHIFT, ">>"),
+		}},
+		{`i++ + -1`, []Token{
+			NewToken(Identifier, "i"),
+			NewToken(Increment, "++"),
+			NewToken(Plus, "+"),
+			NewToken(Minus, "-"),
+			NewToken(Number, "1"),
+		}},
+		{`const`, []Token{
+			NewToken(Const, "const"),
+		}},
+		{`while break continue switch case default`, []Token{
+			NewToken(While, "while"),
+			NewToken(Break, "break"),
+			NewToken(Continue, "continue"),
+			NewToken(Switch, "switch"),
+			NewToken(Case, "case"),
+			NewToken(Default, "default"),
+		}},
+		{`a ? b : c`, []Token{
+			NewToken(Identifier, "a"),
+			NewToken(Question, "?"),
+			NewToken(Identifier, "b"),
+			NewToken(Colon, ":"),
+			NewToken(Identifier, "c"),
+		}},
+		{`match p { [a, ...rest] => {x: 1} }`, []Token{
+			NewToken(Match, "match"),
+			NewToken(Identifier, "p"),
+			NewToken(OpenBrace, "{"),
+			NewToken(OpenBracket, "["),
+			NewToken(Identifier, "a"),
+			NewToken(Comma, ","),
+			NewToken(Ellipsis, "..."),
+			NewToken(Identifier, "rest"),
+			NewToken(CloseBracket, "]"),
+			NewToken(FatArrow, "=>"),
+			NewToken(OpenBrace, "{"),
+			NewToken(Identifier, "x"),
+			NewToken(Colon, ":"),
+			NewToken(Number, "1"),
+			NewToken(CloseBrace, "}"),
+			NewToken(CloseBrace, "}"),
+		}},
 		{`func new return if else a for var true false in new struct`, []Token{
 			NewToken(Func, "func"),
 			NewToken(New, "new"),
@@ -162,6 +236,7 @@ func TestLexer_Next(t *testing.T) {
 			NewToken(CloseBrace, "}"),
 			NewToken(CloseBrace, "}"),
 		}},
+		{``, []Token{}},
 	}
 
 	for _, test := range tests {
@@ -176,6 +251,29 @@ func TestLexer_Next(t *testing.T) {
 	}
 }
 
+func TestLexer_NextPositions(t *testing.T) {
+	lexer := NewLexer("var ab = 12\n  ab >= \"s\"")
+	expected := []struct {
+		Literal      string
+		Line, Column int
+	}{
+		{"var", 1, 1},
+		{"ab", 1, 5},
+		{"=", 1, 8},
+		{"12", 1, 10},
+		{"ab", 2, 3},
+		{">=", 2, 6},
+		{"s", 2, 9},
+	}
+	tokens := consumeLexer(lexer)
+	assert.Equal(t, len(expected), len(tokens))
+	for i, token := range tokens {
+		assert.Equal(t, expected[i].Literal, token.Literal)
+		assert.Equal(t, expected[i].Line, token.LineNumber, token.Literal)
+		assert.Equal(t, expected[i].Column, token.ColumnNumber, token.Literal)
+	}
+}
+
 func consumeLexer(l *Lexer) []Token {
 	tokens := make([]Token, 0)
 	for currentToken := l.Next(); currentToken.Type != EOF; currentToken = l.Next() {
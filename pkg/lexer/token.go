@@ -39,8 +39,20 @@ const (
 	Minus = "-"
 	Mul   = "*"
 	Div   = "/"
+	Mod   = "%"
 	Bang  = "!"
 
+	// Assignment operators
+	PlusAssign   = "+="
+	MinusAssign  = "-="
+	MulAssign    = "*="
+	DivAssign    = "/="
+	ModAssign    = "%="
+	LShiftAssign = "<<="
+	RShiftAssign = ">>="
+	Increment    = "++"
+	Decrement    = "--"
+
 	// Logical operators
 	GT     = ">"
 	GTE    = ">="
@@ -61,6 +73,13 @@ const (
 	OROR   = "||"
 	ANDAND = "&&"
 
+	// Nil handling operators
+	QuestionDot = "?."
+	Coalesce    = "??"
+
+	// Conditional operator: test ? then : else
+	Question = "?"
+
 	// Structural tokens
 	OpenParent   = "("
 	CloseParent  = ")"
@@ -70,23 +89,38 @@ const (
 	CloseBrace   = "}"
 
 	// Keywords
-	Func   = "func"
-	New    = "new"
-	Struct = "struct"
-	Return = "return"
-	Var    = "var"
-	True   = "true"
-	False  = "false"
-	If     = "if"
-	Else   = "else"
-	For    = "for"
-	In     = "in"
+	Func     = "func"
+	New      = "new"
+	Struct   = "struct"
+	Return   = "return"
+	Var      = "var"
+	Const    = "const"
+	True     = "true"
+	False    = "false"
+	If       = "if"
+	Else     = "else"
+	For      = "for"
+	In       = "in"
+	Nil      = "nil"
+	While    = "while"
+	Break    = "break"
+	Continue = "continue"
+	Switch   = "switch"
+	Case     = "case"
+	Default  = "default"
+	Match    = "match"
+	Import   = "import"
 
 	// Seperators
 	Comma   = ","
 	Dot     = "."
 	DotDot  = ".."
 	SemiCol = ";"
+	Colon   = ":"
+
+	// Pattern matching
+	FatArrow = "=>"
+	Ellipsis = "..."
 
 	// Identifier
 	Identifier = "Identifier"
@@ -96,15 +130,25 @@ const (
 
 // All keywords recognized by comet.
 var Keywords = map[string]TokenType{
-	"func":   Func,
-	"new":    New,
-	"struct": Struct,
-	"return": Return,
-	"var":    Var,
-	"true":   True,
-	"false":  False,
-	"if":     If,
-	"else":   Else,
-	"for":    For,
-	"in":     In,
+	"func":     Func,
+	"new":      New,
+	"struct":   Struct,
+	"return":   Return,
+	"var":      Var,
+	"const":    Const,
+	"true":     True,
+	"false":    False,
+	"if":       If,
+	"else":     Else,
+	"for":      For,
+	"in":       In,
+	"nil":      Nil,
+	"while":    While,
+	"break":    Break,
+	"continue": Continue,
+	"switch":   Switch,
+	"case":     Case,
+	"default":  Default,
+	"match":    Match,
+	"import":   Import,
 }
@@ -0,0 +1,356 @@
+// Package optimize implements an optional pass rewriting the AST before evaluation.
+//
+// The Optimizer folds the operations on literals (2 * 60 * 60 becomes 7200), prunes the branches
+// of if statements and conditional expressions whose test is a boolean literal, and removes the
+// statements following a return, break or continue in the same block.
+// The rewritten program produces the same results as the original one.
+package optimize
+
+import (
+	"fmt"
+	"github.com/chermehdi/comet/pkg/eval"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+type Optimizer struct {
+	// Debug enables the report of the applied transformations.
+	Debug bool
+	// Report describes every applied transformation, in the order they were applied.
+	Report []string
+}
+
+func New() *Optimizer {
+	return &Optimizer{}
+}
+
+// Optimize rewrites the given program in place, and returns it.
+func (o *Optimizer) Optimize(root *parser.RootNode) *parser.RootNode {
+	root.Statements = o.optimizeStatements(root.Statements)
+	return root
+}
+
+func (o *Optimizer) report(format string, args ...interface{}) {
+	if o.Debug {
+		o.Report = append(o.Report, fmt.Sprintf(format, args...))
+	}
+}
+
+// optimizeStatements optimizes a list of statements evaluated in the same scope.
+func (o *Optimizer) optimizeStatements(statements []parser.Statement) []parser.Statement {
+	optimized := make([]parser.Statement, 0, len(statements))
+	for i, statement := range statements {
+		statement = o.optimizeStatement(statement)
+		last := i == len(statements)-1
+		if branch, ok := constantBranch(statement); ok && !last {
+			// Blocks of if statements don't create a scope, and the value of a statement which
+			// is not the last one is only used to propagate returns, breaks and continues.
+			optimized = append(optimized, branch.Statements...)
+		} else {
+			optimized = append(optimized, statement)
+		}
+		if !last && terminates(optimized) {
+			o.report("removed %d unreachable statement(s) after %s", len(statements)-i-1, describeStatement(optimized[len(optimized)-1]))
+			break
+		}
+	}
+	return optimized
+}
+
+// terminates reports whether the last statement unconditionally leaves the block.
+func terminates(statements []parser.Statement) bool {
+	if len(statements) == 0 {
+		return false
+	}
+	switch statements[len(statements)-1].(type) {
+	case *parser.ReturnStatement, *parser.BreakStatement, *parser.ContinueStatement:
+		return true
+	}
+	return false
+}
+
+func describeStatement(statement parser.Statement) string {
+	switch statement.(type) {
+	case *parser.BreakStatement:
+		return "break"
+	case *parser.ContinueStatement:
+		return "continue"
+	default:
+		return "return"
+	}
+}
+
+// constantBranch returns the branch that is always evaluated if the statement is an if statement
+// whose test is a boolean literal.
+func constantBranch(statement parser.Statement) (*parser.BlockStatement, bool) {
+	n, ok := statement.(*parser.IfStatement)
+	if !ok {
+		return nil, false
+	}
+	test, ok := n.Test.(*parser.BooleanLiteral)
+	if !ok {
+		return nil, false
+	}
+	if test.ActualValue {
+		return &n.Then, true
+	}
+	return &n.Else, true
+}
+
+func (o *Optimizer) optimizeBlock(block *parser.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		// Empty blocks may be shared (parser.EmptyBlock).
+		return
+	}
+	block.Statements = o.optimizeStatements(block.Statements)
+}
+
+func (o *Optimizer) optimizeStatement(statement parser.Statement) parser.Statement {
+	switch n := statement.(type) {
+	case *parser.BlockStatement:
+		o.optimizeBlock(n)
+	case *parser.IfStatement:
+		return o.optimizeIf(n)
+	case *parser.DeclarationStatement:
+		n.Expression = o.optimizeExpression(n.Expression)
+	case *parser.DestructuringStatement:
+		n.Expression = o.optimizeExpression(n.Expression)
+	case *parser.ReturnStatement:
+		n.Expression = o.optimizeExpression(n.Expression)
+	case *parser.FunctionStatement:
+		o.optimizeBlock(n.Block)
+	case *parser.StructDeclarationStatement:
+		for _, method := range n.Methods {
+			o.optimizeBlock(method.Block)
+		}
+	case *parser.ForStatement:
+		n.Range = o.optimizeExpression(n.Range)
+		o.optimizeBlock(n.Body)
+	case *parser.ForClauseStatement:
+		if n.Init != nil {
+			n.Init = o.optimizeStatement(n.Init)
+		}
+		n.Test = o.optimizeExpression(n.Test)
+		n.Post = o.optimizeExpression(n.Post)
+		o.optimizeBlock(n.Body)
+	case *parser.WhileStatement:
+		n.Test = o.optimizeExpression(n.Test)
+		o.optimizeBlock(n.Body)
+	case *parser.SwitchStatement:
+		n.Subject = o.optimizeExpression(n.Subject)
+		for _, c := range n.Cases {
+			for i, value := range c.Values {
+				c.Values[i] = o.optimizeExpression(value)
+			}
+			o.optimizeBlock(c.Body)
+		}
+		o.optimizeBlock(n.Default)
+	case parser.Expression:
+		return o.optimizeExpression(n)
+	}
+	return statement
+}
+
+// optimizeIf keeps the if statement, its value is the value of the evaluated branch.
+// The branch that is never evaluated is emptied when the test is constant.
+func (o *Optimizer) optimizeIf(n *parser.IfStatement) *parser.IfStatement {
+	n.Test = o.optimizeExpression(n.Test)
+	if test, ok := n.Test.(*parser.BooleanLiteral); ok {
+		o.report("pruned if statement with constant test %s", test.Token.Literal)
+		if !test.ActualValue {
+			n.Then = n.Else
+			test = newBoolean(true, test.Token)
+			n.Test = test
+		}
+		n.Else = *parser.EmptyBlock
+	}
+	o.optimizeBlock(&n.Then)
+	o.optimizeBlock(&n.Else)
+	return n
+}
+
+func (o *Optimizer) optimizeExpression(expression parser.Expression) parser.Expression {
+	switch n := expression.(type) {
+	case *parser.ParenthesisedExpression:
+		n.Expression = o.optimizeExpression(n.Expression)
+		if isLiteral(n.Expression) {
+			return n.Expression
+		}
+	case *parser.PrefixExpression:
+		n.Right = o.optimizeExpression(n.Right)
+		if folded, ok := foldPrefix(n); ok {
+			o.report("folded %s(%s) into %s", n.Op.Literal, describe(n.Right), describe(folded))
+			return folded
+		}
+	case *parser.BinaryExpression:
+		n.Left = o.optimizeExpression(n.Left)
+		n.Right = o.optimizeExpression(n.Right)
+		if folded, ok := foldBinary(n); ok {
+			o.report("folded %s %s %s into %s", describe(n.Left), n.Op.Literal, describe(n.Right), describe(folded))
+			return folded
+		}
+	case *parser.ConditionalExpression:
+		n.Test = o.optimizeExpression(n.Test)
+		n.Then = o.optimizeExpression(n.Then)
+		n.Else = o.optimizeExpression(n.Else)
+		if test, ok := n.Test.(*parser.BooleanLiteral); ok {
+			o.report("pruned conditional expression with constant test %s", test.Token.Literal)
+			if test.ActualValue {
+				return n.Then
+			}
+			return n.Else
+		}
+	case *parser.IfStatement:
+		return o.optimizeIf(n)
+	case *parser.ArrayLiteral:
+		for i, element := range n.Elements {
+			n.Elements[i] = o.optimizeExpression(element)
+		}
+	case *parser.CallExpression:
+		for i, argument := range n.Arguments {
+			n.Arguments[i] = o.optimizeExpression(argument)
+		}
+	case *parser.NewCallExpr:
+		for i, argument := range n.Args {
+			n.Args[i] = o.optimizeExpression(argument)
+		}
+	case *parser.AssignExpression:
+		n.Value = o.optimizeExpression(n.Value)
+	case *parser.IndexAccess:
+		n.Identifier = o.optimizeExpression(n.Identifier)
+		n.Index = o.optimizeExpression(n.Index)
+	case *parser.SliceExpression:
+		n.Target = o.optimizeExpression(n.Target)
+		n.Start = o.optimizeExpression(n.Start)
+		n.Stop = o.optimizeExpression(n.Stop)
+		n.Step = o.optimizeExpression(n.Step)
+	case *parser.IndexAssignExpression:
+		n.Target.Identifier = o.optimizeExpression(n.Target.Identifier)
+		n.Target.Index = o.optimizeExpression(n.Target.Index)
+		n.Value = o.optimizeExpression(n.Value)
+	case *parser.MatchExpression:
+		// Literal patterns are kept as written, they are part of the error messages.
+		n.Subject = o.optimizeExpression(n.Subject)
+		for _, arm := range n.Arms {
+			o.optimizeBlock(arm.Body)
+		}
+	}
+	return expression
+}
+
+func foldPrefix(n *parser.PrefixExpression) (parser.Expression, bool) {
+	switch right := n.Right.(type) {
+	case *parser.NumberLiteral:
+		if n.Op.Type == lexer.Minus && right.ActualValue != math.MinInt64 {
+			return &parser.NumberLiteral{ActualValue: -right.ActualValue}, true
+		}
+	case *parser.BigIntLiteral:
+		if n.Op.Type == lexer.Minus {
+			return &parser.BigIntLiteral{ActualValue: new(big.Int).Neg(right.ActualValue)}, true
+		}
+	case *parser.FloatLiteral:
+		if n.Op.Type == lexer.Minus {
+			return &parser.FloatLiteral{ActualValue: -right.ActualValue}, true
+		}
+	case *parser.BooleanLiteral:
+		if n.Op.Type == lexer.Bang {
+			return newBoolean(!right.ActualValue, n.Op), true
+		}
+	}
+	return nil, false
+}
+
+func foldBinary(n *parser.BinaryExpression) (folded parser.Expression, ok bool) {
+	if !isLiteral(n.Left) || !isLiteral(n.Right) {
+		return nil, false
+	}
+	switch n.Op.Type {
+	case lexer.Dot, lexer.QuestionDot, lexer.Coalesce, lexer.DotDot:
+		return nil, false
+	case lexer.ANDAND, lexer.OROR:
+		// The truth value of the other literals depends on the strict mode of the evaluator.
+		left, isBool := n.Left.(*parser.BooleanLiteral)
+		right, bothBool := n.Right.(*parser.BooleanLiteral)
+		if !isBool || !bothBool {
+			return nil, false
+		}
+		if n.Op.Type == lexer.ANDAND {
+			return newBoolean(left.ActualValue && right.ActualValue, n.Op), true
+		}
+		return newBoolean(left.ActualValue || right.ActualValue, n.Op), true
+	}
+	defer func() {
+		// Operations that would panic at runtime (e.g. repeating a string a negative number of
+		// times) are not folded.
+		if recover() != nil {
+			folded, ok = nil, false
+		}
+	}()
+	return toLiteral(eval.ApplyBinaryOperator(n.Op, literalValue(n.Left), literalValue(n.Right)), n.Op)
+}
+
+func isLiteral(expression parser.Expression) bool {
+	switch expression.(type) {
+	case *parser.NumberLiteral, *parser.BigIntLiteral, *parser.FloatLiteral, *parser.StringLiteral, *parser.BooleanLiteral, *parser.NilLiteral:
+		return true
+	}
+	return false
+}
+
+// literalValue computes the value of a literal, like the evaluator does.
+func literalValue(expression parser.Expression) std.CometObject {
+	switch n := expression.(type) {
+	case *parser.NumberLiteral:
+		return &std.CometInt{Value: n.ActualValue}
+	case *parser.BigIntLiteral:
+		return &std.CometBigInt{Value: n.ActualValue}
+	case *parser.FloatLiteral:
+		return &std.CometFloat{Value: n.ActualValue}
+	case *parser.StringLiteral:
+		return &std.CometStr{Value: n.Value, Size: len(n.Value)}
+	case *parser.BooleanLiteral:
+		if n.ActualValue {
+			return std.TrueObject
+		}
+		return std.FalseObject
+	default:
+		return std.NilObject
+	}
+}
+
+// toLiteral converts a computed value back to a literal, errors and values that have no literal
+// representation (e.g. arrays) are not folded.
+func toLiteral(value std.CometObject, position lexer.Token) (parser.Expression, bool) {
+	switch v := value.(type) {
+	case *std.CometInt:
+		return &parser.NumberLiteral{ActualValue: v.Value}, true
+	case *std.CometBigInt:
+		return &parser.BigIntLiteral{ActualValue: v.Value}, true
+	case *std.CometFloat:
+		return &parser.FloatLiteral{ActualValue: v.Value}, true
+	case *std.CometStr:
+		return &parser.StringLiteral{Value: v.Value}, true
+	case *std.CometBool:
+		return newBoolean(v.Value, position), true
+	}
+	return nil, false
+}
+
+func newBoolean(value bool, position lexer.Token) *parser.BooleanLiteral {
+	token := lexer.NewTokenWithMeta(lexer.False, lexer.False, position.LineNumber, position.ColumnNumber)
+	if value {
+		token = lexer.NewTokenWithMeta(lexer.True, lexer.True, position.LineNumber, position.ColumnNumber)
+	}
+	return &parser.BooleanLiteral{ActualValue: value, Token: token}
+}
+
+func describe(expression parser.Expression) string {
+	if s, ok := expression.(*parser.StringLiteral); ok {
+		return strconv.Quote(s.Value)
+	}
+	return expression.Literal()
+}
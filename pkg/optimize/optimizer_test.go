@@ -0,0 +1,80 @@
+package optimize
+
+import (
+	"bytes"
+	"github.com/chermehdi/comet/pkg/eval"
+	"github.com/chermehdi/comet/pkg/internal/enginetest"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func parseOrDie(t *testing.T, src string) *parser.RootNode {
+	p := parser.New(src)
+	root := p.Parse()
+	assert.False(t, p.Errors.HasAny(), p.Errors.String())
+	return root
+}
+
+func TestOptimizer_Optimize(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+		Report   []string
+	}{
+		{"2 * 60 * 60", "CometInt(7200)", []string{"folded 2 * 60 into 120", "folded 120 * 60 into 7200"}},
+		{`"a" * 3`, `CometStr("aaa")`, []string{`folded "a" * 3 into "aaa"`}},
+		{"-(1 + 2)", "CometInt(-3)", []string{"folded 1 + 2 into 3", "folded -(3) into -3"}},
+		{"!(1 < 2) || false", "CometBool(false)", []string{"folded 1 < 2 into true", "folded !(true) into false", "folded false || false into false"}},
+		{"var a = 1\n if 1 > 2 { a = 2 } else { a = 3 }\n a", "CometInt(3)", []string{"folded 1 > 2 into false", "pruned if statement with constant test false"}},
+		{"if true { 1 } else { 2 }", "CometInt(1)", []string{"pruned if statement with constant test true"}},
+		{"if false { 1 }", "CometNil", []string{"pruned if statement with constant test false"}},
+		{"true ? 1 : 2", "CometInt(1)", []string{"pruned conditional expression with constant test true"}},
+		{"func f() {\n return 1\n println(2)\n 3\n }\n f()", "CometInt(1)", []string{"removed 2 unreachable statement(s) after return"}},
+		{"func f() {\n if true { return 1 }\n return 2\n }\n f()", "CometInt(1)", []string{"pruned if statement with constant test true", "removed 1 unreachable statement(s) after return"}},
+		{"var s = 0\n for i in 0..3 {\n s += i\n continue\n s += 10\n }\n s", "CometInt(6)", []string{"removed 1 unreachable statement(s) after continue"}},
+		// Errors are left to the evaluation.
+		{"1 / 0", "Comet error: \n\n\tDivision by zero", nil},
+		{"[1, 2] + 3", "", nil},
+	}
+	for _, test := range tests {
+		original := eval.NewEvaluator().Eval(parseOrDie(t, test.Src))
+		optimizer := New()
+		optimizer.Debug = true
+		root := optimizer.Optimize(parseOrDie(t, test.Src))
+		assert.Equal(t, test.Report, optimizer.Report, test.Src)
+		if test.Expected != "" {
+			assert.Equal(t, test.Expected, original.ToString(), test.Src)
+		}
+		assert.Equal(t, original.ToString(), eval.NewEvaluator().Eval(root).ToString(), test.Src)
+	}
+}
+
+func TestOptimizer_Optimize_ReportOnlyInDebug(t *testing.T) {
+	optimizer := New()
+	optimizer.Optimize(parseOrDie(t, "1 + 2"))
+	assert.Empty(t, optimizer.Report)
+}
+
+// Optimized programs should produce the same results, every program of the evaluator tests is
+// evaluated with and without optimizations.
+func TestOptimizer_Optimize_MatchesEvaluator(t *testing.T) {
+	tests, err := enginetest.EvaluatorPrograms("../eval/evaluator_test.go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, test := range tests {
+		evaluator, optimized := eval.NewEvaluator(), eval.NewEvaluator()
+		var evaluatorOutput, optimizedOutput bytes.Buffer
+		evaluator.Stdout, optimized.Stdout = &evaluatorOutput, &optimizedOutput
+		for _, program := range test.Programs {
+			evaluator.Strict, optimized.Strict = program.Strict, program.Strict
+			root, _ := enginetest.Parse(program.Src)
+			expected := evaluator.Eval(root).ToString()
+			root, _ = enginetest.Parse(program.Src)
+			actual := optimized.Eval(New().Optimize(root)).ToString()
+			assert.Equal(t, expected, actual, "%s: %s", test.Name, program.Src)
+			assert.Equal(t, evaluatorOutput.String(), optimizedOutput.String(), "%s: %s", test.Name, program.Src)
+		}
+	}
+}
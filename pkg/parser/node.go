@@ -3,6 +3,9 @@ package parser
 import (
 	"fmt"
 	lexer2 "github.com/chermehdi/comet/pkg/lexer"
+	"math/big"
+	"strconv"
+	"strings"
 )
 
 // NodeVisitor is the API provided by all nodes types.
@@ -21,8 +24,12 @@ type NodeVisitor interface {
 	VisitRootNode(RootNode)
 	VisitBinaryExpression(BinaryExpression)
 	VisitPrefixExpression(PrefixExpression)
+	VisitConditionalExpression(ConditionalExpression)
 	VisitNumberLiteral(NumberLiteral)
+	VisitBigIntLiteral(BigIntLiteral)
+	VisitFloatLiteral(FloatLiteral)
 	VisitBooleanLiteral(BooleanLiteral)
+	VisitNilLiteral(NilLiteral)
 	VisitStringLiteral(StringLiteral)
 	VisitArrayLiteral(ArrayLiteral)
 	VisitParenthesisedExpression(ParenthesisedExpression)
@@ -30,15 +37,32 @@ type NodeVisitor interface {
 	VisitCallExpression(CallExpression)
 	VisitAssignExpression(AssignExpression)
 	VisitArrayAccess(IndexAccess)
+	VisitSliceExpression(SliceExpression)
+	VisitIndexAssignExpression(IndexAssignExpression)
 	VisitNewCall(NewCallExpr)
+	VisitMatchExpression(MatchExpression)
+
+	VisitWildcardPattern(WildcardPattern)
+	VisitBindingPattern(BindingPattern)
+	VisitLiteralPattern(LiteralPattern)
+	VisitArrayPattern(ArrayPattern)
+	VisitObjectPattern(ObjectPattern)
+	VisitStructPattern(StructPattern)
 
 	VisitDeclarationStatement(DeclarationStatement)
+	VisitDestructuringStatement(DestructuringStatement)
 	VisitReturnStatement(ReturnStatement)
 	VisitBlockStatement(BlockStatement)
 	VisitIfStatement(IfStatement)
 	VisitFunctionStatement(FunctionStatement)
 	VisitForStatement(ForStatement)
+	VisitForClauseStatement(ForClauseStatement)
+	VisitWhileStatement(WhileStatement)
+	VisitSwitchStatement(SwitchStatement)
+	VisitBreakStatement(BreakStatement)
+	VisitContinueStatement(ContinueStatement)
 	VisitStructDeclaration(StructDeclarationStatement)
+	VisitImportStatement(ImportStatement)
 }
 
 type Node interface {
@@ -120,6 +144,30 @@ func (p *PrefixExpression) Expr() {
 	panic("implement me")
 }
 
+// ConditionalExpression is the ternary operator: test ? then : else
+// Only the selected branch is evaluated.
+type ConditionalExpression struct {
+	Test Expression
+	Then Expression
+	Else Expression
+}
+
+func (c *ConditionalExpression) Accept(visitor NodeVisitor) {
+	visitor.VisitConditionalExpression(*c)
+}
+
+func (c *ConditionalExpression) Literal() string {
+	return "?"
+}
+
+func (c *ConditionalExpression) Statement() {
+	panic("implement me")
+}
+
+func (c *ConditionalExpression) Expr() {
+	panic("implement me")
+}
+
 type ParenthesisedExpression struct {
 	Expression Expression
 }
@@ -141,7 +189,8 @@ func (p *ParenthesisedExpression) Expr() {
 }
 
 type IdentifierExpression struct {
-	Name string
+	Name  string
+	Token lexer2.Token
 }
 
 func (i *IdentifierExpression) Literal() string {
@@ -160,10 +209,13 @@ func (i *IdentifierExpression) Expr() {
 	panic("implement me")
 }
 
+// DeclarationStatement declares a variable: var name = expression
+// Constants (const name = expression) can't be reassigned or redeclared in the same scope.
 type DeclarationStatement struct {
 	varToken   lexer2.Token
 	Identifier lexer2.Token
 	Expression Expression
+	Constant   bool
 }
 
 func (d *DeclarationStatement) Literal() string {
@@ -216,6 +268,27 @@ func (b *BooleanLiteral) Expr() {
 	panic("implement me")
 }
 
+// NilLiteral represents the `nil` keyword, the absence of a value.
+type NilLiteral struct {
+	Token lexer2.Token
+}
+
+func (n *NilLiteral) Literal() string {
+	return n.Token.Literal
+}
+
+func (n *NilLiteral) Accept(visitor NodeVisitor) {
+	visitor.VisitNilLiteral(*n)
+}
+
+func (n *NilLiteral) Statement() {
+	panic("implement me")
+}
+
+func (n *NilLiteral) Expr() {
+	panic("implement me")
+}
+
 // Empty block for AST nodes when the block statement is optional
 // This is instance is used to make the comparison easy.
 var EmptyBlock = &BlockStatement{
@@ -256,6 +329,11 @@ func (i *IfStatement) Statement() {
 	panic("implement me")
 }
 
+// If statements can be used as expressions, their value is the value of the chosen branch.
+func (i *IfStatement) Expr() {
+	panic("implement me")
+}
+
 func newIfStatement() *IfStatement {
 	return &IfStatement{
 		Then: *EmptyBlock,
@@ -263,6 +341,33 @@ func newIfStatement() *IfStatement {
 	}
 }
 
+// SwitchStatement evaluates the body of the first case matching the subject, there is no
+// fallthrough between cases. If no case matches, the Default block is evaluated.
+type SwitchStatement struct {
+	Subject Expression
+	Cases   []*SwitchCase
+	Default *BlockStatement // this can be empty
+}
+
+// SwitchCase is a single arm of a switch statement, it matches if any of its values
+// is equal to the subject, or contains it if the value is a range.
+type SwitchCase struct {
+	Values []Expression
+	Body   *BlockStatement
+}
+
+func (s *SwitchStatement) Literal() string {
+	return "SwitchStatement"
+}
+
+func (s *SwitchStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitSwitchStatement(*s)
+}
+
+func (s *SwitchStatement) Statement() {
+	panic("implement me")
+}
+
 type ForStatement struct {
 	Key   *IdentifierExpression
 	Value *IdentifierExpression
@@ -282,6 +387,76 @@ func (f *ForStatement) Statement() {
 	panic("implement me")
 }
 
+// ForClauseStatement is the three-clause C-style loop: for init; test; post { body }
+// Every clause is optional, a nil Test means the loop runs until a break or return.
+type ForClauseStatement struct {
+	Init Statement
+	Test Expression
+	Post Expression
+	Body *BlockStatement
+}
+
+func (f *ForClauseStatement) Literal() string {
+	return "ForClauseStatement"
+}
+
+func (f *ForClauseStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitForClauseStatement(*f)
+}
+
+func (f *ForClauseStatement) Statement() {
+	panic("implement me")
+}
+
+type WhileStatement struct {
+	Test Expression
+	Body *BlockStatement
+}
+
+func (w *WhileStatement) Literal() string {
+	return "WhileStatement"
+}
+
+func (w *WhileStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitWhileStatement(*w)
+}
+
+func (w *WhileStatement) Statement() {
+	panic("implement me")
+}
+
+type BreakStatement struct {
+	Token lexer2.Token
+}
+
+func (b *BreakStatement) Literal() string {
+	return b.Token.Literal
+}
+
+func (b *BreakStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitBreakStatement(*b)
+}
+
+func (b *BreakStatement) Statement() {
+	panic("implement me")
+}
+
+type ContinueStatement struct {
+	Token lexer2.Token
+}
+
+func (c *ContinueStatement) Literal() string {
+	return c.Token.Literal
+}
+
+func (c *ContinueStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitContinueStatement(*c)
+}
+
+func (c *ContinueStatement) Statement() {
+	panic("implement me")
+}
+
 type FunctionStatement struct {
 	Name       string
 	Parameters []*IdentifierExpression
@@ -310,6 +485,7 @@ func newFunctionStatement() *FunctionStatement {
 type CallExpression struct {
 	Name      string
 	Arguments []Expression
+	Token     lexer2.Token
 }
 
 func (c *CallExpression) Literal() string {
@@ -328,9 +504,14 @@ func (c *CallExpression) Expr() {
 	panic("implement me")
 }
 
+// AssignExpression assigns a value to a variable (or a field when used on the right side of a '.').
+// Compound assignments (a += b) and increments (a++) are represented with the binary
+// operator they apply in Op, for plain assignments Op is the zero Token.
 type AssignExpression struct {
 	VarName string
+	Op      lexer2.Token
 	Value   Expression
+	Token   lexer2.Token
 }
 
 func (a *AssignExpression) Literal() string {
@@ -358,7 +539,7 @@ func (n *NumberLiteral) Accept(visitor NodeVisitor) {
 }
 
 func (n *NumberLiteral) Literal() string {
-	panic("implement me")
+	return strconv.FormatInt(n.ActualValue, 10)
 }
 
 func (n *NumberLiteral) Statement() {
@@ -369,6 +550,48 @@ func (n *NumberLiteral) Expr() {
 	panic("implement me")
 }
 
+// BigIntLiteral is a number literal that does not fit in an int64.
+type BigIntLiteral struct {
+	ActualValue *big.Int
+}
+
+func (n *BigIntLiteral) Accept(visitor NodeVisitor) {
+	visitor.VisitBigIntLiteral(*n)
+}
+
+func (n *BigIntLiteral) Literal() string {
+	return n.ActualValue.String()
+}
+
+func (n *BigIntLiteral) Statement() {
+	panic("implement me")
+}
+
+func (n *BigIntLiteral) Expr() {
+	panic("implement me")
+}
+
+// FloatLiteral is a decimal number literal (e.g. 1.5).
+type FloatLiteral struct {
+	ActualValue float64
+}
+
+func (n *FloatLiteral) Accept(visitor NodeVisitor) {
+	visitor.VisitFloatLiteral(*n)
+}
+
+func (n *FloatLiteral) Literal() string {
+	return strconv.FormatFloat(n.ActualValue, 'g', -1, 64)
+}
+
+func (n *FloatLiteral) Statement() {
+	panic("implement me")
+}
+
+func (n *FloatLiteral) Expr() {
+	panic("implement me")
+}
+
 type StringLiteral struct {
 	Value string
 }
@@ -430,6 +653,55 @@ func (i *IndexAccess) Expr() {
 	panic("implement me")
 }
 
+// SliceExpression selects a part of an array or a string: a[start:stop:step]
+// Every bound is optional and is nil if omitted.
+type SliceExpression struct {
+	Target Expression
+	Start  Expression
+	Stop   Expression
+	Step   Expression
+}
+
+func (s *SliceExpression) Literal() string {
+	return "SliceExpression"
+}
+
+func (s *SliceExpression) Accept(visitor NodeVisitor) {
+	visitor.VisitSliceExpression(*s)
+}
+
+func (s *SliceExpression) Statement() {
+	panic("implement me")
+}
+
+func (s *SliceExpression) Expr() {
+	panic("implement me")
+}
+
+// IndexAssignExpression assigns a value to an element of an indexable value: a[i] = value.
+// Op follows the same rules as in AssignExpression.
+type IndexAssignExpression struct {
+	Target *IndexAccess
+	Op     lexer2.Token
+	Value  Expression
+}
+
+func (i *IndexAssignExpression) Literal() string {
+	return "IndexAssignExpression"
+}
+
+func (i *IndexAssignExpression) Accept(visitor NodeVisitor) {
+	visitor.VisitIndexAssignExpression(*i)
+}
+
+func (i *IndexAssignExpression) Statement() {
+	panic("implement me")
+}
+
+func (i *IndexAssignExpression) Expr() {
+	panic("implement me")
+}
+
 type StructDeclarationStatement struct {
 	Name    string
 	Methods []*FunctionStatement
@@ -448,8 +720,11 @@ func (s *StructDeclarationStatement) Accept(visitor NodeVisitor) {
 }
 
 type NewCallExpr struct {
-	Type string
-	Args []Expression
+	// Module is the name bound to the module declaring the type, `new m.Type()`, it's empty for
+	// the types of the current module.
+	Module string
+	Type   string
+	Args   []Expression
 }
 
 func (n *NewCallExpr) Expr() {
@@ -467,3 +742,245 @@ func (n *NewCallExpr) Literal() string {
 func (n *NewCallExpr) Accept(visitor NodeVisitor) {
 	visitor.VisitNewCall(*n)
 }
+
+// ImportStatement evaluates a module and binds it to Alias, `import "path" as alias`, or binds
+// some of its members to variables of the same name, `import { a, b } from "path"`.
+type ImportStatement struct {
+	Token lexer2.Token
+	Path  string
+	// Alias is empty for selective imports.
+	Alias string
+	Names []*IdentifierExpression
+}
+
+func (i *ImportStatement) Literal() string {
+	return i.Token.Literal
+}
+
+func (i *ImportStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitImportStatement(*i)
+}
+
+func (i *ImportStatement) Statement() {
+	panic("implement me")
+}
+
+// MatchExpression evaluates the body of the first arm whose pattern matches the subject,
+// the value of the expression is the value of the evaluated body.
+type MatchExpression struct {
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// MatchArm is a single `pattern => body` arm of a match expression, names bound by the
+// pattern are only visible inside the body.
+// Arms with an expression body are represented as a block holding that single expression.
+type MatchArm struct {
+	Pattern Pattern
+	Body    *BlockStatement
+}
+
+func (m *MatchExpression) Literal() string {
+	return "MatchExpression"
+}
+
+func (m *MatchExpression) Accept(visitor NodeVisitor) {
+	visitor.VisitMatchExpression(*m)
+}
+
+func (m *MatchExpression) Statement() {
+	panic("implement me")
+}
+
+func (m *MatchExpression) Expr() {
+	panic("implement me")
+}
+
+// DestructuringStatement declares every name bound by the pattern: var [a, b] = pair
+// The bound names are constants if the statement starts with const.
+type DestructuringStatement struct {
+	Pattern    Pattern
+	Expression Expression
+	Constant   bool
+}
+
+func (d *DestructuringStatement) Literal() string {
+	if d.Constant {
+		return "const " + d.Pattern.Literal()
+	}
+	return "var " + d.Pattern.Literal()
+}
+
+func (d *DestructuringStatement) Accept(visitor NodeVisitor) {
+	visitor.VisitDestructuringStatement(*d)
+}
+
+func (d *DestructuringStatement) Statement() {
+	panic("implement me")
+}
+
+// Pattern describes the shape of a value, used by match arms and destructuring declarations.
+// The Literal of a pattern is its source representation.
+type Pattern interface {
+	Node
+	Pattern()
+}
+
+// WildcardPattern `_` matches any value without binding it.
+type WildcardPattern struct{}
+
+func (w *WildcardPattern) Literal() string {
+	return "_"
+}
+
+func (w *WildcardPattern) Accept(visitor NodeVisitor) {
+	visitor.VisitWildcardPattern(*w)
+}
+
+func (w *WildcardPattern) Pattern() {}
+
+// BindingPattern matches any value and binds it to Name.
+type BindingPattern struct {
+	Name string
+}
+
+func (b *BindingPattern) Literal() string {
+	return b.Name
+}
+
+func (b *BindingPattern) Accept(visitor NodeVisitor) {
+	visitor.VisitBindingPattern(*b)
+}
+
+func (b *BindingPattern) Pattern() {}
+
+// LiteralPattern matches values equal to Value, or contained in it if Value is a range.
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (l *LiteralPattern) Literal() string {
+	return sourceOf(l.Value)
+}
+
+// sourceOf renders the source of the literal expressions allowed in patterns.
+func sourceOf(expression Expression) string {
+	switch e := expression.(type) {
+	case *StringLiteral:
+		return strconv.Quote(e.Value)
+	case *ParenthesisedExpression:
+		return "(" + sourceOf(e.Expression) + ")"
+	case *PrefixExpression:
+		return e.Op.Literal + sourceOf(e.Right)
+	case *BinaryExpression:
+		if e.Op.Type == lexer2.DotDot {
+			return sourceOf(e.Left) + e.Op.Literal + sourceOf(e.Right)
+		}
+		return sourceOf(e.Left) + " " + e.Op.Literal + " " + sourceOf(e.Right)
+	default:
+		return expression.Literal()
+	}
+}
+
+func (l *LiteralPattern) Accept(visitor NodeVisitor) {
+	visitor.VisitLiteralPattern(*l)
+}
+
+func (l *LiteralPattern) Pattern() {}
+
+// ArrayPattern matches arrays element by element: [a, b, ...rest]
+// Without a Rest pattern the array should have exactly as many elements as the pattern,
+// otherwise the remaining elements are matched against Rest as a new array.
+type ArrayPattern struct {
+	Elements []Pattern
+	Rest     Pattern // nil if the pattern has no rest element
+}
+
+func (a *ArrayPattern) Literal() string {
+	parts := make([]string, 0, len(a.Elements)+1)
+	for _, element := range a.Elements {
+		parts = append(parts, element.Literal())
+	}
+	if a.Rest != nil {
+		parts = append(parts, "..."+a.Rest.Literal())
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func (a *ArrayPattern) Accept(visitor NodeVisitor) {
+	visitor.VisitArrayPattern(*a)
+}
+
+func (a *ArrayPattern) Pattern() {}
+
+// ObjectPattern matches objects having all the listed fields: {name: n, age}
+// A field without a pattern binds the field's value to its own name.
+type ObjectPattern struct {
+	Fields []*FieldPattern
+}
+
+type FieldPattern struct {
+	Name    string
+	Pattern Pattern
+}
+
+func (o *ObjectPattern) Literal() string {
+	parts := make([]string, 0, len(o.Fields))
+	for _, field := range o.Fields {
+		parts = append(parts, field.Name+": "+field.Pattern.Literal())
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (o *ObjectPattern) Accept(visitor NodeVisitor) {
+	visitor.VisitObjectPattern(*o)
+}
+
+func (o *ObjectPattern) Pattern() {}
+
+// StructPattern matches instances of the struct Type: Point(x, y)
+// Elements are matched against the fields named after the parameters of the struct's
+// constructor, in order.
+type StructPattern struct {
+	Type     string
+	Elements []Pattern
+}
+
+func (s *StructPattern) Literal() string {
+	parts := make([]string, 0, len(s.Elements))
+	for _, element := range s.Elements {
+		parts = append(parts, element.Literal())
+	}
+	return s.Type + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (s *StructPattern) Accept(visitor NodeVisitor) {
+	visitor.VisitStructPattern(*s)
+}
+
+func (s *StructPattern) Pattern() {}
+
+// PatternNames returns the names bound by the pattern, in order of appearance.
+func PatternNames(pattern Pattern) []string {
+	names := make([]string, 0)
+	switch p := pattern.(type) {
+	case *BindingPattern:
+		names = append(names, p.Name)
+	case *ArrayPattern:
+		for _, element := range p.Elements {
+			names = append(names, PatternNames(element)...)
+		}
+		if p.Rest != nil {
+			names = append(names, PatternNames(p.Rest)...)
+		}
+	case *ObjectPattern:
+		for _, field := range p.Fields {
+			names = append(names, PatternNames(field.Pattern)...)
+		}
+	case *StructPattern:
+		for _, element := range p.Elements {
+			names = append(names, PatternNames(element)...)
+		}
+	}
+	return names
+}
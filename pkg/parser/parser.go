@@ -3,19 +3,28 @@ package parser
 import (
 	"fmt"
 	"github.com/chermehdi/comet/pkg/lexer"
+	"math/big"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Lower binds stronger
 const (
 	MINIMUM = iota
+	TERNARY
+	COALESCE
+	OROR
+	ANDAND
 	LOG
+	RANGE
 	ADD
 	MUL
+	PREFIX
+	// Member access and indexing share the same precedence so that a.b[0] and a[0].b
+	// are both evaluated from left to right.
 	DOT
-	PARENT
-	Index
 )
 
 var precedences = map[lexer.TokenType]int{
@@ -23,6 +32,9 @@ var precedences = map[lexer.TokenType]int{
 	lexer.Minus:       ADD,
 	lexer.Mul:         MUL,
 	lexer.Div:         MUL,
+	lexer.Mod:         MUL,
+	lexer.LSHIFT:      MUL,
+	lexer.RSHIFT:      MUL,
 	lexer.LT:          LOG,
 	lexer.LTE:         LOG,
 	lexer.GT:          LOG,
@@ -30,8 +42,13 @@ var precedences = map[lexer.TokenType]int{
 	lexer.EQ:          LOG,
 	lexer.NEQ:         LOG,
 	lexer.Dot:         DOT,
-	lexer.DotDot:      PARENT,
-	lexer.OpenBracket: Index,
+	lexer.QuestionDot: DOT,
+	lexer.Coalesce:    COALESCE,
+	lexer.Question:    TERNARY,
+	lexer.OROR:        OROR,
+	lexer.ANDAND:      ANDAND,
+	lexer.DotDot:      RANGE,
+	lexer.OpenBracket: DOT,
 }
 
 func getPrecedence(token lexer.Token) int {
@@ -82,6 +99,18 @@ func newErrorBag() *ErrorBag {
 	}
 }
 
+// declaration is a name declared while parsing, used to diagnose constant reassignments
+// and redeclarations before evaluation.
+type declaration struct {
+	constant bool
+	// Id of the block holding the declaration
+	block int
+}
+
+// declarationScope mirrors the scopes created by the evaluator: the root node, function bodies,
+// loop bodies and match arms. The blocks of if and switch statements don't create a scope.
+type declarationScope map[string]declaration
+
 // Functions of this type are going to be used to parse binary operations such as addition subtraction ...
 // The first parameters is the already parsed left side of the operator and the function should parse
 
@@ -101,6 +130,17 @@ type Parser struct {
 	Errors      *ErrorBag
 	prefixFuncs map[lexer.TokenType]prefixParseFunction
 	binaryFuncs map[lexer.TokenType]binaryParseFunction
+
+	// Number of loops enclosing the current statement, used to validate break and continue.
+	loopDepth int
+
+	// Names declared in the scopes enclosing the current statement, innermost last.
+	scopes []declarationScope
+	// Id of the block enclosing the current statement, and the number of parsed blocks.
+	currentBlock int
+	blockCount   int
+	// Set while parsing the right side of a member access, a.b = c assigns a field and not a variable.
+	memberAccess bool
 }
 
 func New(src string) *Parser {
@@ -108,6 +148,7 @@ func New(src string) *Parser {
 	parser := &Parser{
 		lex:    lex,
 		Errors: newErrorBag(),
+		scopes: []declarationScope{make(declarationScope)},
 	}
 	parser.init()
 	return parser
@@ -126,16 +167,21 @@ func (p *Parser) init() {
 	p.registerPrefixFunc(p.parsePrefixExpression, lexer.Minus, lexer.Bang)
 	p.registerPrefixFunc(p.parseIdentifier, lexer.Identifier)
 	p.registerPrefixFunc(p.parseBoolean, lexer.True, lexer.False)
+	p.registerPrefixFunc(p.parseNil, lexer.Nil)
 	p.registerPrefixFunc(p.parseParenthesisedExpression, lexer.OpenParent)
 	p.registerPrefixFunc(p.parseStringLiteral, lexer.String)
 	p.registerPrefixFunc(p.parseArrayLiteral, lexer.OpenBracket)
 	p.registerPrefixFunc(p.parseNewCall, lexer.New)
+	p.registerPrefixFunc(p.parseMatchExpression, lexer.Match)
+	p.registerPrefixFunc(p.parseIfExpression, lexer.If)
 
 	// Register functions to parse all operators that are of the form `expression op expresion`
 	p.registerPrefixFunc(p.parseNumberLiteral, lexer.Number)
 	p.registerBinaryFunc(p.parseArrayAccess, lexer.OpenBracket)
-	p.registerBinaryFunc(p.parseBinaryExpression, lexer.Plus, lexer.Mul, lexer.Minus, lexer.Div,
-		lexer.GT, lexer.GTE, lexer.LT, lexer.LTE, lexer.EQ, lexer.NEQ, lexer.Dot, lexer.DotDot)
+	p.registerBinaryFunc(p.parseConditionalExpression, lexer.Question)
+	p.registerBinaryFunc(p.parseBinaryExpression, lexer.Plus, lexer.Mul, lexer.Minus, lexer.Div, lexer.Mod, lexer.LSHIFT, lexer.RSHIFT,
+		lexer.GT, lexer.GTE, lexer.LT, lexer.LTE, lexer.EQ, lexer.NEQ, lexer.Dot, lexer.DotDot,
+		lexer.QuestionDot, lexer.Coalesce, lexer.ANDAND, lexer.OROR)
 }
 
 // Utility method to enable prefix function registration for given token types.
@@ -178,7 +224,7 @@ func (p *Parser) Parse() *RootNode {
 // the Grammar of the language allows us to. Otherwise fallback to try and parse an expression.
 func (p *Parser) parseStatement() Statement {
 	switch p.CurrentToken.Type {
-	case lexer.Var:
+	case lexer.Var, lexer.Const:
 		return p.parseDeclaration()
 	case lexer.Return:
 		return p.parseReturnStatement()
@@ -190,26 +236,91 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseFunctionStatement()
 	case lexer.For:
 		return p.parseForStatement()
+	case lexer.While:
+		return p.parseWhileStatement()
+	case lexer.Switch:
+		return p.parseSwitchStatement()
+	case lexer.Break:
+		return p.parseBreakStatement()
+	case lexer.Continue:
+		return p.parseContinueStatement()
 	case lexer.Struct:
 		return p.parseStructDeclaration()
+	case lexer.Import:
+		return p.parseImportStatement()
 	default:
 		return p.parseExpression()
 	}
 }
 
 // A declaration operation is anything of this form: var name = expression.
+// Or a destructuring declaration: var [a, b] = expression, var {x, y} = expression.
+// Constants are declared the same way using const instead of var.
 func (p *Parser) parseDeclaration() Statement {
 	declarationStatement := &DeclarationStatement{
 		varToken: p.CurrentToken,
+		Constant: p.CurrentToken.Type == lexer.Const,
+	}
+	p.advance() // skip var or const
+	if p.isDestructuringPattern() {
+		destructuring := &DestructuringStatement{
+			Pattern:  p.parsePattern(),
+			Constant: declarationStatement.Constant,
+		}
+		patternToken := p.CurrentToken
+		p.expectNext(lexer.Assign)
+		p.advance()
+		destructuring.Expression = p.parseExpression()
+		for _, name := range PatternNames(destructuring.Pattern) {
+			p.declare(patternToken, name, destructuring.Constant)
+		}
+		return destructuring
 	}
-	p.advanceExpect(lexer.Var)
 	declarationStatement.Identifier = p.CurrentToken
 	p.advanceExpect(lexer.Identifier)
 	p.advanceExpect(lexer.Assign)
 	declarationStatement.Expression = p.parseExpression()
+	p.declare(declarationStatement.Identifier, declarationStatement.Identifier.Literal, declarationStatement.Constant)
 	return declarationStatement
 }
 
+func (p *Parser) pushScope() {
+	p.scopes = append(p.scopes, make(declarationScope))
+}
+
+func (p *Parser) popScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// Records the declaration of name in the current scope.
+// Redeclaring a constant, or declaring a constant over an existing name is reported. Redeclaring a
+// variable is only reported if both declarations are in the same block, so that branches of an
+// if statement can declare the same name.
+func (p *Parser) declare(token lexer.Token, name string, constant bool) {
+	current := p.scopes[len(p.scopes)-1]
+	if previous, found := current[name]; found {
+		if previous.constant {
+			p.Errors.Report(token, "Cannot redeclare constant '%s'", name)
+		} else if constant || previous.block == p.currentBlock {
+			p.Errors.Report(token, "'%s' is already declared in this scope", name)
+		}
+	}
+	current[name] = declaration{constant: constant, block: p.currentBlock}
+}
+
+// Reports assignments to a name bound to a constant.
+// Names that are not declared in the parsed source are checked by the evaluator.
+func (p *Parser) checkAssignment(token lexer.Token, name string) {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if previous, found := p.scopes[i][name]; found {
+			if previous.constant {
+				p.Errors.Report(token, "Cannot assign to constant '%s'", name)
+			}
+			return
+		}
+	}
+}
+
 // A return statement is anything of the form: return expression
 func (p *Parser) parseReturnStatement() Statement {
 	returnStatement := &ReturnStatement{
@@ -230,14 +341,30 @@ func (p *Parser) parsePrefixExpression() Expression {
 		Op: p.CurrentToken,
 	}
 	p.advance()
-	expression.Right = p.parseExpression()
+	expression.Right = p.parseInternal(PREFIX)
 	return expression
 }
 
 // A Number Literal is an expression that represents a number.
+// Literals that do not fit in an int64 are parsed as a BigIntLiteral, and decimal numbers as a
+// FloatLiteral.
 func (p *Parser) parseNumberLiteral() Expression {
+	if strings.Contains(p.CurrentToken.Literal, ".") {
+		val, err := strconv.ParseFloat(p.CurrentToken.Literal, 64)
+		if err != nil {
+			p.Errors.Report(p.CurrentToken, "Could not parse float value %s", p.CurrentToken.Literal)
+			return &FloatLiteral{0}
+		}
+		return &FloatLiteral{ActualValue: val}
+	}
 	val, err := strconv.ParseInt(p.CurrentToken.Literal, 10, 64)
 	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			bigVal, ok := new(big.Int).SetString(p.CurrentToken.Literal, 10)
+			if ok {
+				return &BigIntLiteral{ActualValue: bigVal}
+			}
+		}
 		p.Errors.Report(p.CurrentToken, "Could not parse integer value %s", p.CurrentToken.Literal)
 		return &NumberLiteral{0}
 	}
@@ -246,25 +373,66 @@ func (p *Parser) parseNumberLiteral() Expression {
 
 // an identifier is an expression that represents the name of a variable.
 func (p *Parser) parseIdentifier() Expression {
+	memberAccess := p.memberAccess
+	p.memberAccess = false
 	if p.NextToken.Type == lexer.OpenParent {
 		// This is a function call
 		callExpression := &CallExpression{
-			Name: p.CurrentToken.Literal,
+			Name:  p.CurrentToken.Literal,
+			Token: p.CurrentToken,
 		}
 		p.advance()
 		callExpression.Arguments = p.parseCallArguments()
 		return callExpression
-	} else if p.NextToken.Type == lexer.Assign {
+	} else if isAssignment(p.NextToken.Type) {
 		assignExpression := &AssignExpression{
 			VarName: p.CurrentToken.Literal,
+			Token:   p.CurrentToken,
+		}
+		if !memberAccess {
+			p.checkAssignment(p.CurrentToken, assignExpression.VarName)
 		}
-		p.expectNext(lexer.Assign)
 		p.advance()
-		assignExpression.Value = p.parseExpression()
+		assignExpression.Op, assignExpression.Value = p.parseAssignmentValue()
 		return assignExpression
 	} else {
 		// This is an identifier
-		return &IdentifierExpression{Name: p.CurrentToken.Literal}
+		return &IdentifierExpression{Name: p.CurrentToken.Literal, Token: p.CurrentToken}
+	}
+}
+
+// Binary operators applied by the compound assignment and increment operators.
+var compoundOperators = map[lexer.TokenType]lexer.Token{
+	lexer.PlusAssign:   lexer.NewToken(lexer.Plus, lexer.Plus),
+	lexer.MinusAssign:  lexer.NewToken(lexer.Minus, lexer.Minus),
+	lexer.MulAssign:    lexer.NewToken(lexer.Mul, lexer.Mul),
+	lexer.DivAssign:    lexer.NewToken(lexer.Div, lexer.Div),
+	lexer.ModAssign:    lexer.NewToken(lexer.Mod, lexer.Mod),
+	lexer.LShiftAssign: lexer.NewToken(lexer.LSHIFT, lexer.LSHIFT),
+	lexer.RShiftAssign: lexer.NewToken(lexer.RSHIFT, lexer.RSHIFT),
+	lexer.Increment:    lexer.NewToken(lexer.Plus, lexer.Plus),
+	lexer.Decrement:    lexer.NewToken(lexer.Minus, lexer.Minus),
+}
+
+func isAssignment(tokenType lexer.TokenType) bool {
+	_, compound := compoundOperators[tokenType]
+	return tokenType == lexer.Assign || compound
+}
+
+// Parses the operator and the right side of an assignment, the current token should be the assignment operator.
+// a += b is parsed as the operator + with the value b, a++ as the operator + with the value 1.
+// The returned operator is the zero Token for plain assignments.
+func (p *Parser) parseAssignmentValue() (lexer.Token, Expression) {
+	operator := p.CurrentToken
+	switch operator.Type {
+	case lexer.Increment, lexer.Decrement:
+		return compoundOperators[operator.Type], &NumberLiteral{ActualValue: 1}
+	case lexer.Assign:
+		p.advance()
+		return lexer.Token{}, p.parseExpression()
+	default:
+		p.advance()
+		return compoundOperators[operator.Type], p.parseExpression()
 	}
 }
 
@@ -309,11 +477,26 @@ func (p *Parser) parseBinaryExpression(left Expression) Expression {
 	}
 	precedence := getPrecedence(p.CurrentToken)
 	p.advance()
+	if binary.Op.Type == lexer.Dot || binary.Op.Type == lexer.QuestionDot {
+		p.memberAccess = p.CurrentToken.Type == lexer.Identifier
+	}
 	right := p.parseInternal(precedence)
 	binary.Right = right
 	return binary
 }
 
+// A conditional expression is of the form: test ? then : else
+// The operator is right associative, a ? b : c ? d : e is parsed as a ? b : (c ? d : e).
+func (p *Parser) parseConditionalExpression(test Expression) Expression {
+	conditional := &ConditionalExpression{Test: test}
+	p.advanceExpect(lexer.Question)
+	conditional.Then = p.parseExpression()
+	p.expectNext(lexer.Colon)
+	p.advance()
+	conditional.Else = p.parseInternal(TERNARY - 1)
+	return conditional
+}
+
 // Tries to parse as long as the currentPrecedence is smaller than the precedence of the next operator.
 // This is an implementation of the idea of a Pratt Parser.
 func (p *Parser) parseInternal(currentPrecedence int) Expression {
@@ -338,17 +521,19 @@ func (p *Parser) parseBlockStatement() *BlockStatement {
 	blockStatement := &BlockStatement{}
 	statements := make([]Statement, 0)
 	p.advanceExpect(lexer.OpenBrace)
+	enclosingBlock := p.currentBlock
+	p.blockCount++
+	p.currentBlock = p.blockCount
+	defer func() { p.currentBlock = enclosingBlock }()
 	for p.CurrentToken.Type != lexer.CloseBrace {
 		if p.CurrentToken.Type == lexer.EOF {
 			p.Errors.Report(p.CurrentToken, "Unexpected EOF")
 			break
 		}
-		curStatement := p.parseStatement()
-		if curStatement == nil {
-			// TODO: probably an error, fix when error handling is added.
-			panic("current statement is nil")
+		// Like at the top level, the statements that failed to parse were reported and are skipped.
+		if curStatement := p.parseStatement(); curStatement != nil {
+			statements = append(statements, curStatement)
 		}
-		statements = append(statements, curStatement)
 		p.advance()
 	}
 	blockStatement.Statements = statements
@@ -362,7 +547,11 @@ func (p *Parser) parseBoolean() Expression {
 	}
 }
 
-func (p *Parser) parseIfStatement() Statement {
+func (p *Parser) parseNil() Expression {
+	return &NilLiteral{Token: p.CurrentToken}
+}
+
+func (p *Parser) parseIfStatement() *IfStatement {
 	ifStatement := newIfStatement()
 
 	p.advanceExpect(lexer.If)
@@ -370,15 +559,235 @@ func (p *Parser) parseIfStatement() Statement {
 	p.expectNext(lexer.OpenBrace)
 
 	ifStatement.Then = *p.parseBlockStatement()
-	p.advanceExpect(lexer.CloseBrace)
 
-	if p.CurrentToken.Type == lexer.Else {
+	// The statement ends at the closing brace of the last parsed block, only
+	// consume it if an else branch follows.
+	if p.NextToken.Type == lexer.Else {
+		p.advance()
 		p.advanceExpect(lexer.Else)
-		ifStatement.Else = *p.parseBlockStatement()
+		if p.CurrentToken.Type == lexer.If {
+			// else if chains are represented as an else block holding a single if statement.
+			ifStatement.Else = BlockStatement{
+				Statements: []Statement{p.parseIfStatement()},
+			}
+		} else {
+			ifStatement.Else = *p.parseBlockStatement()
+		}
 	}
 	return ifStatement
 }
 
+// An if statement used in an expression position: var a = if test { 1 } else { 2 }
+func (p *Parser) parseIfExpression() Expression {
+	return p.parseIfStatement()
+}
+
+// A switch statement is of the form:
+//
+//	switch expression {
+//	case value1, value2 { body }
+//	case from..to { body }
+//	default { body }
+//	}
+func (p *Parser) parseSwitchStatement() Statement {
+	switchStatement := &SwitchStatement{
+		Cases:   make([]*SwitchCase, 0),
+		Default: EmptyBlock,
+	}
+	p.advanceExpect(lexer.Switch)
+	switchStatement.Subject = p.parseExpression()
+	p.expectNext(lexer.OpenBrace)
+	p.advance()
+	hasDefault := false
+	for p.CurrentToken.Type != lexer.CloseBrace {
+		switch p.CurrentToken.Type {
+		case lexer.Case:
+			switchCase := &SwitchCase{}
+			p.advance()
+			switchCase.Values = append(switchCase.Values, p.parseExpression())
+			for p.NextToken.Type == lexer.Comma {
+				p.advance() // Skip last token of current expression
+				p.advance() // Skip the comma
+				switchCase.Values = append(switchCase.Values, p.parseExpression())
+			}
+			p.expectNext(lexer.OpenBrace)
+			switchCase.Body = p.parseBlockStatement()
+			switchStatement.Cases = append(switchStatement.Cases, switchCase)
+		case lexer.Default:
+			if hasDefault {
+				p.Errors.Report(p.CurrentToken, "Multiple default cases in switch statement")
+			}
+			hasDefault = true
+			p.expectNext(lexer.OpenBrace)
+			switchStatement.Default = p.parseBlockStatement()
+		default:
+			p.Errors.Report(p.CurrentToken, "Expected case or default got %s instead", p.CurrentToken.Literal)
+			return switchStatement
+		}
+		p.advance()
+	}
+	return switchStatement
+}
+
+// A match expression is of the form:
+//
+//	match expression {
+//	pattern => expression,
+//	pattern => { body }
+//	}
+//
+// The comma separating arms is optional.
+func (p *Parser) parseMatchExpression() Expression {
+	matchExpression := &MatchExpression{
+		Arms: make([]*MatchArm, 0),
+	}
+	p.advanceExpect(lexer.Match)
+	matchExpression.Subject = p.parseExpression()
+	p.expectNext(lexer.OpenBrace)
+	p.advance()
+	for p.CurrentToken.Type != lexer.CloseBrace {
+		if p.CurrentToken.Type == lexer.EOF {
+			p.Errors.Report(p.CurrentToken, "Unexpected EOF")
+			break
+		}
+		arm := &MatchArm{Pattern: p.parsePattern()}
+		p.pushScope()
+		for _, name := range PatternNames(arm.Pattern) {
+			p.declare(p.CurrentToken, name, false)
+		}
+		p.expectNext(lexer.FatArrow)
+		p.advance()
+		if p.CurrentToken.Type == lexer.OpenBrace {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			arm.Body = &BlockStatement{Statements: []Statement{p.parseExpression()}}
+		}
+		p.popScope()
+		matchExpression.Arms = append(matchExpression.Arms, arm)
+		p.advance()
+		if p.CurrentToken.Type == lexer.Comma {
+			p.advance()
+		}
+	}
+	return matchExpression
+}
+
+// Destructuring declarations start with an array, object or struct pattern instead of a name.
+func (p *Parser) isDestructuringPattern() bool {
+	switch p.CurrentToken.Type {
+	case lexer.OpenBracket, lexer.OpenBrace:
+		return true
+	case lexer.Identifier:
+		return p.NextToken.Type == lexer.OpenParent
+	default:
+		return false
+	}
+}
+
+// Parses a pattern, the current token is left on the last token of the pattern.
+func (p *Parser) parsePattern() Pattern {
+	switch p.CurrentToken.Type {
+	case lexer.Identifier:
+		if p.NextToken.Type == lexer.OpenParent {
+			return p.parseStructPattern()
+		}
+		if p.CurrentToken.Literal == "_" {
+			return &WildcardPattern{}
+		}
+		return &BindingPattern{Name: p.CurrentToken.Literal}
+	case lexer.OpenBracket:
+		return p.parseArrayPattern()
+	case lexer.OpenBrace:
+		return p.parseObjectPattern()
+	case lexer.Number, lexer.String, lexer.True, lexer.False, lexer.Nil, lexer.Minus:
+		// Comparison and logical operators are not part of the pattern.
+		return &LiteralPattern{Value: p.parseInternal(LOG)}
+	default:
+		p.Errors.Report(p.CurrentToken, "Expected a pattern got %s instead", p.CurrentToken.Literal)
+		return &WildcardPattern{}
+	}
+}
+
+// [pattern, pattern, ...rest]
+func (p *Parser) parseArrayPattern() Pattern {
+	arrayPattern := &ArrayPattern{
+		Elements: make([]Pattern, 0),
+	}
+	p.advanceExpect(lexer.OpenBracket)
+	for p.CurrentToken.Type != lexer.CloseBracket {
+		if p.CurrentToken.Type == lexer.EOF {
+			p.Errors.Report(p.CurrentToken, "Unexpected EOF")
+			break
+		}
+		if p.CurrentToken.Type == lexer.Ellipsis {
+			p.advance()
+			arrayPattern.Rest = p.parsePattern()
+			p.expectNext(lexer.CloseBracket)
+			break
+		}
+		arrayPattern.Elements = append(arrayPattern.Elements, p.parsePattern())
+		p.advance()
+		if p.CurrentToken.Type == lexer.CloseBracket {
+			break
+		}
+		p.advanceExpect(lexer.Comma)
+	}
+	return arrayPattern
+}
+
+// {name: pattern, name}
+func (p *Parser) parseObjectPattern() Pattern {
+	objectPattern := &ObjectPattern{
+		Fields: make([]*FieldPattern, 0),
+	}
+	p.advanceExpect(lexer.OpenBrace)
+	for p.CurrentToken.Type != lexer.CloseBrace {
+		if p.CurrentToken.Type != lexer.Identifier {
+			p.Errors.Report(p.CurrentToken, "Expected a field name got %s instead", p.CurrentToken.Literal)
+			break
+		}
+		field := &FieldPattern{
+			Name:    p.CurrentToken.Literal,
+			Pattern: &BindingPattern{Name: p.CurrentToken.Literal},
+		}
+		if p.NextToken.Type == lexer.Colon {
+			p.advance()
+			p.advance()
+			field.Pattern = p.parsePattern()
+		}
+		objectPattern.Fields = append(objectPattern.Fields, field)
+		p.advance()
+		if p.CurrentToken.Type == lexer.CloseBrace {
+			break
+		}
+		p.advanceExpect(lexer.Comma)
+	}
+	return objectPattern
+}
+
+// Type(pattern, pattern)
+func (p *Parser) parseStructPattern() Pattern {
+	structPattern := &StructPattern{
+		Type:     p.CurrentToken.Literal,
+		Elements: make([]Pattern, 0),
+	}
+	p.advance()
+	p.advanceExpect(lexer.OpenParent)
+	for p.CurrentToken.Type != lexer.CloseParent {
+		if p.CurrentToken.Type == lexer.EOF {
+			p.Errors.Report(p.CurrentToken, "Unexpected EOF")
+			break
+		}
+		structPattern.Elements = append(structPattern.Elements, p.parsePattern())
+		p.advance()
+		if p.CurrentToken.Type == lexer.CloseParent {
+			break
+		}
+		p.advanceExpect(lexer.Comma)
+	}
+	return structPattern
+}
+
 func (p *Parser) parseFunctionStatement() Statement {
 	funcStatement := newFunctionStatement()
 	p.advanceExpect(lexer.Func)
@@ -404,32 +813,128 @@ func (p *Parser) parseFunctionStatement() Statement {
 	}
 	p.advanceExpect(lexer.CloseParent)
 
+	// break and continue can't cross function boundaries.
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	p.pushScope()
+	parameters := p.scopes[len(p.scopes)-1]
+	for _, param := range funcStatement.Parameters {
+		if param == nil {
+			continue
+		}
+		if _, found := parameters[param.Name]; found {
+			p.Errors.Report(param.Token, "Duplicate parameter '%s' in function '%s'", param.Name, funcStatement.Name)
+		}
+		parameters[param.Name] = declaration{block: p.currentBlock}
+	}
 	funcStatement.Block = p.parseBlockStatement()
+	p.popScope()
+	p.loopDepth = loopDepth
 	return funcStatement
 }
 
+// A for statement is either a range loop: for key[, value] in expression { body }
+// Or a three-clause loop: for init; test; post { body }
 func (p *Parser) parseForStatement() Statement {
+	p.advanceExpect(lexer.For)
+	if p.CurrentToken.Type == lexer.Identifier && (p.NextToken.Type == lexer.Comma || p.NextToken.Type == lexer.In) {
+		return p.parseForInStatement()
+	}
+	return p.parseForClauseStatement()
+}
+
+func (p *Parser) parseForInStatement() Statement {
 	forStatement := &ForStatement{
 		Value: &IdentifierExpression{
 			Name: "__empty__",
 		},
 	}
-	p.expectNext(lexer.Identifier)
-	forStatement.Key = &IdentifierExpression{Name: p.CurrentToken.Literal}
+	forStatement.Key = &IdentifierExpression{Name: p.CurrentToken.Literal, Token: p.CurrentToken}
 	// If the next token is a comma, that means that there is a value identifier
 	if p.NextToken.Type == lexer.Comma {
 		p.advance()                    // at comma
 		p.expectNext(lexer.Identifier) // at identifier
-		forStatement.Value = &IdentifierExpression{Name: p.CurrentToken.Literal}
+		forStatement.Value = &IdentifierExpression{Name: p.CurrentToken.Literal, Token: p.CurrentToken}
 	}
 	p.expectNext(lexer.In)
 	p.advance()
 	forStatement.Range = p.parseExpression()
 	p.expectNext(lexer.OpenBrace)
-	forStatement.Body = p.parseBlockStatement()
+	// Loop variables are declared in the scope of the loop.
+	p.pushScope()
+	defer p.popScope()
+	p.declare(p.CurrentToken, forStatement.Key.Name, false)
+	p.declare(p.CurrentToken, forStatement.Value.Name, false)
+	forStatement.Body = p.parseLoopBody()
 	return forStatement
 }
 
+func (p *Parser) parseForClauseStatement() Statement {
+	forStatement := &ForClauseStatement{}
+	// Variables declared in the init clause live in the scope of the loop.
+	p.pushScope()
+	defer p.popScope()
+	if p.CurrentToken.Type == lexer.Identifier && p.NextToken.Type == lexer.Assign {
+		// for i = 0; ... declares the loop variable, same as for var i = 0; ...
+		declarationStatement := &DeclarationStatement{Identifier: p.CurrentToken}
+		p.advance()
+		p.advance()
+		declarationStatement.Expression = p.parseExpression()
+		p.declare(declarationStatement.Identifier, declarationStatement.Identifier.Literal, false)
+		forStatement.Init = declarationStatement
+		p.expectNext(lexer.SemiCol)
+	} else if p.CurrentToken.Type != lexer.SemiCol {
+		forStatement.Init = p.parseStatement()
+		p.expectNext(lexer.SemiCol)
+	}
+	p.advanceExpect(lexer.SemiCol)
+	if p.CurrentToken.Type != lexer.SemiCol {
+		forStatement.Test = p.parseExpression()
+		p.expectNext(lexer.SemiCol)
+	}
+	p.advanceExpect(lexer.SemiCol)
+	if p.CurrentToken.Type != lexer.OpenBrace {
+		forStatement.Post = p.parseExpression()
+		p.expectNext(lexer.OpenBrace)
+	}
+	forStatement.Body = p.parseLoopBody()
+	return forStatement
+}
+
+// A while statement is of the form: while expression { body }
+func (p *Parser) parseWhileStatement() Statement {
+	whileStatement := &WhileStatement{}
+	p.advanceExpect(lexer.While)
+	whileStatement.Test = p.parseExpression()
+	p.expectNext(lexer.OpenBrace)
+	whileStatement.Body = p.parseLoopBody()
+	return whileStatement
+}
+
+// Parses the block statement of a loop, break and continue statements are only allowed inside it.
+func (p *Parser) parseLoopBody() *BlockStatement {
+	p.loopDepth++
+	p.pushScope()
+	body := p.parseBlockStatement()
+	p.popScope()
+	p.loopDepth--
+	return body
+}
+
+func (p *Parser) parseBreakStatement() Statement {
+	if p.loopDepth == 0 {
+		p.Errors.Report(p.CurrentToken, "'break' is not allowed outside of a loop")
+	}
+	return &BreakStatement{Token: p.CurrentToken}
+}
+
+func (p *Parser) parseContinueStatement() Statement {
+	if p.loopDepth == 0 {
+		p.Errors.Report(p.CurrentToken, "'continue' is not allowed outside of a loop")
+	}
+	return &ContinueStatement{Token: p.CurrentToken}
+}
+
 func (p *Parser) advanceExpect(expected lexer.TokenType) {
 	if p.CurrentToken.Type != expected {
 		p.Errors.Report(p.CurrentToken, "Expected %s got %s instead", expected, p.CurrentToken.Literal)
@@ -471,14 +976,52 @@ func (p *Parser) parseArrayLiteral() Expression {
 	return array
 }
 
+// Parses an index access a[index] or a slice a[start:stop:step].
 func (p *Parser) parseArrayAccess(left Expression) Expression {
 	indexAccess := &IndexAccess{Identifier: left}
 	p.advance()
+	if p.CurrentToken.Type == lexer.Colon {
+		return p.parseSlice(left, nil)
+	}
 	indexAccess.Index = p.parseExpression()
+	if p.NextToken.Type == lexer.Colon {
+		p.advance()
+		return p.parseSlice(left, indexAccess.Index)
+	}
 	p.expectNext(lexer.CloseBracket)
+	if isAssignment(p.NextToken.Type) {
+		indexAssign := &IndexAssignExpression{Target: indexAccess}
+		p.advance()
+		indexAssign.Op, indexAssign.Value = p.parseAssignmentValue()
+		return indexAssign
+	}
 	return indexAccess
 }
 
+// Parses the rest of a slice, the current token is the colon following the start bound.
+func (p *Parser) parseSlice(left Expression, start Expression) Expression {
+	slice := &SliceExpression{Target: left, Start: start}
+	p.advanceExpect(lexer.Colon)
+	if p.CurrentToken.Type != lexer.Colon && p.CurrentToken.Type != lexer.CloseBracket {
+		slice.Stop = p.parseExpression()
+		p.advance()
+	}
+	if p.CurrentToken.Type == lexer.Colon {
+		p.advance()
+		if p.CurrentToken.Type != lexer.CloseBracket {
+			slice.Step = p.parseExpression()
+			p.advance()
+		}
+	}
+	if p.CurrentToken.Type != lexer.CloseBracket {
+		p.Errors.Report(p.CurrentToken, "Expected ] got %s instead", p.CurrentToken.Literal)
+	}
+	if isAssignment(p.NextToken.Type) {
+		p.Errors.Report(p.NextToken, "Cannot assign to a slice")
+	}
+	return slice
+}
+
 func (p *Parser) parseStructDeclaration() Statement {
 	structDec := &StructDeclarationStatement{}
 	p.advance() // skip the struct keyword
@@ -506,7 +1049,76 @@ func (p *Parser) parseStructDeclaration() Statement {
 func (p *Parser) parseNewCall() Expression {
 	p.expectNext(lexer.Identifier)
 	callExpr := &NewCallExpr{Type: p.CurrentToken.Literal}
+	if p.NextToken.Type == lexer.Dot {
+		// The type is declared by an imported module: new module.Type()
+		p.advance()
+		p.expectNext(lexer.Identifier)
+		callExpr.Module, callExpr.Type = callExpr.Type, p.CurrentToken.Literal
+	}
 	p.advance() // skip the type declaration
 	callExpr.Args = p.parseCallArguments()
 	return callExpr
 }
+
+// An import statement binds a module to an alias, `import "path" as alias`, or to the base name of
+// its path, `import "path"` (see ModuleName), or binds some members of the module,
+// `import { a, b } from "path"`. "as" and "from" are not keywords, they are only recognized in
+// import statements.
+func (p *Parser) parseImportStatement() Statement {
+	statement := &ImportStatement{Token: p.CurrentToken}
+	if p.NextToken.Type == lexer.OpenBrace {
+		p.advance() // skip the import keyword
+		for {
+			p.expectNext(lexer.Identifier)
+			statement.Names = append(statement.Names, &IdentifierExpression{Name: p.CurrentToken.Literal, Token: p.CurrentToken})
+			if p.NextToken.Type != lexer.Comma {
+				break
+			}
+			p.advance()
+		}
+		p.expectNext(lexer.CloseBrace)
+		if p.NextToken.Type != lexer.Identifier || p.NextToken.Literal != "from" {
+			p.Errors.Report(p.NextToken, "Expected from got %s instead", p.NextToken.Literal)
+		}
+		p.advance()
+		p.expectNext(lexer.String)
+		statement.Path = p.CurrentToken.Literal
+		for _, name := range statement.Names {
+			p.declare(name.Token, name.Name, true)
+		}
+		return statement
+	}
+	p.expectNext(lexer.String)
+	statement.Path = p.CurrentToken.Literal
+	aliasToken := p.CurrentToken
+	if p.NextToken.Type == lexer.Identifier && p.NextToken.Literal == "as" {
+		p.advance()
+		p.expectNext(lexer.Identifier)
+		aliasToken = p.CurrentToken
+		statement.Alias = p.CurrentToken.Literal
+	} else {
+		statement.Alias = ModuleName(statement.Path)
+		if statement.Alias == "" {
+			p.Errors.Report(aliasToken, "Cannot name the module %s, use import \"%s\" as name", statement.Path, statement.Path)
+			return statement
+		}
+	}
+	p.declare(aliasToken, statement.Alias, true)
+	return statement
+}
+
+// ModuleName returns the name of the module of the given path, its base name without extension,
+// or an empty string if the base name is not a valid identifier.
+func ModuleName(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return ""
+		}
+	}
+	if name == "" || lexer.Keywords[name] != "" {
+		return ""
+	}
+	return name
+}
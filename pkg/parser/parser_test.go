@@ -3,6 +3,7 @@ package parser
 import (
 	lexer2 "github.com/chermehdi/comet/pkg/lexer"
 	"github.com/stretchr/testify/assert"
+	"math/big"
 	"testing"
 )
 
@@ -28,9 +29,11 @@ func (t *TestingVisitor) VisitStructDeclaration(statement StructDeclarationState
 
 func (t *TestingVisitor) VisitNewCall(newExpr NewCallExpr) {
 	currentNode := t.expected[t.ptr]
-	_, isNew := currentNode.(*NewCallExpr)
+	expected, isNew := currentNode.(*NewCallExpr)
 	assert.True(t.t, isNew)
 	t.ptr++
+	assert.Equal(t.t, expected.Module, newExpr.Module)
+	assert.Equal(t.t, expected.Type, newExpr.Type)
 	for _, ex := range newExpr.Args {
 		ex.Accept(t)
 	}
@@ -45,6 +48,16 @@ func (t *TestingVisitor) VisitArrayAccess(access IndexAccess) {
 	access.Index.Accept(t)
 }
 
+func (t *TestingVisitor) VisitIndexAssignExpression(assign IndexAssignExpression) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*IndexAssignExpression)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, expected.Op.Literal, assign.Op.Literal)
+	t.ptr++
+	assign.Target.Accept(t)
+	assign.Value.Accept(t)
+}
+
 func (t *TestingVisitor) VisitExpression(Expression) {}
 
 func (t *TestingVisitor) VisitStatement(Statement) {}
@@ -82,6 +95,22 @@ func (t *TestingVisitor) VisitNumberLiteral(expression NumberLiteral) {
 	t.assertNumberLiteralNode(expression)
 }
 
+func (t *TestingVisitor) VisitFloatLiteral(expression FloatLiteral) {
+	currentNode := t.expected[t.ptr]
+	currentFloatLiteral, ok := currentNode.(*FloatLiteral)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, currentFloatLiteral.ActualValue, expression.ActualValue)
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitBigIntLiteral(expression BigIntLiteral) {
+	currentNode := t.expected[t.ptr]
+	currentBigIntLiteral, ok := currentNode.(*BigIntLiteral)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, currentBigIntLiteral.ActualValue.String(), expression.ActualValue.String())
+	t.ptr++
+}
+
 func (t *TestingVisitor) VisitParenthesisedExpression(expression ParenthesisedExpression) {
 	currentNode := t.expected[t.ptr]
 	_, ok := currentNode.(*ParenthesisedExpression)
@@ -129,7 +158,9 @@ func (t *TestingVisitor) VisitAssignExpression(assign AssignExpression) {
 	currentAssignExpression, ok := currentNode.(*AssignExpression)
 	assert.True(t.t, ok)
 	assert.Equal(t.t, currentAssignExpression.VarName, assign.VarName)
+	assert.Equal(t.t, currentAssignExpression.Op.Literal, assign.Op.Literal)
 	t.ptr++
+	assign.Value.Accept(t)
 }
 
 func (t *TestingVisitor) VisitDeclarationStatement(statement DeclarationStatement) {
@@ -137,6 +168,7 @@ func (t *TestingVisitor) VisitDeclarationStatement(statement DeclarationStatemen
 	currentDecStatement, ok := currentNode.(*DeclarationStatement)
 	assert.True(t.t, ok)
 	assert.Equal(t.t, currentDecStatement.Identifier.Literal, statement.Identifier.Literal)
+	assert.Equal(t.t, currentDecStatement.Constant, statement.Constant)
 	t.ptr++
 	statement.Expression.Accept(t)
 }
@@ -180,6 +212,74 @@ func (t *TestingVisitor) VisitForStatement(statement ForStatement) {
 	statement.Body.Accept(t)
 }
 
+func (t *TestingVisitor) VisitForClauseStatement(statement ForClauseStatement) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*ForClauseStatement)
+	assert.True(t.t, ok)
+	t.ptr++
+	if statement.Init != nil {
+		statement.Init.Accept(t)
+	}
+	if statement.Test != nil {
+		statement.Test.Accept(t)
+	}
+	if statement.Post != nil {
+		statement.Post.Accept(t)
+	}
+	statement.Body.Accept(t)
+}
+
+func (t *TestingVisitor) VisitWhileStatement(statement WhileStatement) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*WhileStatement)
+	assert.True(t.t, ok)
+	t.ptr++
+	statement.Test.Accept(t)
+	statement.Body.Accept(t)
+}
+
+func (t *TestingVisitor) VisitSwitchStatement(statement SwitchStatement) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*SwitchStatement)
+	assert.True(t.t, ok)
+	t.ptr++
+	statement.Subject.Accept(t)
+	for _, switchCase := range statement.Cases {
+		for _, value := range switchCase.Values {
+			value.Accept(t)
+		}
+		switchCase.Body.Accept(t)
+	}
+	statement.Default.Accept(t)
+}
+
+func (t *TestingVisitor) VisitImportStatement(statement ImportStatement) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*ImportStatement)
+	assert.True(t.t, ok)
+	t.ptr++
+	assert.Equal(t.t, expected.Path, statement.Path)
+	assert.Equal(t.t, expected.Alias, statement.Alias)
+	assert.Equal(t.t, len(expected.Names), len(statement.Names))
+	for i := 0; i < len(expected.Names) && i < len(statement.Names); i++ {
+		assert.Equal(t.t, expected.Names[i].Name, statement.Names[i].Name)
+	}
+}
+
+func (t *TestingVisitor) VisitBreakStatement(BreakStatement) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*BreakStatement)
+	assert.True(t.t, ok)
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitContinueStatement(ContinueStatement) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*ContinueStatement)
+	assert.True(t.t, ok)
+	t.ptr++
+}
+
 func (t *TestingVisitor) VisitFunctionStatement(statement FunctionStatement) {
 	currentNode := t.expected[t.ptr]
 	expectedFuncStatement, ok := currentNode.(*FunctionStatement)
@@ -211,6 +311,106 @@ func (t *TestingVisitor) VisitBooleanLiteral(literal BooleanLiteral) {
 	t.ptr++
 }
 
+func (t *TestingVisitor) VisitNilLiteral(NilLiteral) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*NilLiteral)
+	assert.True(t.t, ok)
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitDestructuringStatement(statement DestructuringStatement) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*DestructuringStatement)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, expected.Constant, statement.Constant)
+	t.ptr++
+	statement.Pattern.Accept(t)
+	statement.Expression.Accept(t)
+}
+
+func (t *TestingVisitor) VisitMatchExpression(expression MatchExpression) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*MatchExpression)
+	assert.True(t.t, ok)
+	t.ptr++
+	expression.Subject.Accept(t)
+	for _, arm := range expression.Arms {
+		arm.Pattern.Accept(t)
+		arm.Body.Accept(t)
+	}
+}
+
+func (t *TestingVisitor) VisitWildcardPattern(WildcardPattern) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*WildcardPattern)
+	assert.True(t.t, ok)
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitBindingPattern(pattern BindingPattern) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*BindingPattern)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, expected.Name, pattern.Name)
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitLiteralPattern(pattern LiteralPattern) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*LiteralPattern)
+	assert.True(t.t, ok)
+	t.ptr++
+	pattern.Value.Accept(t)
+}
+
+// Composite patterns are compared through their source representation.
+func (t *TestingVisitor) VisitArrayPattern(pattern ArrayPattern) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*ArrayPattern)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, expected.Literal(), pattern.Literal())
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitObjectPattern(pattern ObjectPattern) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*ObjectPattern)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, expected.Literal(), pattern.Literal())
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitStructPattern(pattern StructPattern) {
+	currentNode := t.expected[t.ptr]
+	expected, ok := currentNode.(*StructPattern)
+	assert.True(t.t, ok)
+	assert.Equal(t.t, expected.Literal(), pattern.Literal())
+	t.ptr++
+}
+
+func (t *TestingVisitor) VisitConditionalExpression(expression ConditionalExpression) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*ConditionalExpression)
+	assert.True(t.t, ok)
+	t.ptr++
+	expression.Test.Accept(t)
+	expression.Then.Accept(t)
+	expression.Else.Accept(t)
+}
+
+func (t *TestingVisitor) VisitSliceExpression(expression SliceExpression) {
+	currentNode := t.expected[t.ptr]
+	_, ok := currentNode.(*SliceExpression)
+	assert.True(t.t, ok)
+	t.ptr++
+	expression.Target.Accept(t)
+	for _, bound := range []Expression{expression.Start, expression.Stop, expression.Step} {
+		if bound != nil {
+			bound.Accept(t)
+		}
+	}
+}
+
 func TestParser_Parse_SimpleMathExpressions(t *testing.T) {
 	tests := []struct {
 		Expr     string
@@ -298,6 +498,22 @@ func TestParser_Parse_SimpleMathExpressions(t *testing.T) {
 				&IdentifierExpression{Name: "a"},
 			},
 		},
+		{
+			Expr: "9223372036854775808 + 1",
+			Expected: []Node{
+				&BigIntLiteral{ActualValue: bigIntOf("9223372036854775808")},
+				&BinaryExpression{Op: lexer2.Token{Literal: "+"}},
+				&NumberLiteral{ActualValue: int64(1)},
+			},
+		},
+		{
+			Expr: "1.5 * 2",
+			Expected: []Node{
+				&FloatLiteral{ActualValue: 1.5},
+				&BinaryExpression{Op: lexer2.Token{Literal: "*"}},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
 	}
 	for _, test := range tests {
 		parser := New(test.Expr)
@@ -371,6 +587,88 @@ func TestParser_ParseDeclarationStatement(t *testing.T) {
 	}
 }
 
+func TestParser_ParseConstDeclaration(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: `const a = 1`,
+			Expected: []Node{
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "a"}, Constant: true},
+				&NumberLiteral{ActualValue: int64(1)},
+			},
+		},
+		{
+			Expr: `const [a, b] = c`,
+			Expected: []Node{
+				&DestructuringStatement{Constant: true},
+				&ArrayPattern{Elements: []Pattern{&BindingPattern{Name: "a"}, &BindingPattern{Name: "b"}}},
+				&IdentifierExpression{Name: "c"},
+			},
+		},
+	}
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
+	}
+}
+
+func TestParser_Parse_ConstAndRedeclarationDiagnostics(t *testing.T) {
+	tests := []struct {
+		Src   string
+		Error string
+	}{
+		{"const a = 1\n a = 2", "Cannot assign to constant 'a'"},
+		{"const a = 1\n a += 2", "Cannot assign to constant 'a'"},
+		{"const a = 1\n a++", "Cannot assign to constant 'a'"},
+		{"const a = 1\n func f() { a = 2 }", "Cannot assign to constant 'a'"},
+		{"const a = 1\n while true { a = 2 }", "Cannot assign to constant 'a'"},
+		{"const [a, b] = c\n b = 2", "Cannot assign to constant 'b'"},
+		{"const a = 1\n var a = 2", "Cannot redeclare constant 'a'"},
+		{"const a = 1\n if true { const a = 2 }", "Cannot redeclare constant 'a'"},
+		{"var a = 1\n const a = 2", "'a' is already declared in this scope"},
+		{"var a = 1\n var a = 2", "'a' is already declared in this scope"},
+		{"var [a, a] = b", "'a' is already declared in this scope"},
+		{"func f(a, b, a) {}", "Duplicate parameter 'a' in function 'f'"},
+		{"struct A { func set(x, x) {} }", "Duplicate parameter 'x' in function 'set'"},
+	}
+	for _, test := range tests {
+		parser := New(test.Src)
+		parser.Parse()
+		if assert.True(t, parser.Errors.HasAny(), test.Src) {
+			assert.Equal(t, test.Error, parser.Errors.Errors[0].Message, test.Src)
+		}
+	}
+
+	valid := []string{
+		// Functions, loops and match arms have their own scope.
+		"const a = 1\n func f(a) { a = 2 }",
+		"const a = 1\n func f() { var a = 2\n a = 3 }",
+		"const a = 1\n for a in 0..1 { a = 2 }",
+		"const a = 1\n while true { var a = 2\n a = 3 }",
+		"const a = 1\n match 1 { a => { a = 2 } }",
+		// Fields are not variables.
+		"const x = 1\n var p = 1\n p.x = 2",
+		// Branches can declare the same variable.
+		"if true { var a = 1 } else { var a = 2 }",
+		"for i = 0; i < 1; i++ {}\n for i = 0; i < 1; i++ {}",
+	}
+	for _, src := range valid {
+		parser := New(src)
+		parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), src+"\n"+parser.Errors.String())
+	}
+}
+
 func TestParser_ParseReturnStatement(t *testing.T) {
 	tests := []struct {
 		Expr     string
@@ -468,6 +766,53 @@ func TestParser_ParseBooleans(t *testing.T) {
 	}
 }
 
+func TestParser_ParseNil(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: "nil",
+			Expected: []Node{
+				&NilLiteral{},
+			},
+		},
+		{
+			Expr: "a ?? nil",
+			Expected: []Node{
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "??"}},
+				&NilLiteral{},
+			},
+		},
+		{
+			Expr: "a?.b ?? 1 + 2",
+			Expected: []Node{
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "?."}},
+				&IdentifierExpression{Name: "b"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "??"}},
+				&NumberLiteral{ActualValue: 1},
+				&BinaryExpression{Op: lexer2.Token{Literal: "+"}},
+				&NumberLiteral{ActualValue: 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.NotNil(t, rootNode)
+		assert.False(t, parser.Errors.HasAny())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+	}
+}
+
 func TestParser_ParsePrefixExpression(t *testing.T) {
 	tests := []struct {
 		Expr     string
@@ -502,6 +847,29 @@ func TestParser_ParsePrefixExpression(t *testing.T) {
 	}
 }
 
+func TestParser_ParseLogicalOperators(t *testing.T) {
+	tests := []struct {
+		Expr       string
+		ExpectedOp string
+	}{
+		{"!a && b", "&&"},
+		{"a || b && c", "||"},
+		{"a && b || c", "||"},
+		{"a < b && b < c", "&&"},
+		{"-a * b", "*"},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny())
+		assert.Len(t, rootNode.Statements, 1)
+		binary, ok := rootNode.Statements[0].(*BinaryExpression)
+		assert.True(t, ok)
+		assert.Equal(t, test.ExpectedOp, binary.Op.Literal)
+	}
+}
+
 func TestParser_ParsePrefixOperators(t *testing.T) {
 
 	tests := []struct {
@@ -606,18 +974,67 @@ func TestParser_ParseAssignExpression(t *testing.T) {
 				&NumberLiteral{ActualValue: int64(1)},
 			},
 		},
+		{
+			Expr: `a += 2 * 3`,
+			Expected: []Node{
+				&AssignExpression{VarName: "a", Op: lexer2.Token{Literal: "+"}},
+				&NumberLiteral{ActualValue: int64(2)},
+				&BinaryExpression{Op: lexer2.Token{Literal: "*"}},
+				&NumberLiteral{ActualValue: int64(3)},
+			},
+		},
+		{
+			Expr: `a--`,
+			Expected: []Node{
+				&AssignExpression{VarName: "a", Op: lexer2.Token{Literal: "-"}},
+				&NumberLiteral{ActualValue: int64(1)},
+			},
+		},
+		{
+			Expr: `a[0] <<= 2`,
+			Expected: []Node{
+				&IndexAssignExpression{Op: lexer2.Token{Literal: "<<"}},
+				&IndexAccess{},
+				&IdentifierExpression{Name: "a"},
+				&NumberLiteral{ActualValue: int64(0)},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+		{
+			Expr: `a.b[1] = 2`,
+			Expected: []Node{
+				&IndexAssignExpression{},
+				&IndexAccess{},
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "."}},
+				&IdentifierExpression{Name: "b"},
+				&NumberLiteral{ActualValue: int64(1)},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+		{
+			Expr: `a.b %= 2`,
+			Expected: []Node{
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "."}},
+				&AssignExpression{VarName: "b", Op: lexer2.Token{Literal: "%"}},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
 	}
 
 	for _, test := range tests {
 		parser := New(test.Expr)
 		rootNode := parser.Parse()
 		assert.NotNil(t, rootNode)
+		assert.False(t, parser.Errors.HasAny())
 		testingVisitor := &TestingVisitor{
 			expected: test.Expected,
 			ptr:      0,
 			t:        t,
 		}
 		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
 	}
 }
 
@@ -707,6 +1124,19 @@ func TestParser_ParseBlockStatement(t *testing.T) {
 	}
 }
 
+func TestParser_Parse_ShouldFailMalformedBlockStatement(t *testing.T) {
+	tests := []string{
+		`Test part of the if statement should evaluate to CometBool`,
+		`{ ) }`,
+		`func f() { var }`,
+	}
+	for _, test := range tests {
+		parser := New(test)
+		parser.Parse()
+		assert.True(t, parser.Errors.HasAny(), test)
+	}
+}
+
 func TestParser_ParseIfStatement(t *testing.T) {
 	tests := []struct {
 		Expr     string
@@ -769,8 +1199,26 @@ func TestParser_ParseIfStatement(t *testing.T) {
 				&BlockStatement{}, // accounting for the then empty block.
 			},
 		},
-	}
-
+		{
+			Expr: `
+				if a {
+					return 1
+				}
+				return 2
+`,
+			Expected: []Node{
+				&IfStatement{},
+				&IdentifierExpression{Name: "a"},
+				&BlockStatement{},
+				&ReturnStatement{},
+				&NumberLiteral{ActualValue: int64(1)},
+				&BlockStatement{}, // empty else block.
+				&ReturnStatement{},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+	}
+
 	for _, test := range tests {
 		parser := New(test.Expr)
 		rootNode := parser.Parse()
@@ -784,6 +1232,352 @@ func TestParser_ParseIfStatement(t *testing.T) {
 	}
 }
 
+func TestParser_ParseElseIfAndSwitch(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: `if a { } else if b { } else { }`,
+			Expected: []Node{
+				&IfStatement{},
+				&IdentifierExpression{Name: "a"},
+				&BlockStatement{},
+				&BlockStatement{}, // else block wrapping the nested if.
+				&IfStatement{},
+				&IdentifierExpression{Name: "b"},
+				&BlockStatement{},
+				&BlockStatement{},
+			},
+		},
+		{
+			Expr: `switch a { case 1, 2 { } case 3..5 { } default { } }`,
+			Expected: []Node{
+				&SwitchStatement{},
+				&IdentifierExpression{Name: "a"},
+				&NumberLiteral{ActualValue: int64(1)},
+				&NumberLiteral{ActualValue: int64(2)},
+				&BlockStatement{},
+				&NumberLiteral{ActualValue: int64(3)},
+				&BinaryExpression{Op: lexer2.Token{Literal: ".."}},
+				&NumberLiteral{ActualValue: int64(5)},
+				&BlockStatement{},
+				&BlockStatement{},
+			},
+		},
+		{
+			Expr: `switch a { }`,
+			Expected: []Node{
+				&SwitchStatement{},
+				&IdentifierExpression{Name: "a"},
+				&BlockStatement{}, // empty default block.
+			},
+		},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
+	}
+}
+
+func TestParser_Parse_ShouldFailMalformedSwitch(t *testing.T) {
+	tests := []string{
+		`switch a { default { } default { } }`,
+		`switch a { 1 { } }`,
+	}
+	for _, test := range tests {
+		parser := New(test)
+		parser.Parse()
+		assert.True(t, parser.Errors.HasAny())
+	}
+}
+
+func TestParser_ParseMatchExpression(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: `match v { [a, ...rest] => a, Point(x, -1) => { x } {name: n, age} => n 1..5 => 1, _ => nil }`,
+			Expected: []Node{
+				&MatchExpression{},
+				&IdentifierExpression{Name: "v"},
+				&ArrayPattern{
+					Elements: []Pattern{&BindingPattern{Name: "a"}},
+					Rest:     &BindingPattern{Name: "rest"},
+				},
+				&BlockStatement{},
+				&IdentifierExpression{Name: "a"},
+				&StructPattern{
+					Type: "Point",
+					Elements: []Pattern{
+						&BindingPattern{Name: "x"},
+						&LiteralPattern{Value: &PrefixExpression{
+							Op:    lexer2.Token{Literal: "-"},
+							Right: &NumberLiteral{ActualValue: 1},
+						}},
+					},
+				},
+				&BlockStatement{},
+				&IdentifierExpression{Name: "x"},
+				&ObjectPattern{
+					Fields: []*FieldPattern{
+						{Name: "name", Pattern: &BindingPattern{Name: "n"}},
+						{Name: "age", Pattern: &BindingPattern{Name: "age"}},
+					},
+				},
+				&BlockStatement{},
+				&IdentifierExpression{Name: "n"},
+				&LiteralPattern{},
+				&NumberLiteral{ActualValue: int64(1)},
+				&BinaryExpression{Op: lexer2.Token{Literal: ".."}},
+				&NumberLiteral{ActualValue: int64(5)},
+				&BlockStatement{},
+				&NumberLiteral{ActualValue: int64(1)},
+				&WildcardPattern{},
+				&BlockStatement{},
+				&NilLiteral{},
+			},
+		},
+		{
+			Expr: `var r = match [] { [] => 0 }`,
+			Expected: []Node{
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "r"}},
+				&MatchExpression{},
+				&ArrayLiteral{},
+				&ArrayPattern{Elements: []Pattern{}},
+				&BlockStatement{},
+				&NumberLiteral{ActualValue: int64(0)},
+			},
+		},
+		{
+			Expr: `var [a, [b, _]] = pair`,
+			Expected: []Node{
+				&DestructuringStatement{},
+				&ArrayPattern{
+					Elements: []Pattern{
+						&BindingPattern{Name: "a"},
+						&ArrayPattern{Elements: []Pattern{&BindingPattern{Name: "b"}, &WildcardPattern{}}},
+					},
+				},
+				&IdentifierExpression{Name: "pair"},
+			},
+		},
+		{
+			Expr: `var {x, y: [first]} = point`,
+			Expected: []Node{
+				&DestructuringStatement{},
+				&ObjectPattern{
+					Fields: []*FieldPattern{
+						{Name: "x", Pattern: &BindingPattern{Name: "x"}},
+						{Name: "y", Pattern: &ArrayPattern{Elements: []Pattern{&BindingPattern{Name: "first"}}}},
+					},
+				},
+				&IdentifierExpression{Name: "point"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
+	}
+}
+
+func TestParser_Parse_ShouldFailMalformedPatterns(t *testing.T) {
+	tests := []string{
+		`match a { [a, b => 1 }`,
+		`match a { a 1 }`,
+		`match a { {1: a} => 1 }`,
+		`match a { a == 1 => 1 }`,
+		`var [a, ...rest, b] = c`,
+	}
+	for _, test := range tests {
+		parser := New(test)
+		parser.Parse()
+		assert.True(t, parser.Errors.HasAny(), test)
+	}
+}
+
+func TestParser_ParseConditionalExpressions(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: `a == 1 ? b + 1 : c`,
+			Expected: []Node{
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "=="}},
+				&NumberLiteral{ActualValue: int64(1)},
+				&IdentifierExpression{Name: "b"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "+"}},
+				&NumberLiteral{ActualValue: int64(1)},
+				&IdentifierExpression{Name: "c"},
+			},
+		},
+		{
+			// Right associative: a ? b : (c ? d : e)
+			Expr: `a ? b : c ? d : e`,
+			Expected: []Node{
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "a"},
+				&IdentifierExpression{Name: "b"},
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "c"},
+				&IdentifierExpression{Name: "d"},
+				&IdentifierExpression{Name: "e"},
+			},
+		},
+		{
+			// Nested in the then branch: a ? (b ? c : d) : e
+			Expr: `a ? b ? c : d : e`,
+			Expected: []Node{
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "a"},
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "b"},
+				&IdentifierExpression{Name: "c"},
+				&IdentifierExpression{Name: "d"},
+				&IdentifierExpression{Name: "e"},
+			},
+		},
+		{
+			Expr: `var x = a ?? b ? 1 : 2`,
+			Expected: []Node{
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "x"}},
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "??"}},
+				&IdentifierExpression{Name: "b"},
+				&NumberLiteral{ActualValue: int64(1)},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+		{
+			Expr: `var x = if a { 1 } else { 2 }`,
+			Expected: []Node{
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "x"}},
+				&IfStatement{},
+				&IdentifierExpression{Name: "a"},
+				&BlockStatement{},
+				&NumberLiteral{ActualValue: int64(1)},
+				&BlockStatement{},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
+	}
+
+	parser := New(`a ? b c`)
+	parser.Parse()
+	assert.True(t, parser.Errors.HasAny())
+}
+
+func TestParser_ParseSlices(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: `a[1:b]`,
+			Expected: []Node{
+				&SliceExpression{},
+				&IdentifierExpression{Name: "a"},
+				&NumberLiteral{ActualValue: int64(1)},
+				&IdentifierExpression{Name: "b"},
+			},
+		},
+		{
+			Expr: `a[:-1]`,
+			Expected: []Node{
+				&SliceExpression{},
+				&IdentifierExpression{Name: "a"},
+				&PrefixExpression{Op: lexer2.Token{Literal: "-"}},
+				&NumberLiteral{ActualValue: int64(1)},
+			},
+		},
+		{
+			Expr: `a[2:]`,
+			Expected: []Node{
+				&SliceExpression{},
+				&IdentifierExpression{Name: "a"},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+		{
+			Expr: `a[::2][0]`,
+			Expected: []Node{
+				&IndexAccess{},
+				&SliceExpression{},
+				&IdentifierExpression{Name: "a"},
+				&NumberLiteral{ActualValue: int64(2)},
+				&NumberLiteral{ActualValue: int64(0)},
+			},
+		},
+		{
+			Expr: `a[c ? 1 : 2:]`,
+			Expected: []Node{
+				&SliceExpression{},
+				&IdentifierExpression{Name: "a"},
+				&ConditionalExpression{},
+				&IdentifierExpression{Name: "c"},
+				&NumberLiteral{ActualValue: int64(1)},
+				&NumberLiteral{ActualValue: int64(2)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
+	}
+
+	for _, src := range []string{`a[1:2:3:4]`, `a[1:2] = 3`, `a[1:2`} {
+		parser := New(src)
+		parser.Parse()
+		assert.True(t, parser.Errors.HasAny(), src)
+	}
+}
+
 func TestParser_ParseForStatement(t *testing.T) {
 	tests := []struct {
 		Expr     string
@@ -834,6 +1628,92 @@ func TestParser_ParseForStatement(t *testing.T) {
 		rootNode.Accept(testingVisitor)
 	}
 }
+
+func TestParser_ParseLoopStatements(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{
+			Expr: `for var i = 0; i < 10; i = i + 1 { break }`,
+			Expected: []Node{
+				&ForClauseStatement{},
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "i"}},
+				&NumberLiteral{ActualValue: int64(0)},
+				&IdentifierExpression{Name: "i"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "<"}},
+				&NumberLiteral{ActualValue: int64(10)},
+				&AssignExpression{VarName: "i"},
+				&IdentifierExpression{Name: "i"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "+"}},
+				&NumberLiteral{ActualValue: int64(1)},
+				&BlockStatement{},
+				&BreakStatement{},
+			},
+		},
+		{
+			Expr: `for i = 0; i < 10; { continue }`,
+			Expected: []Node{
+				&ForClauseStatement{},
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "i"}},
+				&NumberLiteral{ActualValue: int64(0)},
+				&IdentifierExpression{Name: "i"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "<"}},
+				&NumberLiteral{ActualValue: int64(10)},
+				&BlockStatement{},
+				&ContinueStatement{},
+			},
+		},
+		{
+			Expr: `for ;; {}`,
+			Expected: []Node{
+				&ForClauseStatement{},
+				&BlockStatement{},
+			},
+		},
+		{
+			Expr: `while a < 10 { a = a + 1 }`,
+			Expected: []Node{
+				&WhileStatement{},
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "<"}},
+				&NumberLiteral{ActualValue: int64(10)},
+				&BlockStatement{},
+				&AssignExpression{VarName: "a"},
+				&IdentifierExpression{Name: "a"},
+				&BinaryExpression{Op: lexer2.Token{Literal: "+"}},
+				&NumberLiteral{ActualValue: int64(1)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+		assert.Equal(t, len(test.Expected), testingVisitor.ptr)
+	}
+}
+
+func TestParser_Parse_ShouldFailLoopControlOutsideLoop(t *testing.T) {
+	tests := []string{
+		`break`,
+		`continue`,
+		`while true { func a() { break } }`,
+	}
+	for _, test := range tests {
+		parser := New(test)
+		parser.Parse()
+		assert.True(t, parser.Errors.HasAny())
+	}
+}
+
 func TestParser_Parse_ParseFunctionDeclaration(t *testing.T) {
 	tests := []struct {
 		Expr     string
@@ -932,7 +1812,7 @@ func TestParser_Parse_ParseFunctionCall(t *testing.T) {
 				&NumberLiteral{1},
 				&BinaryExpression{Op: lexer2.Token{Literal: lexer2.Plus}},
 				&NumberLiteral{42},
-				&IdentifierExpression{"java"},
+				&IdentifierExpression{Name: "java"},
 				&BooleanLiteral{
 					ActualValue: true,
 				},
@@ -948,7 +1828,7 @@ func TestParser_Parse_ParseFunctionCall(t *testing.T) {
 				&NumberLiteral{1},
 				&BinaryExpression{Op: lexer2.Token{Literal: lexer2.Plus}},
 				&NumberLiteral{42},
-				&IdentifierExpression{"java"},
+				&IdentifierExpression{Name: "java"},
 				&BooleanLiteral{
 					ActualValue: true,
 				},
@@ -1205,6 +2085,21 @@ func TestParser_Parse_ParseNewCall(t *testing.T) {
 				&StringLiteral{Value: "foo"},
 			},
 		},
+		{
+			Expr: `
+		 var a = new geometry.Point(1)
+		 `,
+			Expected: []Node{
+				&DeclarationStatement{
+					Identifier: lexer2.Token{Literal: "a"},
+				},
+				&NewCallExpr{
+					Module: "geometry",
+					Type:   "Point",
+				},
+				&NumberLiteral{ActualValue: 1},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -1235,3 +2130,63 @@ func TestParser_Parse_ErrorNewCall(t *testing.T) {
 		assert.True(t, parser.Errors.HasAny())
 	}
 }
+
+func TestParser_Parse_ParseImportStatement(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected []Node
+	}{
+		{`import "lib/math.comet" as m`, []Node{&ImportStatement{Path: "lib/math.comet", Alias: "m"}}},
+		{`import "lib/math.comet"`, []Node{&ImportStatement{Path: "lib/math.comet", Alias: "math"}}},
+		{`import "utils"`, []Node{&ImportStatement{Path: "utils", Alias: "utils"}}},
+		{
+			`import { fib, Point } from "lib/math.comet"`,
+			[]Node{&ImportStatement{Path: "lib/math.comet", Names: []*IdentifierExpression{{Name: "fib"}, {Name: "Point"}}}},
+		},
+		// as and from are not keywords.
+		{
+			"import \"a.comet\" as a\n var from = as",
+			[]Node{
+				&ImportStatement{Path: "a.comet", Alias: "a"},
+				&DeclarationStatement{Identifier: lexer2.Token{Literal: "from"}},
+				&IdentifierExpression{Name: "as"},
+			},
+		},
+	}
+	for _, test := range tests {
+		parser := New(test.Expr)
+		rootNode := parser.Parse()
+		assert.False(t, parser.Errors.HasAny(), parser.Errors.String())
+
+		testingVisitor := &TestingVisitor{
+			expected: test.Expected,
+			ptr:      0,
+			t:        t,
+		}
+		rootNode.Accept(testingVisitor)
+	}
+}
+
+func TestParser_Parse_ShouldFailMalformedImports(t *testing.T) {
+	tests := []string{
+		`import`,
+		`import m`,
+		`import "a.comet" as`,
+		`import "my-module.comet"`,
+		`import { a b } from "a.comet"`,
+		`import { a } "a.comet"`,
+		`import { a } from b`,
+		"import \"a.comet\" as m\n var m = 1",
+		"import { a } from \"a.comet\"\n const a = 1",
+	}
+	for _, test := range tests {
+		parser := New(test)
+		parser.Parse()
+		assert.True(t, parser.Errors.HasAny(), test)
+	}
+}
+
+func bigIntOf(s string) *big.Int {
+	v, _ := new(big.Int).SetString(s, 10)
+	return v
+}
@@ -0,0 +1,426 @@
+// Package resolve implements a static pass over the AST that runs before evaluation.
+//
+// The Resolver binds every variable use to its declaration, and reports undefined variables and
+// variables used before their declaration. The constants, the redeclarations and the duplicate
+// parameters are reported by the parser.
+package resolve
+
+import (
+	"fmt"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+)
+
+// Position of a token in the source code.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func positionOf(token lexer.Token) Position {
+	return Position{Line: token.LineNumber, Column: token.ColumnNumber}
+}
+
+// Binding is the declaration a variable use resolves to.
+// Depth is the number of scopes between the use and the declaration, Slot is the index of the
+// declaration within its scope.
+type Binding struct {
+	Name  string
+	Depth int
+	Slot  int
+}
+
+// scope holds the slots of the names declared in a scope of the program, it's created for the same
+// nodes as the scopes of the parser. function is true for the scopes of the function bodies.
+type scope struct {
+	slots    map[string]int
+	function bool
+}
+
+func newScope(function bool) *scope {
+	return &scope{
+		slots:    make(map[string]int),
+		function: function,
+	}
+}
+
+// unresolved is a use of a name that is not declared when it is visited.
+type unresolved struct {
+	token lexer.Token
+	name  string
+	// The scopes enclosing the use, innermost last.
+	chain []*scope
+	// builtin is true for the calls of a builtin, they call the builtin if the name is not declared.
+	builtin bool
+}
+
+type Resolver struct {
+	Errors *parser.ErrorBag
+	// Bindings maps the position of every resolved variable use to its declaration.
+	Bindings map[Position]Binding
+
+	builtins   map[string]bool
+	scopes     []*scope
+	unresolved []*unresolved
+}
+
+// New creates a resolver, globals are names already declared in the global scope
+// (e.g. by previously evaluated sources in the REPL).
+func New(globals ...string) *Resolver {
+	r := &Resolver{
+		Errors:   &parser.ErrorBag{},
+		Bindings: make(map[Position]Binding),
+		builtins: make(map[string]bool),
+		scopes:   []*scope{newScope(false)},
+	}
+	for _, builtin := range std.Builtins {
+		r.builtins[builtin.Name] = true
+	}
+	for _, name := range globals {
+		r.declare(name)
+	}
+	return r
+}
+
+// Resolve walks the given program, errors are reported in r.Errors.
+func (r *Resolver) Resolve(root *parser.RootNode) {
+	root.Accept(r)
+	for _, use := range r.unresolved {
+		if !use.builtin {
+			r.report(use.token, "Undefined variable '%s'", use.name)
+		}
+	}
+	r.unresolved = nil
+}
+
+func (r *Resolver) report(token lexer.Token, message string, params ...interface{}) {
+	r.Errors.Report(token, "%s (line %d, column %d)", fmt.Sprintf(message, params...), token.LineNumber, token.ColumnNumber)
+}
+
+func (r *Resolver) pushScope(function bool) {
+	r.scopes = append(r.scopes, newScope(function))
+}
+
+func (r *Resolver) popScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// Binds the use of name to the closest declaration, if the name is not declared yet the
+// use is kept until a declaration is found or the whole program is resolved.
+func (r *Resolver) use(token lexer.Token, name string) {
+	r.bind(token, name, false)
+}
+
+func (r *Resolver) bind(token lexer.Token, name string, builtin bool) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if slot, found := r.scopes[i].slots[name]; found {
+			r.Bindings[positionOf(token)] = Binding{Name: name, Depth: len(r.scopes) - 1 - i, Slot: slot}
+			return
+		}
+	}
+	chain := make([]*scope, len(r.scopes))
+	copy(chain, r.scopes)
+	r.unresolved = append(r.unresolved, &unresolved{token: token, name: name, chain: chain, builtin: builtin})
+}
+
+// Declares name in the current scope, and checks the uses of name that were visited before.
+// A function body can use a name declared after the function in an enclosing scope, as the
+// function can be called after the declaration. Any other use is an error.
+func (r *Resolver) declare(name string) {
+	current := r.scopes[len(r.scopes)-1]
+	if _, found := current.slots[name]; !found {
+		current.slots[name] = len(current.slots)
+	}
+	remaining := make([]*unresolved, 0, len(r.unresolved))
+	for _, use := range r.unresolved {
+		index := indexOf(use.chain, current)
+		if use.name != name || index < 0 {
+			remaining = append(remaining, use)
+			continue
+		}
+		if crossesFunction(use.chain[index+1:]) {
+			r.Bindings[positionOf(use.token)] = Binding{Name: name, Depth: len(use.chain) - 1 - index, Slot: current.slots[name]}
+		} else if !use.builtin {
+			r.report(use.token, "Variable '%s' is used before its declaration", name)
+		}
+	}
+	r.unresolved = remaining
+}
+
+func indexOf(chain []*scope, target *scope) int {
+	for i, s := range chain {
+		if s == target {
+			return i
+		}
+	}
+	return -1
+}
+
+func crossesFunction(chain []*scope) bool {
+	for _, s := range chain {
+		if s.function {
+			return true
+		}
+	}
+	return false
+}
+
+// Declares the parameters of a function in the current scope.
+func (r *Resolver) declareParameters(parameters []*parser.IdentifierExpression) {
+	for _, param := range parameters {
+		r.declare(param.Name)
+	}
+}
+
+func (r *Resolver) VisitExpression(parser.Expression) {}
+
+func (r *Resolver) VisitStatement(parser.Statement) {}
+
+func (r *Resolver) VisitRootNode(node parser.RootNode) {
+	for _, statement := range node.Statements {
+		statement.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitBinaryExpression(expression parser.BinaryExpression) {
+	expression.Left.Accept(r)
+	if expression.Op.Type != lexer.Dot && expression.Op.Type != lexer.QuestionDot {
+		expression.Right.Accept(r)
+		return
+	}
+	// The right side of a member access names a field or a method, not a variable.
+	switch right := expression.Right.(type) {
+	case *parser.IdentifierExpression:
+	case *parser.CallExpression:
+		for _, arg := range right.Arguments {
+			arg.Accept(r)
+		}
+	case *parser.AssignExpression:
+		right.Value.Accept(r)
+	default:
+		right.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitPrefixExpression(expression parser.PrefixExpression) {
+	expression.Right.Accept(r)
+}
+
+func (r *Resolver) VisitConditionalExpression(expression parser.ConditionalExpression) {
+	expression.Test.Accept(r)
+	expression.Then.Accept(r)
+	expression.Else.Accept(r)
+}
+
+func (r *Resolver) VisitNumberLiteral(parser.NumberLiteral) {}
+
+func (r *Resolver) VisitBigIntLiteral(parser.BigIntLiteral) {}
+
+func (r *Resolver) VisitFloatLiteral(parser.FloatLiteral) {}
+
+func (r *Resolver) VisitBooleanLiteral(parser.BooleanLiteral) {}
+
+func (r *Resolver) VisitNilLiteral(parser.NilLiteral) {}
+
+func (r *Resolver) VisitStringLiteral(parser.StringLiteral) {}
+
+func (r *Resolver) VisitArrayLiteral(array parser.ArrayLiteral) {
+	for _, element := range array.Elements {
+		element.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitParenthesisedExpression(expression parser.ParenthesisedExpression) {
+	expression.Expression.Accept(r)
+}
+
+func (r *Resolver) VisitIdentifierExpression(expression parser.IdentifierExpression) {
+	r.use(expression.Token, expression.Name)
+}
+
+func (r *Resolver) VisitCallExpression(expression parser.CallExpression) {
+	// Calls a builtin if the name is not declared.
+	r.bind(expression.Token, expression.Name, r.builtins[expression.Name])
+	for _, arg := range expression.Arguments {
+		arg.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitAssignExpression(expression parser.AssignExpression) {
+	r.use(expression.Token, expression.VarName)
+	expression.Value.Accept(r)
+}
+
+func (r *Resolver) VisitArrayAccess(access parser.IndexAccess) {
+	access.Identifier.Accept(r)
+	access.Index.Accept(r)
+}
+
+func (r *Resolver) VisitSliceExpression(expression parser.SliceExpression) {
+	expression.Target.Accept(r)
+	for _, bound := range []parser.Expression{expression.Start, expression.Stop, expression.Step} {
+		if bound != nil {
+			bound.Accept(r)
+		}
+	}
+}
+
+func (r *Resolver) VisitIndexAssignExpression(expression parser.IndexAssignExpression) {
+	expression.Target.Accept(r)
+	expression.Value.Accept(r)
+}
+
+func (r *Resolver) VisitNewCall(call parser.NewCallExpr) {
+	for _, arg := range call.Args {
+		arg.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitMatchExpression(expression parser.MatchExpression) {
+	expression.Subject.Accept(r)
+	for _, arm := range expression.Arms {
+		r.pushScope(false)
+		arm.Pattern.Accept(r)
+		for _, name := range parser.PatternNames(arm.Pattern) {
+			r.declare(name)
+		}
+		arm.Body.Accept(r)
+		r.popScope()
+	}
+}
+
+func (r *Resolver) VisitWildcardPattern(parser.WildcardPattern) {}
+
+func (r *Resolver) VisitBindingPattern(parser.BindingPattern) {}
+
+func (r *Resolver) VisitLiteralPattern(pattern parser.LiteralPattern) {
+	pattern.Value.Accept(r)
+}
+
+func (r *Resolver) VisitArrayPattern(pattern parser.ArrayPattern) {
+	for _, element := range pattern.Elements {
+		element.Accept(r)
+	}
+	if pattern.Rest != nil {
+		pattern.Rest.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitObjectPattern(pattern parser.ObjectPattern) {
+	for _, field := range pattern.Fields {
+		field.Pattern.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitStructPattern(pattern parser.StructPattern) {
+	for _, element := range pattern.Elements {
+		element.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitDeclarationStatement(statement parser.DeclarationStatement) {
+	statement.Expression.Accept(r)
+	r.declare(statement.Identifier.Literal)
+}
+
+func (r *Resolver) VisitDestructuringStatement(statement parser.DestructuringStatement) {
+	statement.Expression.Accept(r)
+	statement.Pattern.Accept(r)
+	for _, name := range parser.PatternNames(statement.Pattern) {
+		r.declare(name)
+	}
+}
+
+func (r *Resolver) VisitReturnStatement(statement parser.ReturnStatement) {
+	statement.Expression.Accept(r)
+}
+
+func (r *Resolver) VisitBlockStatement(statement parser.BlockStatement) {
+	for _, st := range statement.Statements {
+		st.Accept(r)
+	}
+}
+
+func (r *Resolver) VisitIfStatement(statement parser.IfStatement) {
+	statement.Test.Accept(r)
+	statement.Then.Accept(r)
+	statement.Else.Accept(r)
+}
+
+func (r *Resolver) VisitFunctionStatement(statement parser.FunctionStatement) {
+	// Declared before the body to allow recursive calls.
+	r.declare(statement.Name)
+	r.pushScope(true)
+	r.declareParameters(statement.Parameters)
+	statement.Block.Accept(r)
+	r.popScope()
+}
+
+func (r *Resolver) VisitForStatement(statement parser.ForStatement) {
+	statement.Range.Accept(r)
+	r.pushScope(false)
+	r.declare(statement.Key.Name)
+	r.declare(statement.Value.Name)
+	statement.Body.Accept(r)
+	r.popScope()
+}
+
+func (r *Resolver) VisitForClauseStatement(statement parser.ForClauseStatement) {
+	r.pushScope(false)
+	if statement.Init != nil {
+		statement.Init.Accept(r)
+	}
+	if statement.Test != nil {
+		statement.Test.Accept(r)
+	}
+	if statement.Post != nil {
+		statement.Post.Accept(r)
+	}
+	r.pushScope(false)
+	statement.Body.Accept(r)
+	r.popScope()
+	r.popScope()
+}
+
+func (r *Resolver) VisitWhileStatement(statement parser.WhileStatement) {
+	statement.Test.Accept(r)
+	r.pushScope(false)
+	statement.Body.Accept(r)
+	r.popScope()
+}
+
+func (r *Resolver) VisitSwitchStatement(statement parser.SwitchStatement) {
+	statement.Subject.Accept(r)
+	for _, switchCase := range statement.Cases {
+		for _, value := range switchCase.Values {
+			value.Accept(r)
+		}
+		switchCase.Body.Accept(r)
+	}
+	statement.Default.Accept(r)
+}
+
+func (r *Resolver) VisitBreakStatement(parser.BreakStatement) {}
+
+func (r *Resolver) VisitContinueStatement(parser.ContinueStatement) {}
+
+func (r *Resolver) VisitImportStatement(statement parser.ImportStatement) {
+	if statement.Alias != "" {
+		r.declare(statement.Alias)
+		return
+	}
+	for _, name := range statement.Names {
+		r.declare(name.Name)
+	}
+}
+
+func (r *Resolver) VisitStructDeclaration(statement parser.StructDeclarationStatement) {
+	for _, method := range statement.Methods {
+		r.pushScope(true)
+		r.declare("this")
+		r.declareParameters(method.Parameters)
+		method.Block.Accept(r)
+		r.popScope()
+	}
+}
@@ -0,0 +1,96 @@
+package resolve
+
+import (
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func resolveOrDie(t *testing.T, src string, globals ...string) *Resolver {
+	p := parser.New(src)
+	root := p.Parse()
+	assert.False(t, p.Errors.HasAny(), p.Errors.String())
+	resolver := New(globals...)
+	resolver.Resolve(root)
+	return resolver
+}
+
+func TestResolver_Resolve_Errors(t *testing.T) {
+	tests := []struct {
+		Src   string
+		Error string
+	}{
+		{"a + 1", "Undefined variable 'a' (line 1, column 1)"},
+		{"var a = 1\n a + b", "Undefined variable 'b' (line 2, column 6)"},
+		{"b = 2", "Undefined variable 'b' (line 1, column 1)"},
+		{"f(1)", "Undefined variable 'f' (line 1, column 1)"},
+		{"func f() { return x }", "Undefined variable 'x' (line 1, column 19)"},
+		{"func f() { var x = 1 }\n x", "Undefined variable 'x' (line 2, column 2)"},
+		{"for i in 0..2 {}\n i", "Undefined variable 'i' (line 2, column 2)"},
+		{"match 1 { x => x }\n x", "Undefined variable 'x' (line 2, column 2)"},
+		{"struct A { func get() { return this } }\n this", "Undefined variable 'this' (line 2, column 2)"},
+		{"a + 1\n var a = 2", "Variable 'a' is used before its declaration (line 1, column 1)"},
+		{"var a = a", "Variable 'a' is used before its declaration (line 1, column 9)"},
+		{"while true { x = 1\n var x = 2 }", "Variable 'x' is used before its declaration (line 1, column 14)"},
+	}
+	for _, test := range tests {
+		resolver := resolveOrDie(t, test.Src)
+		if assert.True(t, resolver.Errors.HasAny(), test.Src) {
+			assert.Equal(t, test.Error, resolver.Errors.Errors[0].Message, test.Src)
+		}
+	}
+}
+
+func TestResolver_Resolve_Valid(t *testing.T) {
+	tests := []string{
+		"var a = 1\n a + 1",
+		"println(\"hello\")",
+		// Functions can use names declared after them, before they are called.
+		"func f() { return g() }\n func g() { return a }\n var a = 1\n f()",
+		"func fib(n) { if n < 2 { return n }\n return fib(n - 1) + fib(n - 2) }",
+		"for i = 0; i < 10; i++ { var j = i }",
+		"for k, v in [1, 2] { println(k + v) }",
+		"var a = 1\n if true { var b = a }\n b",
+		"match [1, 2] { [x, ...rest] => x, _ => 0 }",
+		"var [a, [b, c]] = [1, [2, 3]]\n a + b + c",
+		"struct Point { func init(x, y) { this.x = x\n this.y = y }\n func sum() { return this.x + this.y } }\n var p = new Point(1, 2)\n p.sum()",
+		"var p = nil\n p?.x\n p.f(p)",
+		"var a = [1, 2, 3]\n a[0:-1:1]\n a[1] = 2",
+	}
+	for _, src := range tests {
+		resolver := resolveOrDie(t, src)
+		assert.False(t, resolver.Errors.HasAny(), "%s: %s", src, resolver.Errors)
+	}
+}
+
+func TestResolver_Resolve_Globals(t *testing.T) {
+	resolver := resolveOrDie(t, "a + b", "a", "b")
+	assert.False(t, resolver.Errors.HasAny())
+}
+
+func TestResolver_Resolve_Bindings(t *testing.T) {
+	resolver := resolveOrDie(t, "var a = 1\n var b = 2\n func f(x) { return x + b }\n f(a)")
+
+	assert.Equal(t, map[Position]Binding{
+		{Line: 3, Column: 21}: {Name: "x", Depth: 0, Slot: 0},
+		{Line: 3, Column: 25}: {Name: "b", Depth: 1, Slot: 1},
+		{Line: 4, Column: 2}:  {Name: "f", Depth: 0, Slot: 2},
+		{Line: 4, Column: 4}:  {Name: "a", Depth: 0, Slot: 0},
+	}, resolver.Bindings)
+}
+
+func TestResolver_Resolve_ShadowedBuiltins(t *testing.T) {
+	resolver := resolveOrDie(t, "len([1])\n func len(x) { return 0 }\n func f() { return len(1) }")
+
+	assert.False(t, resolver.Errors.HasAny(), resolver.Errors.String())
+	assert.Equal(t, map[Position]Binding{
+		{Line: 3, Column: 20}: {Name: "len", Depth: 1, Slot: 0},
+	}, resolver.Bindings)
+}
+
+func TestResolver_Resolve_LateBinding(t *testing.T) {
+	resolver := resolveOrDie(t, "func f() { return a }\n var a = 1")
+
+	assert.False(t, resolver.Errors.HasAny())
+	assert.Equal(t, Binding{Name: "a", Depth: 1, Slot: 1}, resolver.Bindings[Position{Line: 1, Column: 19}])
+}
@@ -0,0 +1,347 @@
+package std
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+)
+
+// ArrayBuiltins are the array functions of the standard library, they are part of Builtins.
+// The higher order functions call their callbacks with the element and its index, callbacks
+// declaring less parameters ignore the index. An error returned by a callback stops the builtin
+// and is returned as is.
+var ArrayBuiltins = []*Builtin{
+	{
+		Name:    "len",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			switch n := args[0].(type) {
+			case *CometArray:
+				return &CometInt{Value: int64(n.Length)}
+			case *CometStr:
+				return &CometInt{Value: int64(utf8.RuneCountInString(n.Value))}
+			default:
+				return ctx.Errorf("Builtin 'len' expects an array or a string, got %s", args[0].Type())
+			}
+		},
+	},
+	{
+		Name:     "push",
+		MinArgs:  2,
+		MaxArgs:  -1,
+		ArgTypes: []CometType{ArrayType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Appends the values to the array in place, and returns the array.
+			array := args[0].(*CometArray)
+			if err := ctx.CheckSize(int64(array.Length) + int64(len(args)-1)); err != nil {
+				return err
+			}
+			array.Values = append(array.Values, args[1:]...)
+			array.Length = len(array.Values)
+			return array
+		},
+	},
+	{
+		Name:     "pop",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{ArrayType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Removes the last element of the array in place, and returns it.
+			array := args[0].(*CometArray)
+			if array.Length == 0 {
+				return ctx.Errorf("Cannot pop an element from an empty array")
+			}
+			last := array.Values[array.Length-1]
+			array.Values = array.Values[:array.Length-1]
+			array.Length--
+			return last
+		},
+	},
+	{
+		Name:     "map",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{ArrayType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			elements := args[0].(*CometArray).Values
+			values := make([]CometObject, len(elements))
+			for i, element := range elements {
+				values[i] = ctx.CallFunction(args[1], element, &CometInt{Value: int64(i)})
+				if values[i].Type() == ErrorType {
+					return values[i]
+				}
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "filter",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{ArrayType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			values := make([]CometObject, 0)
+			for i, element := range args[0].(*CometArray).Values {
+				keep := ctx.CallFunction(args[1], element, &CometInt{Value: int64(i)})
+				if keep.Type() == ErrorType {
+					return keep
+				}
+				if IsTruthy(keep) {
+					values = append(values, element)
+				}
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "reduce",
+		MinArgs:  2,
+		MaxArgs:  3,
+		ArgTypes: []CometType{ArrayType, AnyType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Folds the elements with the callback called with the accumulator, the element and its
+			// index. The accumulator starts with the third argument, or the first element.
+			elements, start := args[0].(*CometArray).Values, 0
+			var accumulator CometObject
+			if len(args) == 3 {
+				accumulator = args[2]
+			} else if len(elements) == 0 {
+				return ctx.Errorf("Cannot reduce an empty array without an initial value")
+			} else {
+				accumulator, start = elements[0], 1
+			}
+			for i := start; i < len(elements); i++ {
+				accumulator = ctx.CallFunction(args[1], accumulator, elements[i], &CometInt{Value: int64(i)})
+				if accumulator.Type() == ErrorType {
+					return accumulator
+				}
+			}
+			return accumulator
+		},
+	},
+	{
+		Name:     "sort",
+		MinArgs:  1,
+		MaxArgs:  2,
+		ArgTypes: []CometType{ArrayType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Returns a sorted copy of the array, the order of equal elements is kept. Numbers and
+			// strings are sorted in ascending order, or by the callback which is called with two
+			// elements and returns whether the first one comes before the second one.
+			values := append([]CometObject{}, args[0].(*CometArray).Values...)
+			var err CometObject
+			sort.SliceStable(values, func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				if len(args) == 2 {
+					less := ctx.CallFunction(args[1], values[i], values[j])
+					if less.Type() == ErrorType {
+						err = less
+						return false
+					}
+					return IsTruthy(less)
+				}
+				order, ok := compare(values[i], values[j])
+				if !ok {
+					err = ctx.Errorf("Cannot compare values of type %s and %s, sort them with a callback instead", values[i].Type(), values[j].Type())
+				}
+				return order < 0
+			})
+			if err != nil {
+				return err
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "reverse",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{ArrayType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			elements := args[0].(*CometArray).Values
+			values := make([]CometObject, len(elements))
+			for i, element := range elements {
+				values[len(elements)-1-i] = element
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "contains",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{ArrayType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			for _, element := range args[0].(*CometArray).Values {
+				if Equals(element, args[1]) {
+					return TrueObject
+				}
+			}
+			return FalseObject
+		},
+	},
+	{
+		Name:     "zip",
+		MinArgs:  2,
+		MaxArgs:  -1,
+		ArgTypes: []CometType{ArrayType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Groups the elements of the arrays by index, up to the length of the shortest array.
+			length := args[0].(*CometArray).Length
+			for _, arg := range args[1:] {
+				if arg.(*CometArray).Length < length {
+					length = arg.(*CometArray).Length
+				}
+			}
+			if err := ctx.CheckSize(int64(length)); err != nil {
+				return err
+			}
+			values := make([]CometObject, length)
+			for i := range values {
+				tuple := make([]CometObject, len(args))
+				for j, arg := range args {
+					tuple[j] = arg.(*CometArray).Values[i]
+				}
+				values[i] = newArray(tuple)
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "range",
+		MinArgs:  1,
+		MaxArgs:  3,
+		ArgTypes: []CometType{IntType, IntType, IntType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// range(end), range(start, end) and range(start, end, step) return the integers from
+			// start included to end excluded.
+			start, end, step := int64(0), args[0].(*CometInt).Value, int64(1)
+			if len(args) > 1 {
+				start, end = end, args[1].(*CometInt).Value
+			}
+			if len(args) > 2 {
+				step = args[2].(*CometInt).Value
+			}
+			if step == 0 {
+				return ctx.Errorf("The step of a range can't be 0")
+			}
+			count := rangeLength(start, end, step)
+			if err := ctx.CheckSize(count); err != nil {
+				return err
+			}
+			// The array grows by chunks, so that building a large range can be cancelled.
+			values := make([]CometObject, 0, minInt64(count, rangeChunk))
+			for i, value := int64(0), start; i < count; i, value = i+1, value+step {
+				if i > 0 && i%rangeChunk == 0 {
+					if err := ctx.CheckSize(count); err != nil {
+						return err
+					}
+				}
+				values = append(values, &CometInt{Value: value})
+			}
+			return newArray(values)
+		},
+	},
+}
+
+// rangeChunk is the number of elements added to a range between two checks of the context.
+const rangeChunk = 1 << 16
+
+// rangeLength returns the number of elements of a range, capped at math.MaxInt64.
+func rangeLength(start, end, step int64) int64 {
+	if (step > 0 && start >= end) || (step < 0 && start <= end) {
+		return 0
+	}
+	// The differences are computed on unsigned integers, where they can't overflow.
+	distance, stride := uint64(end)-uint64(start), uint64(step)
+	if step < 0 {
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	}
+	count := (distance-1)/stride + 1
+	if count > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(count)
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Equals reports whether two values are equal. Numbers are compared by value across integer types,
+// strings, booleans and nil by value, arrays element by element, and other objects by identity.
+func Equals(left CometObject, right CometObject) bool {
+	if order, ok := compare(left, right); ok {
+		return order == 0
+	}
+	switch l := left.(type) {
+	case *CometBool:
+		r, ok := right.(*CometBool)
+		return ok && l.Value == r.Value
+	case *CometNil:
+		return right.Type() == NilType
+	case *CometArray:
+		r, ok := right.(*CometArray)
+		if !ok || l.Length != r.Length {
+			return false
+		}
+		for i := range l.Values {
+			if !Equals(l.Values[i], r.Values[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
+
+// compare orders two numbers or two strings, ok is false for other values.
+func compare(left CometObject, right CometObject) (order int, ok bool) {
+	if l, isStr := left.(*CometStr); isStr {
+		r, isStr := right.(*CometStr)
+		if !isStr {
+			return 0, false
+		}
+		switch {
+		case l.Value < r.Value:
+			return -1, true
+		case l.Value > r.Value:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+	l, leftIsNumber := toBigFloat(left)
+	r, rightIsNumber := toBigFloat(right)
+	if !leftIsNumber || !rightIsNumber {
+		return 0, false
+	}
+	return l.Cmp(r), true
+}
+
+// toBigFloat converts a number to a big.Float, which represents integers and floats exactly.
+func toBigFloat(object CometObject) (*big.Float, bool) {
+	switch n := object.(type) {
+	case *CometInt:
+		return new(big.Float).SetInt64(n.Value), true
+	case *CometBigInt:
+		return new(big.Float).SetInt(n.Value), true
+	case *CometFloat:
+		if n.Value != n.Value {
+			// NaN isn't ordered.
+			return nil, false
+		}
+		return new(big.Float).SetFloat64(n.Value), true
+	default:
+		return nil, false
+	}
+}
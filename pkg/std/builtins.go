@@ -2,72 +2,209 @@ package std
 
 import (
 	"fmt"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"io"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
-type Callback func(args ...CometObject) CometObject
+// AnyType accepts arguments of every type in the signature of a builtin.
+const AnyType CometType = "ANY"
 
+// Interpreter is the engine running the program calling a builtin, the evaluator or the vm.
+type Interpreter interface {
+	// CallFunction invokes a function value of the program with the given arguments.
+	CallFunction(function CometObject, args ...CometObject) CometObject
+	// Lookup returns the value bound to the given name in the scope of the builtin call.
+	Lookup(name string) (CometObject, bool)
+	// CheckSize returns an error if a collection of the given size, in elements for the arrays and
+	// in bytes for the strings, exceeds the limits of the interpreter, or if the evaluation was
+	// stopped. Builtins call it before allocating a collection, and periodically in long loops.
+	CheckSize(size int64) CometObject
+}
+
+// Context is the execution context of a builtin call, it gives access to the interpreter calling
+// the builtin, its streams, and the position of the call.
+type Context struct {
+	Interpreter
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+	// Site is the token of the call expression, its position is zero if the call has no source.
+	Site lexer.Token
+	// Capabilities are the accesses to the system granted by the interpreter.
+	Capabilities Capabilities
+}
+
+// Errorf creates an error reporting the position of the builtin call.
+func (ctx *Context) Errorf(format string, params ...interface{}) CometObject {
+	message := fmt.Sprintf(format, params...)
+	if ctx.Site.LineNumber == 0 {
+		return CreateError("%s", message)
+	}
+	return CreateError("%s (line %d, column %d)", message, ctx.Site.LineNumber, ctx.Site.ColumnNumber)
+}
+
+type Callback func(ctx *Context, args ...CometObject) CometObject
+
+// Builtin is a function implemented in Go, its signature is declared by MinArgs, MaxArgs and
+// ArgTypes, and the arguments are checked against it before Func is called.
 type Builtin struct {
 	Name string
-	Func Callback
+	// MinArgs and MaxArgs bound the number of arguments, MaxArgs is negative for variadic builtins.
+	MinArgs int
+	MaxArgs int
+	// ArgTypes are the expected types of the arguments by position, AnyType accepts every type.
+	// The last type applies to the remaining arguments of variadic builtins, the arguments
+	// without a type are not checked.
+	ArgTypes []CometType
+	Func     Callback
+}
+
+func (b *Builtin) Type() CometType {
+	return BuiltinType
+}
+
+func (b *Builtin) ToString() string {
+	return fmt.Sprintf("Builtin(%s)", b.Name)
+}
+
+// Invoke checks the arguments against the signature of the builtin and calls it.
+func (b *Builtin) Invoke(ctx *Context, args ...CometObject) CometObject {
+	if err := b.checkArgs(ctx, args); err != nil {
+		return err
+	}
+	return b.Func(ctx, args...)
+}
+
+func (b *Builtin) checkArgs(ctx *Context, args []CometObject) CometObject {
+	if len(args) < b.MinArgs || (b.MaxArgs >= 0 && len(args) > b.MaxArgs) {
+		return ctx.Errorf("Builtin '%s' expects %s, got %d", b.Name, b.describeArity(), len(args))
+	}
+	for i, arg := range args {
+		expected := AnyType
+		if i < len(b.ArgTypes) {
+			expected = b.ArgTypes[i]
+		} else if b.MaxArgs < 0 && len(b.ArgTypes) > 0 {
+			expected = b.ArgTypes[len(b.ArgTypes)-1]
+		}
+		if expected != AnyType && arg.Type() != expected {
+			return ctx.Errorf("Argument %d of builtin '%s' expected to be %s, got %s instead", i+1, b.Name, expected, arg.Type())
+		}
+	}
+	return nil
+}
+
+func (b *Builtin) describeArity() string {
+	switch {
+	case b.MaxArgs < 0:
+		return "at least " + plural(b.MinArgs, "argument")
+	case b.MinArgs == b.MaxArgs:
+		return plural(b.MinArgs, "argument")
+	case b.MaxArgs == b.MinArgs+1:
+		return fmt.Sprintf("%d or %d arguments", b.MinArgs, b.MaxArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", b.MinArgs, b.MaxArgs)
+	}
+}
+
+// plural formats a count of the given noun, "1 argument" or "2 arguments".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
 }
 
 // Global builtin singletons
 var (
 	TrueObject  = &CometBool{true}
 	FalseObject = &CometBool{false}
+	NilObject   = &CometNil{}
 	NopInstance = &NopObject{}
+
+	BreakInstance    = &CometBreak{}
+	ContinueInstance = &CometContinue{}
 )
 
-var Builtins = []*Builtin{
+// Builtins are the functions available to every program, the array and system functions are
+// declared in arrays.go and os.go.
+var Builtins = append(append([]*Builtin{
 	{
-		Name: "printf",
-		Func: func(args ...CometObject) CometObject {
-			if len(args) == 0 {
-				// Just an empty line call
-				return CreateError("Expected 1 or more arguments, got none.")
+		Name:     "printf",
+		MinArgs:  1,
+		MaxArgs:  -1,
+		ArgTypes: []CometType{StrType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// The format is the one of strings.format, each {} is replaced by the next argument.
+			result, err := format(ctx, "printf", args[0].(*CometStr).Value, args[1:])
+			if err != nil {
+				return err
 			}
-			if args[0].Type() != StrType {
-				return CreateError("First argument expected to be CometString got '%s' instead", args[0].Type())
-			}
-			transArgs := make([]interface{}, 0)
-			for i := 1; i < len(args); i++ {
-				transArgs = append(transArgs, extractPrimitive(args[i]))
-			}
-			format := args[0].(*CometStr)
-			fmt.Printf(format.Value, transArgs)
+			fmt.Fprint(ctx.Stdout, result)
 			return NopInstance
 		},
 	},
 	{
-		Name: "println",
-		Func: func(args ...CometObject) CometObject {
+		Name:    "println",
+		MinArgs: 0,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
 			if len(args) == 0 {
-				fmt.Println()
+				fmt.Fprintln(ctx.Stdout)
 				return NopInstance
 			}
-			if len(args) != 1 {
-				return CreateError("Expected 0 or 1 arguments, got %d.", len(args))
-			}
 			// This works if args[0] is a string, int or boolean
 			// Maybe we should only allow this for the defined types, but for the time being it's not required.
-			fmt.Println(extractPrimitive(args[0]))
+			fmt.Fprintln(ctx.Stdout, extractPrimitive(args[0]))
 			return NopInstance
 		},
 	},
 	{
-		Name: "toString",
-		Func: func(args ...CometObject) CometObject {
-			if len(args) != 1 {
-				return CreateError("Expected 1 argument, got %d instead", len(args))
-			}
+		Name:    "toString",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
 			return ToString(args[0])
 		},
 	},
-}
+	{
+		Name:    "bool",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			if IsTruthy(args[0]) {
+				return TrueObject
+			}
+			return FalseObject
+		},
+	},
+	{
+		Name:    "bigint",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			switch n := args[0].(type) {
+			case *CometBigInt:
+				return n
+			case *CometInt:
+				return NewBigInt(n)
+			case *CometStr:
+				value, ok := new(big.Int).SetString(n.Value, 10)
+				if !ok {
+					return CreateError("Cannot convert '%s' to a bigint", n.Value)
+				}
+				return &CometBigInt{Value: value}
+			default:
+				return CreateError("Cannot convert value of type '%s' to a bigint", args[0].Type())
+			}
+		},
+	},
+}, ArrayBuiltins...), OSBuiltins...)
 
 // ToString is the standard library's way to convert any object type to a string value.
-// Newly added types should add their string conversion implementation as well.
+// The types without a specific conversion use their own ToString.
 func ToString(object CometObject) *CometStr {
 	switch n := object.(type) {
 	case *CometStr:
@@ -78,18 +215,78 @@ func ToString(object CometObject) *CometStr {
 		// TODO: updates should be made when we have numbers with different bases
 		value := strconv.FormatInt(n.Value, 10)
 		return &CometStr{Value: value, Size: len(value)}
+	case *CometBigInt:
+		value := n.Value.String()
+		return &CometStr{Value: value, Size: len(value)}
+	case *CometFloat:
+		value := strconv.FormatFloat(n.Value, 'g', -1, 64)
+		return &CometStr{Value: value, Size: len(value)}
 	case *CometRange:
 		return &CometStr{Value: n.ToString(), Size: len(n.ToString())}
 	case *CometFunc:
 		value := n.ToString()
 		return &CometStr{Value: value, Size: len(value)}
+	case *Builtin:
+		value := n.ToString()
+		return &CometStr{Value: value, Size: len(value)}
 	case *CometError:
 		value := n.Message
 		return &CometStr{Value: value, Size: len(value)}
 	case *CometInstance:
 		return &CometStr{Value: n.ToString(), Size: len(n.ToString())}
+	case *CometNil, *NopObject:
+		// The statements and the builtins without a result yield no value, converted like nil.
+		return &CometStr{Value: "nil", Size: 3}
+	case *CometArray:
+		value := arrayString(n, make(map[*CometArray]bool))
+		return &CometStr{Value: value, Size: len(value)}
 	default:
-		panic("All types should have been exhausted!!")
+		// The native objects, the modules and the types defined by the interpreters, like the
+		// functions compiled to bytecode, describe themselves.
+		value := object.ToString()
+		return &CometStr{Value: value, Size: len(value)}
+	}
+}
+
+// arrayString converts the elements of the array with ToString, the arrays containing themselves
+// are shown as [...].
+func arrayString(array *CometArray, visiting map[*CometArray]bool) string {
+	if visiting[array] {
+		return "[...]"
+	}
+	visiting[array] = true
+	defer delete(visiting, array)
+	elements := make([]string, len(array.Values))
+	for i, element := range array.Values {
+		if nested, ok := element.(*CometArray); ok {
+			elements[i] = arrayString(nested, visiting)
+		} else {
+			elements[i] = ToString(element).Value
+		}
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// IsTruthy returns the truth value of the given object when used in a condition.
+// false, nil, 0, "" and empty arrays are falsy, every other value is truthy.
+func IsTruthy(object CometObject) bool {
+	switch n := object.(type) {
+	case *CometBool:
+		return n.Value
+	case *CometNil, *NopObject:
+		return false
+	case *CometInt:
+		return n.Value != 0
+	case *CometBigInt:
+		return n.Value.Sign() != 0
+	case *CometFloat:
+		return n.Value != 0
+	case *CometStr:
+		return n.Value != ""
+	case *CometArray:
+		return n.Length != 0
+	default:
+		return true
 	}
 }
 
@@ -101,8 +298,16 @@ func extractPrimitive(object CometObject) interface{} {
 		return n.Value
 	case *CometInt:
 		return n.Value
+	case *CometBigInt:
+		return n.Value
+	case *CometFloat:
+		return n.Value
 	case *CometInstance:
 		return n.ToString()
+	case NativeObject:
+		return n.ToString()
+	case *CometNil:
+		return "nil"
 	default:
 		return object
 	}
@@ -0,0 +1,405 @@
+package std
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// MapStruct is the type of the instances converted from Go maps, the keys of the map are the
+// fields of the instance.
+var MapStruct = &CometStruct{Name: "Map", Methods: make(map[string]*CometFunc)}
+
+var (
+	objectType  = reflect.TypeOf((*CometObject)(nil)).Elem()
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ToComet converts a Go value to a Comet value. Booleans, integers, floats, strings and *big.Int
+// are converted to their Comet equivalent, slices and arrays to arrays, maps with string keys to
+// instances of MapStruct, and structs to instances of a type named after the struct holding its
+// exported fields, the `comet` tag renames a field or skips it if it's "-". Pointers to structs
+// are wrapped in a Native object, so that the program shares the struct with the host.
+// nil values are converted to nil, other pointers to the value they point to, and Comet values
+// are returned as is.
+func ToComet(value interface{}) (CometObject, error) {
+	if value == nil {
+		return NilObject, nil
+	}
+	return toComet(reflect.ValueOf(value))
+}
+
+func toComet(value reflect.Value) (CometObject, error) {
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+		return NilObject, nil
+	}
+	if value.Type().Implements(objectType) {
+		return value.Interface().(CometObject), nil
+	}
+	if value.Type() == bigIntType {
+		return &CometBigInt{Value: new(big.Int).Set(value.Interface().(*big.Int))}, nil
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return TrueObject, nil
+		}
+		return FalseObject, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &CometInt{Value: value.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return &CometBigInt{Value: new(big.Int).SetUint64(value.Uint())}, nil
+		}
+		return &CometInt{Value: int64(value.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &CometFloat{Value: value.Float()}, nil
+	case reflect.String:
+		return &CometStr{Value: value.String(), Size: len(value.String())}, nil
+	case reflect.Ptr:
+		if value.Elem().Kind() == reflect.Struct {
+			return &Native{value: value}, nil
+		}
+		return toComet(value.Elem())
+	case reflect.Interface:
+		return toComet(value.Elem())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return NilObject, nil
+		}
+		values := make([]CometObject, value.Len())
+		for i := range values {
+			element, err := toComet(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = element
+		}
+		return &CometArray{Length: len(values), Values: values}, nil
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot convert map with keys of type %s, only string keys are supported", value.Type().Key())
+		}
+		if value.IsNil() {
+			return NilObject, nil
+		}
+		instance := NewInstance(MapStruct)
+		iter := value.MapRange()
+		for iter.Next() {
+			field, err := toComet(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			instance.Fields[iter.Key().String()] = field
+		}
+		return instance, nil
+	case reflect.Struct:
+		name := value.Type().Name()
+		if name == "" {
+			name = "struct"
+		}
+		instance := NewInstance(&CometStruct{Name: name, Methods: make(map[string]*CometFunc)})
+		for _, field := range structFields(value.Type()) {
+			fieldValue, err := toComet(value.FieldByIndex(field.index))
+			if err != nil {
+				return nil, err
+			}
+			instance.Fields[field.name] = fieldValue
+		}
+		return instance, nil
+	default:
+		return nil, fmt.Errorf("cannot convert value of Go type %s to a Comet value", value.Type())
+	}
+}
+
+// FromComet converts a Comet value to its natural Go representation: int64, *big.Int, float64,
+// string, bool, nil, []interface{} for arrays and map[string]interface{} for instances. The
+// values without a Go equivalent, like functions, are returned as is.
+// Arrays and instances containing themselves cannot be converted.
+func FromComet(object CometObject) (interface{}, error) {
+	return fromComet(object, make(map[CometObject]bool))
+}
+
+// fromComet converts object, visiting holds the arrays and instances being converted to detect cycles.
+func fromComet(object CometObject, visiting map[CometObject]bool) (interface{}, error) {
+	switch n := object.(type) {
+	case *CometInt:
+		return n.Value, nil
+	case *CometBigInt:
+		return new(big.Int).Set(n.Value), nil
+	case *CometFloat:
+		return n.Value, nil
+	case *CometStr:
+		return n.Value, nil
+	case *CometBool:
+		return n.Value, nil
+	case *CometNil, *NopObject:
+		return nil, nil
+	case *CometArray:
+		if visiting[n] {
+			return nil, fmt.Errorf("cannot convert a cyclic array to a Go value")
+		}
+		visiting[n] = true
+		defer delete(visiting, n)
+		values := make([]interface{}, len(n.Values))
+		for i, value := range n.Values {
+			converted, err := fromComet(value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = converted
+		}
+		return values, nil
+	case *Native:
+		return n.Value(), nil
+	case *CometInstance:
+		if visiting[n] {
+			return nil, fmt.Errorf("cannot convert a cyclic instance of '%s' to a Go value", n.Struct.Name)
+		}
+		visiting[n] = true
+		defer delete(visiting, n)
+		fields := make(map[string]interface{}, len(n.Fields))
+		for name, value := range n.Fields {
+			converted, err := fromComet(value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = converted
+		}
+		return fields, nil
+	default:
+		return object, nil
+	}
+}
+
+// ConvertTo converts a Comet value to a Go value of the given type, it's the inverse of ToComet.
+// Integers are only converted to Go integers they fit in.
+func ConvertTo(object CometObject, target reflect.Type) (reflect.Value, error) {
+	if target.Kind() == reflect.Interface && target.NumMethod() == 0 {
+		value, err := FromComet(object)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if value == nil {
+			return reflect.Zero(target), nil
+		}
+		return reflect.ValueOf(value), nil
+	}
+	if reflect.TypeOf(object).AssignableTo(target) {
+		return reflect.ValueOf(object), nil
+	}
+	if native, ok := object.(*Native); ok && native.value.Type().AssignableTo(target) {
+		return native.value, nil
+	}
+	if object.Type() == NilType && canBeNil(target.Kind()) {
+		return reflect.Zero(target), nil
+	}
+	if target == bigIntType {
+		switch n := object.(type) {
+		case *CometBigInt:
+			return reflect.ValueOf(new(big.Int).Set(n.Value)), nil
+		case *CometInt:
+			return reflect.ValueOf(big.NewInt(n.Value)), nil
+		}
+		return reflect.Value{}, conversionError(object, target)
+	}
+	result := reflect.New(target).Elem()
+	switch target.Kind() {
+	case reflect.Bool:
+		b, ok := object.(*CometBool)
+		if !ok {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		result.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := object.(*CometInt)
+		if !ok || result.OverflowInt(i.Value) {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		result.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := object.(*CometInt)
+		if !ok || i.Value < 0 || result.OverflowUint(uint64(i.Value)) {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		result.SetUint(uint64(i.Value))
+	case reflect.Float32, reflect.Float64:
+		switch n := object.(type) {
+		case *CometFloat:
+			result.SetFloat(n.Value)
+		case *CometInt:
+			result.SetFloat(float64(n.Value))
+		default:
+			return reflect.Value{}, conversionError(object, target)
+		}
+	case reflect.String:
+		s, ok := object.(*CometStr)
+		if !ok {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		result.SetString(s.Value)
+	case reflect.Slice, reflect.Array:
+		array, ok := object.(*CometArray)
+		if !ok || (target.Kind() == reflect.Array && target.Len() != array.Length) {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		if target.Kind() == reflect.Slice {
+			result = reflect.MakeSlice(target, array.Length, array.Length)
+		}
+		for i, element := range array.Values {
+			value, err := ConvertTo(element, target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Index(i).Set(value)
+		}
+	case reflect.Map:
+		instance, ok := object.(*CometInstance)
+		if !ok || target.Key().Kind() != reflect.String {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		result = reflect.MakeMapWithSize(target, len(instance.Fields))
+		// The fields are converted in order to report the same error for the same instance.
+		names := make([]string, 0, len(instance.Fields))
+		for name := range instance.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, err := ConvertTo(instance.Fields[name], target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(reflect.ValueOf(name).Convert(target.Key()), value)
+		}
+	case reflect.Struct:
+		instance, ok := object.(*CometInstance)
+		if !ok {
+			return reflect.Value{}, conversionError(object, target)
+		}
+		for _, field := range structFields(target) {
+			fieldValue, found := instance.Fields[field.name]
+			if !found {
+				continue
+			}
+			value, err := ConvertTo(fieldValue, target.FieldByIndex(field.index).Type)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.FieldByIndex(field.index).Set(value)
+		}
+	case reflect.Ptr:
+		value, err := ConvertTo(object, target.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result = reflect.New(target.Elem())
+		result.Elem().Set(value)
+	default:
+		return reflect.Value{}, conversionError(object, target)
+	}
+	return result, nil
+}
+
+func canBeNil(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+func conversionError(object CometObject, target reflect.Type) error {
+	return fmt.Errorf("cannot convert value of type %s to Go type %s", object.Type(), target)
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields returns the exported fields of a struct type, with their Comet names.
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag, found := field.Tag.Lookup("comet"); found {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
+
+// NewBuiltin creates a builtin calling a Go function, the arguments and the results are converted
+// with ConvertTo and ToComet.
+// The function can take a *Context as first parameter, and return no value, a value, an error, or
+// a value and an error. The returned errors are reported as Comet errors.
+func NewBuiltin(name string, function interface{}) (*Builtin, error) {
+	fn := reflect.ValueOf(function)
+	if fn.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot register '%s', expected a function, got %T", name, function)
+	}
+	t := fn.Type()
+	first := 0
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		first = 1
+	}
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && t.Out(1) != errorType,
+		t.NumOut() == 2 && t.Out(0) == errorType:
+		return nil, fmt.Errorf("cannot register '%s', expected at most a value and an error as results, got %s", name, t)
+	}
+	builtin := &Builtin{Name: name, MinArgs: t.NumIn() - first, MaxArgs: t.NumIn() - first}
+	if t.IsVariadic() {
+		builtin.MinArgs, builtin.MaxArgs = builtin.MinArgs-1, -1
+	}
+	builtin.Func = func(ctx *Context, args ...CometObject) CometObject {
+		in := make([]reflect.Value, 0, len(args)+first)
+		if first == 1 {
+			in = append(in, reflect.ValueOf(ctx))
+		}
+		for i, arg := range args {
+			param := first + i
+			var paramType reflect.Type
+			if t.IsVariadic() && param >= t.NumIn()-1 {
+				paramType = t.In(t.NumIn() - 1).Elem()
+			} else {
+				paramType = t.In(param)
+			}
+			value, err := ConvertTo(arg, paramType)
+			if err != nil {
+				return ctx.Errorf("Argument %d of builtin '%s': %s", i+1, name, err)
+			}
+			in = append(in, value)
+		}
+		out := fn.Call(in)
+		if len(out) > 0 && out[len(out)-1].Type() == errorType {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return ctx.Errorf("%s", err.Interface())
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return NopInstance
+		}
+		result, err := toComet(out[0])
+		if err != nil {
+			return ctx.Errorf("Result of builtin '%s': %s", name, err)
+		}
+		return result
+	}
+	return builtin, nil
+}
@@ -0,0 +1,242 @@
+package std
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONModule implements the JSON functions of the standard library, imported with `import "json"`.
+// JSON objects are converted to instances of MapStruct, numbers to integers, big integers or
+// floats, and null to nil.
+var JSONModule = NewNativeModule("json",
+	&Builtin{
+		Name:     "json.parse",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			decoder := json.NewDecoder(strings.NewReader(args[0].(*CometStr).Value))
+			decoder.UseNumber()
+			var value interface{}
+			err := decoder.Decode(&value)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ctx.Errorf("Cannot parse JSON: unexpected end of input")
+			}
+			if err != nil {
+				return ctx.Errorf("Cannot parse JSON: %s", err)
+			}
+			if _, err := decoder.Token(); err != io.EOF {
+				return ctx.Errorf("Cannot parse JSON: unexpected data after the value at offset %d", decoder.InputOffset())
+			}
+			return fromJSON(value)
+		},
+	},
+	&Builtin{
+		Name:     "json.stringify",
+		MinArgs:  1,
+		MaxArgs:  3,
+		ArgTypes: []CometType{AnyType, AnyType, FuncType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// The output is compact unless an indent is given, either as a number of spaces or as the
+			// string repeated on each level. The keys of the objects are sorted in ascending order, or
+			// by the callback which is called with two keys and returns whether the first one comes
+			// before the second one.
+			indent := ""
+			if len(args) >= 2 {
+				switch n := args[1].(type) {
+				case *CometInt:
+					if n.Value < 0 || n.Value > 16 {
+						return ctx.Errorf("The indent of builtin 'json.stringify' must be between 0 and 16 spaces, got %d", n.Value)
+					}
+					indent = strings.Repeat(" ", int(n.Value))
+				case *CometStr:
+					indent = n.Value
+				case *CometNil:
+				default:
+					return ctx.Errorf("Argument 2 of builtin 'json.stringify' expected to be an integer or a string, got %s instead", args[1].Type())
+				}
+			}
+			encoder := &jsonEncoder{ctx: ctx, indent: indent, visiting: make(map[CometObject]bool)}
+			if len(args) == 3 {
+				encoder.less = args[2]
+			}
+			if err := encoder.encode(args[0], 0); err != nil {
+				return err
+			}
+			return newStr(encoder.buf.String())
+		},
+	},
+)
+
+func fromJSON(value interface{}) CometObject {
+	switch v := value.(type) {
+	case nil:
+		return NilObject
+	case bool:
+		return boolObject(v)
+	case string:
+		return newStr(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &CometInt{Value: i}
+		}
+		if !strings.ContainsAny(v.String(), ".eE") {
+			i, _ := new(big.Int).SetString(v.String(), 10)
+			return &CometBigInt{Value: i}
+		}
+		// Out of range numbers are parsed as infinities, they can't be encoded back.
+		f, _ := strconv.ParseFloat(v.String(), 64)
+		return &CometFloat{Value: f}
+	case []interface{}:
+		values := make([]CometObject, len(v))
+		for i, element := range v {
+			values[i] = fromJSON(element)
+		}
+		return newArray(values)
+	default:
+		instance := NewInstance(MapStruct)
+		for key, field := range v.(map[string]interface{}) {
+			instance.Fields[key] = fromJSON(field)
+		}
+		return instance
+	}
+}
+
+// jsonEncoder writes Comet values as JSON, visiting holds the arrays and instances being encoded
+// to detect cycles. The keys of the objects are ordered by the less callback if it's not nil.
+type jsonEncoder struct {
+	ctx      *Context
+	buf      bytes.Buffer
+	indent   string
+	less     CometObject
+	visiting map[CometObject]bool
+}
+
+func (e *jsonEncoder) encode(object CometObject, depth int) CometObject {
+	switch n := object.(type) {
+	case *CometInt:
+		e.buf.WriteString(strconv.FormatInt(n.Value, 10))
+	case *CometBigInt:
+		e.buf.WriteString(n.Value.String())
+	case *CometFloat:
+		if math.IsNaN(n.Value) || math.IsInf(n.Value, 0) {
+			return e.ctx.Errorf("Cannot convert %s to JSON", formatFloat(n.Value))
+		}
+		formatted := formatFloat(n.Value)
+		// Keeps the value a float when it's parsed back.
+		if !strings.ContainsAny(formatted, ".e") {
+			formatted += ".0"
+		}
+		e.buf.WriteString(formatted)
+	case *CometStr:
+		e.writeString(n.Value)
+	case *CometBool:
+		e.buf.WriteString(strconv.FormatBool(n.Value))
+	case *CometNil, *NopObject:
+		e.buf.WriteString("null")
+	case *CometArray:
+		if e.visiting[n] {
+			return e.ctx.Errorf("Cannot convert a cyclic array to JSON")
+		}
+		e.visiting[n] = true
+		defer delete(e.visiting, n)
+		e.buf.WriteByte('[')
+		for i, value := range n.Values {
+			e.separate(i, depth+1)
+			if err := e.encode(value, depth+1); err != nil {
+				return err
+			}
+		}
+		e.close(len(n.Values), depth, ']')
+	case *CometInstance:
+		if e.visiting[n] {
+			return e.ctx.Errorf("Cannot convert a cyclic instance of '%s' to JSON", n.Struct.Name)
+		}
+		e.visiting[n] = true
+		defer delete(e.visiting, n)
+		names, err := e.keys(n)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteByte('{')
+		for i, name := range names {
+			e.separate(i, depth+1)
+			e.writeString(name)
+			e.buf.WriteByte(':')
+			if e.indent != "" {
+				e.buf.WriteByte(' ')
+			}
+			if err := e.encode(n.Fields[name], depth+1); err != nil {
+				return err
+			}
+		}
+		e.close(len(names), depth, '}')
+	default:
+		return e.ctx.Errorf("Cannot convert a value of type %s to JSON", object.Type())
+	}
+	return e.ctx.CheckSize(int64(e.buf.Len()))
+}
+
+// keys returns the names of the fields of the instance, in the order they are written.
+func (e *jsonEncoder) keys(instance *CometInstance) ([]string, CometObject) {
+	names := make([]string, 0, len(instance.Fields))
+	for name := range instance.Fields {
+		names = append(names, name)
+	}
+	// The callback is called on sorted keys, the order of the keys it considers equal is stable.
+	sort.Strings(names)
+	if e.less == nil {
+		return names, nil
+	}
+	var err CometObject
+	sort.SliceStable(names, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		less := e.ctx.CallFunction(e.less, newStr(names[i]), newStr(names[j]))
+		if less.Type() == ErrorType {
+			err = less
+			return false
+		}
+		return IsTruthy(less)
+	})
+	return names, err
+}
+
+// separate writes the separator before the i-th element of an array or an object.
+func (e *jsonEncoder) separate(i int, depth int) {
+	if i > 0 {
+		e.buf.WriteByte(',')
+	}
+	e.newline(depth)
+}
+
+// close ends an array or an object of the given size.
+func (e *jsonEncoder) close(size int, depth int, delimiter byte) {
+	if size > 0 {
+		e.newline(depth)
+	}
+	e.buf.WriteByte(delimiter)
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.buf.WriteByte('\n')
+	e.buf.WriteString(strings.Repeat(e.indent, depth))
+}
+
+func (e *jsonEncoder) writeString(value string) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	e.buf.Write(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}))
+}
@@ -0,0 +1,305 @@
+package std
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxPowBits bounds the size of the integers computed by math.pow.
+const maxPowBits = 1 << 24
+
+// MathModule implements the math functions of the standard library, imported with `import "math"`.
+// The functions accept integers, big integers and floats. Integer functions (abs, min, max, pow
+// with a positive exponent, gcd, lcm, modpow) return integers for integer arguments, the other
+// ones return floats. Arguments outside of the domain of a function are reported as errors.
+var MathModule = newMathModule()
+
+func newMathModule() *NativeModule {
+	module := NewNativeModule("math",
+		&Builtin{
+			Name:    "math.abs",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				switch n := args[0].(type) {
+				case *CometInt:
+					if n.Value == math.MinInt64 {
+						return &CometBigInt{Value: new(big.Int).Neg(big.NewInt(n.Value))}
+					}
+					if n.Value < 0 {
+						return &CometInt{Value: -n.Value}
+					}
+					return n
+				case *CometBigInt:
+					return integerResult(new(big.Int).Abs(n.Value))
+				case *CometFloat:
+					return &CometFloat{Value: math.Abs(n.Value)}
+				default:
+					return numberArgError(ctx, "math.abs", 0, args[0])
+				}
+			},
+		},
+		extremum("math.min", -1),
+		extremum("math.max", 1),
+		&Builtin{
+			Name:    "math.pow",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				base, exponent, err := integerArgs(ctx, "math.pow", args)
+				if err == nil && exponent.Sign() >= 0 {
+					if base.CmpAbs(big.NewInt(1)) > 0 && (!exponent.IsInt64() || exponent.Int64() > maxPowBits/int64(base.BitLen())) {
+						return ctx.Errorf("The result of builtin 'math.pow' is too large")
+					}
+					return integerResult(new(big.Int).Exp(base, exponent, nil))
+				}
+				values, err := numberArgs(ctx, "math.pow", args)
+				if err != nil {
+					return err
+				}
+				return floatResult(ctx, "math.pow", math.Pow(values[0], values[1]), values...)
+			},
+		},
+		floatFunc("math.sqrt", math.Sqrt),
+		rounding("math.floor", math.Floor),
+		rounding("math.ceil", math.Ceil),
+		rounding("math.round", math.Round),
+		floatFunc("math.sin", math.Sin),
+		floatFunc("math.cos", math.Cos),
+		floatFunc("math.tan", math.Tan),
+		floatFunc("math.asin", math.Asin),
+		floatFunc("math.acos", math.Acos),
+		floatFunc("math.atan", math.Atan),
+		&Builtin{
+			Name:    "math.atan2",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				values, err := numberArgs(ctx, "math.atan2", args)
+				if err != nil {
+					return err
+				}
+				return floatResult(ctx, "math.atan2", math.Atan2(values[0], values[1]), values...)
+			},
+		},
+		floatFunc("math.exp", math.Exp),
+		&Builtin{
+			Name:    "math.log",
+			MinArgs: 1,
+			MaxArgs: 2,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				// The natural logarithm, or the logarithm in the base given as second argument.
+				values, err := numberArgs(ctx, "math.log", args)
+				if err != nil {
+					return err
+				}
+				if len(values) == 1 {
+					return floatResult(ctx, "math.log", math.Log(values[0]), values...)
+				}
+				if values[1] <= 0 || values[1] == 1 {
+					return ctx.Errorf("Builtin 'math.log' is not defined for the base %s", formatFloat(values[1]))
+				}
+				return floatResult(ctx, "math.log", math.Log(values[0])/math.Log(values[1]), values...)
+			},
+		},
+		floatFunc("math.log2", math.Log2),
+		floatFunc("math.log10", math.Log10),
+		&Builtin{
+			Name:    "math.gcd",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				a, b, err := integerArgs(ctx, "math.gcd", args)
+				if err != nil {
+					return err
+				}
+				return integerResult(new(big.Int).GCD(nil, nil, new(big.Int).Abs(a), new(big.Int).Abs(b)))
+			},
+		},
+		&Builtin{
+			Name:    "math.lcm",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				a, b, err := integerArgs(ctx, "math.lcm", args)
+				if err != nil {
+					return err
+				}
+				if a.Sign() == 0 || b.Sign() == 0 {
+					return integerResult(new(big.Int))
+				}
+				a, b = new(big.Int).Abs(a), new(big.Int).Abs(b)
+				gcd := new(big.Int).GCD(nil, nil, a, b)
+				return integerResult(new(big.Int).Mul(new(big.Int).Quo(a, gcd), b))
+			},
+		},
+		&Builtin{
+			Name:    "math.modpow",
+			MinArgs: 3,
+			MaxArgs: 3,
+			Func: func(ctx *Context, args ...CometObject) CometObject {
+				// Computes base ** exponent % modulus, the result is between 0 and modulus excluded.
+				base, exponent, err := integerArgs(ctx, "math.modpow", args[:2])
+				if err != nil {
+					return err
+				}
+				modulus, ok := toBigIntValue(args[2])
+				if !ok {
+					return ctx.Errorf("Argument 3 of builtin 'math.modpow' expected to be an integer, got %s instead", args[2].Type())
+				}
+				if exponent.Sign() < 0 {
+					return ctx.Errorf("Builtin 'math.modpow' expects a positive exponent, got %s", exponent)
+				}
+				if modulus.Sign() <= 0 {
+					return ctx.Errorf("Builtin 'math.modpow' expects a positive modulus, got %s", modulus)
+				}
+				base = new(big.Int).Mod(base, modulus)
+				return integerResult(new(big.Int).Exp(base, exponent, modulus))
+			},
+		},
+	)
+	module.Members["pi"] = &CometFloat{Value: math.Pi}
+	module.Members["e"] = &CometFloat{Value: math.E}
+	return module
+}
+
+// floatFunc creates a math builtin computing a float from a number.
+func floatFunc(name string, fn func(float64) float64) *Builtin {
+	return &Builtin{
+		Name:    name,
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			values, err := numberArgs(ctx, name, args)
+			if err != nil {
+				return err
+			}
+			return floatResult(ctx, name, fn(values[0]), values...)
+		},
+	}
+}
+
+// rounding creates a math builtin rounding a float to an integer, integers are returned as is.
+func rounding(name string, fn func(float64) float64) *Builtin {
+	return &Builtin{
+		Name:    name,
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			if args[0].Type() == IntType || args[0].Type() == BigIntType {
+				return args[0]
+			}
+			value, ok := args[0].(*CometFloat)
+			if !ok {
+				return numberArgError(ctx, name, 0, args[0])
+			}
+			if math.IsNaN(value.Value) || math.IsInf(value.Value, 0) {
+				return ctx.Errorf("Builtin '%s' is not defined for %s", name, formatFloat(value.Value))
+			}
+			rounded := fn(value.Value)
+			if rounded >= math.MinInt64 && rounded < math.MaxInt64 {
+				return &CometInt{Value: int64(rounded)}
+			}
+			result, _ := big.NewFloat(rounded).Int(nil)
+			return &CometBigInt{Value: result}
+		},
+	}
+}
+
+// extremum creates a math builtin returning the smallest (sign -1) or largest (sign 1) argument.
+func extremum(name string, sign int) *Builtin {
+	return &Builtin{
+		Name:    name,
+		MinArgs: 1,
+		MaxArgs: -1,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			result := args[0]
+			for i, arg := range args {
+				if _, ok := toBigFloat(arg); !ok {
+					return numberArgError(ctx, name, i, arg)
+				}
+				if order, _ := compare(arg, result); order*sign > 0 {
+					result = arg
+				}
+			}
+			return result
+		},
+	}
+}
+
+// numberArgs converts the arguments of a math builtin to floats.
+func numberArgs(ctx *Context, name string, args []CometObject) ([]float64, CometObject) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		switch n := arg.(type) {
+		case *CometInt:
+			values[i] = float64(n.Value)
+		case *CometBigInt:
+			values[i], _ = new(big.Float).SetInt(n.Value).Float64()
+		case *CometFloat:
+			values[i] = n.Value
+		default:
+			return nil, numberArgError(ctx, name, i, arg)
+		}
+	}
+	return values, nil
+}
+
+func numberArgError(ctx *Context, name string, i int, arg CometObject) CometObject {
+	return ctx.Errorf("Argument %d of builtin '%s' expected to be a number, got %s instead", i+1, name, arg.Type())
+}
+
+// integerArgs converts the two arguments of a math builtin to big integers.
+func integerArgs(ctx *Context, name string, args []CometObject) (a *big.Int, b *big.Int, err CometObject) {
+	values := make([]*big.Int, len(args))
+	for i, arg := range args {
+		value, ok := toBigIntValue(arg)
+		if !ok {
+			return nil, nil, ctx.Errorf("Argument %d of builtin '%s' expected to be an integer, got %s instead", i+1, name, arg.Type())
+		}
+		values[i] = value
+	}
+	return values[0], values[1], nil
+}
+
+func toBigIntValue(object CometObject) (*big.Int, bool) {
+	switch n := object.(type) {
+	case *CometInt:
+		return big.NewInt(n.Value), true
+	case *CometBigInt:
+		return n.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// integerResult converts the result of an integer function to a CometInt, unless it doesn't fit,
+// like the integer operators do.
+func integerResult(value *big.Int) CometObject {
+	if value.IsInt64() {
+		return &CometInt{Value: value.Int64()}
+	}
+	return &CometBigInt{Value: value}
+}
+
+// floatResult checks that a function of finite arguments has a finite result.
+func floatResult(ctx *Context, name string, result float64, args ...float64) CometObject {
+	finite := true
+	for _, arg := range args {
+		finite = finite && !math.IsInf(arg, 0) && !math.IsNaN(arg)
+	}
+	if math.IsNaN(result) || (finite && math.IsInf(result, 0)) {
+		formatted := make([]string, len(args))
+		for i, arg := range args {
+			formatted[i] = formatFloat(arg)
+		}
+		return ctx.Errorf("Builtin '%s' is not defined for %s", name, strings.Join(formatted, " and "))
+	}
+	return &CometFloat{Value: result}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,63 @@
+package std
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NativeModule is a module of the standard library implemented in Go. It's imported like the
+// modules written in Comet, and its members are builtins and constants.
+type NativeModule struct {
+	Name    string
+	Members map[string]CometObject
+}
+
+// NewNativeModule creates a module with the given builtins, their names are prefixed by the name of
+// the module and a '.'.
+func NewNativeModule(name string, builtins ...*Builtin) *NativeModule {
+	module := &NativeModule{Name: name, Members: make(map[string]CometObject)}
+	for _, builtin := range builtins {
+		module.Members[strings.TrimPrefix(builtin.Name, name+".")] = builtin
+	}
+	return module
+}
+
+// Modules are the modules of the standard library by import path, they take precedence over the
+// source files with the same path.
+var Modules = map[string]*NativeModule{
+	StringsModule.Name: StringsModule,
+	MathModule.Name:    MathModule,
+	JSONModule.Name:    JSONModule,
+}
+
+func (m *NativeModule) Type() CometType {
+	return ModuleType
+}
+
+func (m *NativeModule) ToString() string {
+	return fmt.Sprintf("Module(%s)", m.Name)
+}
+
+func (m *NativeModule) GetField(name string) CometObject {
+	value, found := m.Members[name]
+	if !found {
+		return CreateError("Module '%s' has no member '%s'", m.Name, name)
+	}
+	return value
+}
+
+func (m *NativeModule) SetField(name string, value CometObject) CometObject {
+	return CreateError("Cannot assign '%s', the members of module '%s' are read only", name, m.Name)
+}
+
+func (m *NativeModule) CallMethod(ctx *Context, name string, args ...CometObject) CometObject {
+	value := m.GetField(name)
+	if value.Type() == ErrorType {
+		return value
+	}
+	builtin, ok := value.(*Builtin)
+	if !ok {
+		return ctx.Errorf("Cannot invoke none callable object of type %s", value.Type())
+	}
+	return builtin.Invoke(ctx, args...)
+}
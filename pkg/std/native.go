@@ -0,0 +1,112 @@
+package std
+
+import (
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NativeObject is a value implemented by the host program, its fields and methods are accessed
+// with the '.' operator like the fields and methods of instances.
+// Errors are reported by returning a CometError.
+type NativeObject interface {
+	CometObject
+	// GetField returns the value of the field.
+	GetField(name string) CometObject
+	// SetField updates the value of the field, it returns nil or an error.
+	SetField(name string, value CometObject) CometObject
+	// CallMethod invokes the method with the given arguments.
+	CallMethod(ctx *Context, name string, args ...CometObject) CometObject
+}
+
+// Native is a NativeObject exposing a pointer to a Go struct by reflection. The fields are the
+// exported fields of the struct, renamed by the `comet` tag like in ToComet, and the methods are
+// the exported methods of the pointer, converted like the functions of NewBuiltin.
+// Fields and methods can be referred to with a lower case first letter, `counter.add()` calls
+// the `Add` method.
+type Native struct {
+	value reflect.Value
+}
+
+// NewNative wraps a pointer to a struct in a NativeObject.
+func NewNative(value interface{}) (*Native, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a non nil pointer to a struct, got %T", value)
+	}
+	return &Native{value: v}, nil
+}
+
+// Value returns the wrapped pointer.
+func (n *Native) Value() interface{} {
+	return n.value.Interface()
+}
+
+func (n *Native) Type() CometType {
+	return NativeType
+}
+
+func (n *Native) ToString() string {
+	return fmt.Sprintf("Native(Type=%s)", n.typeName())
+}
+
+func (n *Native) GetField(name string) CometObject {
+	field, found := n.field(name)
+	if !found {
+		return CreateError("Field '%s' not found on native type '%s'", name, n.typeName())
+	}
+	value, err := toComet(field)
+	if err != nil {
+		return CreateError("Field '%s' of native type '%s': %s", name, n.typeName(), err)
+	}
+	return value
+}
+
+func (n *Native) SetField(name string, value CometObject) CometObject {
+	field, found := n.field(name)
+	if !found {
+		return CreateError("Field '%s' not found on native type '%s'", name, n.typeName())
+	}
+	converted, err := ConvertTo(value, field.Type())
+	if err != nil {
+		return CreateError("Field '%s' of native type '%s': %s", name, n.typeName(), err)
+	}
+	field.Set(converted)
+	return nil
+}
+
+func (n *Native) CallMethod(ctx *Context, name string, args ...CometObject) CometObject {
+	method := n.value.MethodByName(name)
+	if !method.IsValid() {
+		method = n.value.MethodByName(capitalize(name))
+	}
+	if !method.IsValid() {
+		return CreateError("Could not find method '%s' on native type '%s'", name, n.typeName())
+	}
+	builtin, err := NewBuiltin(n.typeName()+"."+name, method.Interface())
+	if err != nil {
+		return CreateError("%s", err)
+	}
+	return builtin.Invoke(ctx, args...)
+}
+
+func (n *Native) field(name string) (reflect.Value, bool) {
+	for _, candidate := range []string{name, capitalize(name)} {
+		for _, field := range structFields(n.value.Elem().Type()) {
+			if field.name == candidate {
+				return n.value.Elem().FieldByIndex(field.index), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func (n *Native) typeName() string {
+	return n.value.Elem().Type().Name()
+}
+
+func capitalize(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
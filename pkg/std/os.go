@@ -0,0 +1,228 @@
+package std
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Capabilities grant the programs access to the system through the builtins of OSBuiltins. The
+// zero value denies every access, the builtins report a permission error when they are used
+// without the needed capability.
+type Capabilities struct {
+	// Root is the directory accessible by the file system builtins, relative paths are resolved
+	// against it and the paths outside of it are denied. The file system is not accessible if it's
+	// empty.
+	Root string
+	// Write allows writeFile to create and modify the files of Root, the file system is read only
+	// otherwise.
+	Write bool
+	// Env allows env to read the environment variables of the process.
+	Env bool
+	// Exec allows exec to run commands.
+	Exec bool
+	// Exit is called by exit with the exit code, exit is denied if it's nil. The program keeps
+	// running if it returns.
+	Exit func(code int)
+	// Args are the arguments of the program returned by args.
+	Args []string
+}
+
+// OSBuiltins are the builtins accessing the file system and the process, they are part of Builtins.
+var OSBuiltins = []*Builtin{
+	{
+		Name:     "readFile",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			path, err := ctx.Capabilities.resolvePath(ctx, "readFile", args[0].(*CometStr).Value)
+			if err != nil {
+				return err
+			}
+			content, readErr := ioutil.ReadFile(path)
+			if readErr != nil {
+				return ctx.Errorf("Cannot read file '%s': %s", args[0].(*CometStr).Value, unwrapPathError(readErr))
+			}
+			return newStr(string(content))
+		},
+	},
+	{
+		Name:     "writeFile",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			if ctx.Capabilities.Root != "" && !ctx.Capabilities.Write {
+				return ctx.Errorf("Permission denied: builtin 'writeFile' needs write access to the file system")
+			}
+			path, err := ctx.Capabilities.resolvePath(ctx, "writeFile", args[0].(*CometStr).Value)
+			if err != nil {
+				return err
+			}
+			if writeErr := ioutil.WriteFile(path, []byte(args[1].(*CometStr).Value), 0644); writeErr != nil {
+				return ctx.Errorf("Cannot write file '%s': %s", args[0].(*CometStr).Value, unwrapPathError(writeErr))
+			}
+			return NopInstance
+		},
+	},
+	{
+		Name:     "listDir",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Returns the names of the entries of the directory, sorted.
+			path, err := ctx.Capabilities.resolvePath(ctx, "listDir", args[0].(*CometStr).Value)
+			if err != nil {
+				return err
+			}
+			entries, readErr := ioutil.ReadDir(path)
+			if readErr != nil {
+				return ctx.Errorf("Cannot list directory '%s': %s", args[0].(*CometStr).Value, unwrapPathError(readErr))
+			}
+			values := make([]CometObject, len(entries))
+			for i, entry := range entries {
+				values[i] = newStr(entry.Name())
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "exists",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			path, err := ctx.Capabilities.resolvePath(ctx, "exists", args[0].(*CometStr).Value)
+			if err != nil {
+				return err
+			}
+			_, statErr := os.Stat(path)
+			return boolObject(statErr == nil)
+		},
+	},
+	{
+		Name:     "env",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Returns the value of the environment variable, or nil if it's not set.
+			if !ctx.Capabilities.Env {
+				return ctx.Errorf("Permission denied: builtin 'env' needs access to the environment")
+			}
+			value, found := os.LookupEnv(args[0].(*CometStr).Value)
+			if !found {
+				return NilObject
+			}
+			return newStr(value)
+		},
+	},
+	{
+		Name:    "args",
+		MinArgs: 0,
+		MaxArgs: 0,
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			values := make([]CometObject, len(ctx.Capabilities.Args))
+			for i, arg := range ctx.Capabilities.Args {
+				values[i] = newStr(arg)
+			}
+			return newArray(values)
+		},
+	},
+	{
+		Name:     "exit",
+		MinArgs:  0,
+		MaxArgs:  1,
+		ArgTypes: []CometType{IntType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			if ctx.Capabilities.Exit == nil {
+				return ctx.Errorf("Permission denied: builtin 'exit' needs permission to exit")
+			}
+			code := 0
+			if len(args) == 1 {
+				code = int(args[0].(*CometInt).Value)
+			}
+			ctx.Capabilities.Exit(code)
+			return NopInstance
+		},
+	},
+	{
+		Name:     "exec",
+		MinArgs:  1,
+		MaxArgs:  -1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Runs the command with the given arguments and returns its standard output, the command
+			// runs in Root if it's set.
+			if !ctx.Capabilities.Exec {
+				return ctx.Errorf("Permission denied: builtin 'exec' needs permission to execute commands")
+			}
+			name := args[0].(*CometStr).Value
+			params := make([]string, len(args)-1)
+			for i, arg := range args[1:] {
+				params[i] = arg.(*CometStr).Value
+			}
+			command := exec.Command(name, params...)
+			command.Dir = ctx.Capabilities.Root
+			var stdout, stderr bytes.Buffer
+			command.Stdout, command.Stderr = &stdout, &stderr
+			if err := command.Run(); err != nil {
+				if message := strings.TrimSpace(stderr.String()); message != "" {
+					return ctx.Errorf("Command '%s' failed: %s: %s", name, err, message)
+				}
+				return ctx.Errorf("Command '%s' failed: %s", name, err)
+			}
+			return newStr(stdout.String())
+		},
+	},
+}
+
+// resolvePath returns the absolute path of a file accessed by a builtin. It's a permission error if
+// the file system is not accessible, or if the path is outside of Root, symbolic links included.
+func (c *Capabilities) resolvePath(ctx *Context, builtin string, path string) (string, CometObject) {
+	if c.Root == "" {
+		return "", ctx.Errorf("Permission denied: builtin '%s' needs access to the file system", builtin)
+	}
+	root, err := filepath.Abs(c.Root)
+	if err != nil {
+		return "", ctx.Errorf("Cannot resolve the root directory '%s': %s", c.Root, err)
+	}
+	root = realPath(root)
+	target := path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	target = realPath(filepath.Clean(target))
+	relative, err := filepath.Rel(root, target)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", ctx.Errorf("Permission denied: '%s' is outside of the accessible directory", path)
+	}
+	return target, nil
+}
+
+// realPath resolves the symbolic links of the path, the missing files at the end of the path are
+// kept as is.
+func realPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(realPath(parent), filepath.Base(path))
+}
+
+// unwrapPathError drops the operation and the path of the errors of the os package, they are
+// already part of the messages of the builtins.
+func unwrapPathError(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+	return err
+}
@@ -0,0 +1,295 @@
+package std
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// StringsModule implements the string functions of the standard library, imported with
+// `import "strings"`.
+// Lengths and indexes count unicode code points rather than bytes.
+var StringsModule = NewNativeModule("strings",
+	&Builtin{
+		Name:     "strings.len",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			return &CometInt{Value: int64(utf8.RuneCountInString(args[0].(*CometStr).Value))}
+		},
+	},
+	&Builtin{
+		Name:     "strings.upper",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			return newStr(strings.ToUpper(args[0].(*CometStr).Value))
+		},
+	},
+	&Builtin{
+		Name:     "strings.lower",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			return newStr(strings.ToLower(args[0].(*CometStr).Value))
+		},
+	},
+	&Builtin{
+		Name:     "strings.trim",
+		MinArgs:  1,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Trims the white spaces, or the characters of the second argument.
+			value := args[0].(*CometStr).Value
+			if len(args) == 1 {
+				return newStr(strings.TrimSpace(value))
+			}
+			return newStr(strings.Trim(value, args[1].(*CometStr).Value))
+		},
+	},
+	&Builtin{
+		Name:     "strings.split",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			value, separator := args[0].(*CometStr).Value, args[1].(*CometStr).Value
+			count := utf8.RuneCountInString(value)
+			if separator != "" {
+				count = strings.Count(value, separator) + 1
+			}
+			if err := ctx.CheckSize(int64(count)); err != nil {
+				return err
+			}
+			parts := strings.Split(value, separator)
+			values := make([]CometObject, len(parts))
+			for i, part := range parts {
+				values[i] = newStr(part)
+			}
+			return newArray(values)
+		},
+	},
+	&Builtin{
+		Name:     "strings.join",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{ArrayType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			elements, separator := args[0].(*CometArray).Values, args[1].(*CometStr).Value
+			parts := make([]string, len(elements))
+			size := int64(0)
+			for i, element := range elements {
+				str, ok := element.(*CometStr)
+				if !ok {
+					return ctx.Errorf("Element %d of the array given to builtin 'strings.join' expected to be %s, got %s instead", i, StrType, element.Type())
+				}
+				parts[i] = str.Value
+				size += int64(len(str.Value))
+				if i > 0 {
+					size += int64(len(separator))
+				}
+			}
+			if err := ctx.CheckSize(size); err != nil {
+				return err
+			}
+			return newStr(strings.Join(parts, separator))
+		},
+	},
+	&Builtin{
+		Name:     "strings.replace",
+		MinArgs:  3,
+		MaxArgs:  4,
+		ArgTypes: []CometType{StrType, StrType, StrType, IntType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Replaces every occurrence, or the given number of occurrences.
+			value, old, replacement := args[0].(*CometStr).Value, args[1].(*CometStr).Value, args[2].(*CometStr).Value
+			replaced := int64(strings.Count(value, old))
+			count := -1
+			if len(args) == 4 {
+				count = int(args[3].(*CometInt).Value)
+				if int64(count) < replaced && count >= 0 {
+					replaced = int64(count)
+				}
+			}
+			if err := ctx.CheckSize(int64(len(value)) + replaced*int64(len(replacement)-len(old))); err != nil {
+				return err
+			}
+			return newStr(strings.Replace(value, old, replacement, count))
+		},
+	},
+	&Builtin{
+		Name:     "strings.contains",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			return boolObject(strings.Contains(args[0].(*CometStr).Value, args[1].(*CometStr).Value))
+		},
+	},
+	&Builtin{
+		Name:     "strings.startsWith",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			return boolObject(strings.HasPrefix(args[0].(*CometStr).Value, args[1].(*CometStr).Value))
+		},
+	},
+	&Builtin{
+		Name:     "strings.endsWith",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			return boolObject(strings.HasSuffix(args[0].(*CometStr).Value, args[1].(*CometStr).Value))
+		},
+	},
+	&Builtin{
+		Name:     "strings.indexOf",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			value := args[0].(*CometStr).Value
+			index := strings.Index(value, args[1].(*CometStr).Value)
+			if index < 0 {
+				return &CometInt{Value: -1}
+			}
+			return &CometInt{Value: int64(utf8.RuneCountInString(value[:index]))}
+		},
+	},
+	&Builtin{
+		Name:     "strings.repeat",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: []CometType{StrType, IntType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			value, count := args[0].(*CometStr).Value, args[1].(*CometInt).Value
+			if err := checkRepeat(value, count); err != nil {
+				return ctx.Errorf("%s", err)
+			}
+			if err := ctx.CheckSize(int64(len(value)) * count); err != nil {
+				return err
+			}
+			return newStr(strings.Repeat(value, int(count)))
+		},
+	},
+	&Builtin{
+		Name:     "strings.substring",
+		MinArgs:  2,
+		MaxArgs:  3,
+		ArgTypes: []CometType{StrType, IntType, IntType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			// Returns the characters from start included to end excluded, or to the end of the string.
+			runes := []rune(args[0].(*CometStr).Value)
+			start, end := args[1].(*CometInt).Value, int64(len(runes))
+			if len(args) == 3 {
+				end = args[2].(*CometInt).Value
+			}
+			if start < 0 || end < start || end > int64(len(runes)) {
+				return ctx.Errorf("Substring bounds [%d, %d) out of range for a string of length %d", start, end, len(runes))
+			}
+			return newStr(string(runes[start:end]))
+		},
+	},
+	&Builtin{
+		Name:     "strings.chars",
+		MinArgs:  1,
+		MaxArgs:  1,
+		ArgTypes: []CometType{StrType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			value := args[0].(*CometStr).Value
+			count := utf8.RuneCountInString(value)
+			if err := ctx.CheckSize(int64(count)); err != nil {
+				return err
+			}
+			values := make([]CometObject, 0, count)
+			for _, r := range value {
+				values = append(values, newStr(string(r)))
+			}
+			return newArray(values)
+		},
+	},
+	&Builtin{
+		Name:     "strings.format",
+		MinArgs:  1,
+		MaxArgs:  -1,
+		ArgTypes: []CometType{StrType, AnyType},
+		Func: func(ctx *Context, args ...CometObject) CometObject {
+			result, err := format(ctx, "strings.format", args[0].(*CometStr).Value, args[1:])
+			if err != nil {
+				return err
+			}
+			return newStr(result)
+		},
+	},
+)
+
+// format replaces each {} of the format by the next parameter converted to a string, {{ and }}
+// stand for the braces. The number of parameters must match the number of {}, name is the builtin
+// formatting the string.
+func format(ctx *Context, name string, format string, params []CometObject) (string, CometObject) {
+	var result strings.Builder
+	used := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == '{' && i+1 < len(format) && format[i+1] == '}':
+			if used < len(params) {
+				result.WriteString(ToString(params[used]).Value)
+			}
+			used++
+			i++
+		case (c == '{' || c == '}') && i+1 < len(format) && format[i+1] == c:
+			result.WriteByte(c)
+			i++
+		case c == '{' || c == '}':
+			return "", ctx.Errorf("Invalid format string, the '%c' at offset %d should be doubled", c, i)
+		default:
+			result.WriteByte(c)
+		}
+	}
+	if used != len(params) {
+		return "", ctx.Errorf("Builtin '%s' expects %s for the format, got %d", name, plural(used, "argument"), len(params))
+	}
+	return result.String(), nil
+}
+
+// Repeat repeats the string count times, like the * operator on strings. The count can't be
+// negative, and the result is limited to math.MaxInt32 bytes.
+func Repeat(value string, count int64) (*CometStr, error) {
+	if err := checkRepeat(value, count); err != nil {
+		return nil, err
+	}
+	return newStr(strings.Repeat(value, int(count))), nil
+}
+
+func checkRepeat(value string, count int64) error {
+	if count < 0 {
+		return fmt.Errorf("Cannot repeat a string a negative number of times, got %d", count)
+	}
+	if len(value) > 0 && count > math.MaxInt32/int64(len(value)) {
+		return fmt.Errorf("Cannot repeat a string of %d bytes %d times, the result is too large", len(value), count)
+	}
+	return nil
+}
+
+func newStr(value string) *CometStr {
+	return &CometStr{Value: value, Size: len(value)}
+}
+
+func newArray(values []CometObject) *CometArray {
+	return &CometArray{Values: values, Length: len(values)}
+}
+
+func boolObject(value bool) *CometBool {
+	if value {
+		return TrueObject
+	}
+	return FalseObject
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	parser2 "github.com/chermehdi/comet/pkg/parser"
+	"math/big"
+	"strconv"
 )
 
 // CometType is a type alias mapping some strings to types
@@ -12,14 +14,22 @@ type CometType string
 
 const (
 	IntType       = "INTEGER"
+	BigIntType    = "BIGINT"
+	FloatType     = "FLOAT"
 	BoolType      = "BOOLEAN"
 	StrType       = "STR"
 	ArrayType     = "ARRAY"
 	FuncType      = "FUNCTION"
+	BuiltinType   = "BUILTIN"
 	ErrorType     = "ERROR"
 	RangeType     = "RANGE"
 	ObjType       = "OBJECT"
+	NativeType    = "NATIVE"
+	ModuleType    = "MODULE"
+	NilType       = "NIL"
 	ReturnWrapper = "ReturnWrapper"
+	BreakType     = "BREAK"
+	ContinueType  = "CONTINUE"
 	Nop           = "NOP"
 )
 
@@ -44,6 +54,40 @@ func (i *CometInt) ToString() string {
 	return fmt.Sprintf("CometInt(%d)", i.Value)
 }
 
+// CometBigInt is an arbitrary-precision integer.
+// Integer operations that overflow an int64 are promoted to this type, values
+// can also be created explicitly with the `bigint` builtin.
+type CometBigInt struct {
+	Value *big.Int
+}
+
+func (i *CometBigInt) Type() CometType {
+	return BigIntType
+}
+
+func (i *CometBigInt) ToString() string {
+	return fmt.Sprintf("CometBigInt(%s)", i.Value.String())
+}
+
+// NewBigInt creates a CometBigInt holding the value of the given CometInt.
+func NewBigInt(i *CometInt) *CometBigInt {
+	return &CometBigInt{Value: big.NewInt(i.Value)}
+}
+
+// CometFloat is a double precision floating point number, created by the decimal literals like 2.5
+// and by the arithmetic mixing floats and integers.
+type CometFloat struct {
+	Value float64
+}
+
+func (f *CometFloat) Type() CometType {
+	return FloatType
+}
+
+func (f *CometFloat) ToString() string {
+	return fmt.Sprintf("CometFloat(%s)", strconv.FormatFloat(f.Value, 'g', -1, 64))
+}
+
 type CometBool struct {
 	Value bool
 }
@@ -104,6 +148,18 @@ func (c *CometError) ToString() string {
 	return fmt.Sprintf("Comet error: \n\n\t%s", c.Message)
 }
 
+// CometNil represents the absence of a value, the only instance of this type
+// is the NilObject singleton.
+type CometNil struct{}
+
+func (n *CometNil) Type() CometType {
+	return NilType
+}
+
+func (n *CometNil) ToString() string {
+	return "CometNil"
+}
+
 type NopObject struct{}
 
 func (n *NopObject) Type() CometType {
@@ -126,6 +182,30 @@ func (c *CometReturnWrapper) ToString() string {
 	return fmt.Sprintf("CometWrapper(%s)", c.Value.ToString())
 }
 
+// CometBreak is the result of evaluating a break statement, it stops the evaluation
+// of the enclosing loop.
+type CometBreak struct{}
+
+func (c *CometBreak) Type() CometType {
+	return BreakType
+}
+
+func (c *CometBreak) ToString() string {
+	return "CometBreak"
+}
+
+// CometContinue is the result of evaluating a continue statement, it skips to the
+// next iteration of the enclosing loop.
+type CometContinue struct{}
+
+func (c *CometContinue) Type() CometType {
+	return ContinueType
+}
+
+func (c *CometContinue) ToString() string {
+	return "CometContinue"
+}
+
 type CometFunc struct {
 	Name   string
 	Params []*parser2.IdentifierExpression
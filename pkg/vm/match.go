@@ -0,0 +1,34 @@
+package vm
+
+import (
+	"github.com/chermehdi/comet/pkg/eval"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+)
+
+// matchPattern reports whether the value matches the pattern, the names bound by the pattern are
+// added to bindings. The values of the literal patterns are computed before matching.
+func (vm *VM) matchPattern(pattern parser.Pattern, value std.CometObject, literals map[*parser.LiteralPattern]std.CometObject, bindings map[string]std.CometObject) (bool, std.CometObject) {
+	return eval.MatchPattern(pattern, value, &stackMatcher{vm: vm, literals: literals, bindings: bindings})
+}
+
+// stackMatcher gives eval.MatchPattern the literal values popped from the stack, and collects the
+// bound names.
+type stackMatcher struct {
+	vm       *VM
+	literals map[*parser.LiteralPattern]std.CometObject
+	bindings map[string]std.CometObject
+}
+
+func (m *stackMatcher) LiteralValue(pattern *parser.LiteralPattern) std.CometObject {
+	return m.literals[pattern]
+}
+
+func (m *stackMatcher) LookupType(name string) (*std.CometStruct, bool) {
+	t, found := m.vm.types[name]
+	return t, found
+}
+
+func (m *stackMatcher) Bind(name string, value std.CometObject) {
+	m.bindings[name] = value
+}
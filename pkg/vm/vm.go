@@ -0,0 +1,768 @@
+// Package vm executes the bytecode produced by the compiler package.
+//
+// The VM is a stack machine, the locals of a function call live on the stack starting at the
+// base of its frame. Errors are CometError objects, like in the evaluator, and stop the execution.
+package vm
+
+import (
+	"github.com/chermehdi/comet/pkg/compiler"
+	"github.com/chermehdi/comet/pkg/eval"
+	"github.com/chermehdi/comet/pkg/lexer"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+	"io"
+	"os"
+)
+
+// Frame is the state of a function call.
+type Frame struct {
+	fn *compiler.CompiledFunction
+	// The name of the call and the token of its call expression, used to report recursion errors.
+	name string
+	site lexer.Token
+	ip   int
+	// The position of the first local on the stack.
+	base int
+	// The stack pointer restored when the call returns.
+	returnSp int
+	// Set for constructor calls, the instance is the result of the call.
+	instance *std.CometInstance
+	// Set for the calls made by builtins, the run loop returns when the frame returns.
+	callback bool
+}
+
+type VM struct {
+	// Strict disables truthiness rules, conditions only accept CometBool values.
+	Strict bool
+	// MaxCallDepth is the maximum number of nested calls, there is no limit if it's not positive.
+	MaxCallDepth int
+	// The streams used by the builtins, the standard streams of the process by default.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+	// Capabilities grant the programs access to the file system and the process, nothing is
+	// granted by default.
+	Capabilities std.Capabilities
+
+	globals         []std.CometObject
+	constantGlobals []bool
+	globalNames     []string
+	constants       []std.CometObject
+
+	types   map[string]*std.CometStruct
+	methods map[*std.CometStruct]map[string]*compiler.CompiledFunction
+
+	stack  []std.CometObject
+	sp     int
+	frames []*Frame
+}
+
+// New creates a VM, globals and types are kept between runs.
+func New() *VM {
+	return &VM{
+		globals:         make([]std.CometObject, 0),
+		constantGlobals: make([]bool, 0),
+		types:           make(map[string]*std.CometStruct),
+		methods:         make(map[*std.CometStruct]map[string]*compiler.CompiledFunction),
+		stack:           make([]std.CometObject, 0, 1024),
+		MaxCallDepth:    eval.DefaultMaxCallDepth,
+		Stdout:          os.Stdout,
+		Stderr:          os.Stderr,
+		Stdin:           os.Stdin,
+	}
+}
+
+// Run executes the bytecode and returns the value of the program, which is the value of its
+// last statement, or the first error encountered.
+func (vm *VM) Run(bytecode *compiler.Bytecode) std.CometObject {
+	vm.constants = bytecode.Constants
+	vm.globalNames = bytecode.Globals
+	for len(vm.globals) < len(bytecode.Globals) {
+		vm.globals = append(vm.globals, nil)
+		vm.constantGlobals = append(vm.constantGlobals, false)
+	}
+	vm.sp = 0
+	vm.frames = vm.frames[:0]
+	vm.frames = append(vm.frames, &Frame{fn: bytecode.Main, name: bytecode.Main.Name})
+	vm.reserveLocals(vm.frames[0])
+	result := vm.run()
+	// Drop the references held by the stack.
+	for i := range vm.stack {
+		vm.stack[i] = nil
+	}
+	return result
+}
+
+func (vm *VM) run() std.CometObject {
+	frame := vm.frames[len(vm.frames)-1]
+	for {
+		ins := frame.fn.Instructions
+		start := frame.ip
+		op := compiler.Opcode(ins[frame.ip])
+		frame.ip++
+		switch op {
+		case compiler.OpConstant:
+			vm.push(vm.constants[vm.readOperand(frame)])
+		case compiler.OpNil:
+			vm.push(std.NilObject)
+		case compiler.OpTrue:
+			vm.push(std.TrueObject)
+		case compiler.OpFalse:
+			vm.push(std.FalseObject)
+		case compiler.OpNop:
+			vm.push(std.NopInstance)
+		case compiler.OpPop:
+			vm.pop()
+		case compiler.OpNopToNil:
+			if vm.stack[vm.sp-1].Type() == std.Nop {
+				vm.stack[vm.sp-1] = std.NilObject
+			}
+		case compiler.OpBinary:
+			op := compiler.Operators[vm.readByte(frame)]
+			right := vm.pop()
+			left := vm.pop()
+			result := eval.ApplyBinaryOperator(op, left, right)
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+		case compiler.OpMinus:
+			result := eval.Negate(vm.pop())
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+		case compiler.OpNot:
+			value := vm.pop()
+			truth, ok := eval.TruthValue(value, vm.Strict)
+			if !ok {
+				return std.CreateError("Cannot apply operator (!) on none BOOLEAN type %s", value.Type())
+			}
+			vm.push(boolValue(!truth))
+		case compiler.OpJump:
+			frame.ip = vm.readOperand(frame)
+		case compiler.OpJumpIfFalse:
+			target := vm.readOperand(frame)
+			condition := compiler.Condition(vm.readByte(frame))
+			value := vm.pop()
+			truth, ok := eval.TruthValue(value, vm.Strict)
+			if !ok {
+				return conditionError(condition, value)
+			}
+			if !truth {
+				frame.ip = target
+			}
+		case compiler.OpJumpIfTrue:
+			target := vm.readOperand(frame)
+			if vm.pop() == std.TrueObject {
+				frame.ip = target
+			}
+		case compiler.OpJumpIfNil:
+			target := vm.readOperand(frame)
+			if vm.stack[vm.sp-1].Type() == std.NilType {
+				frame.ip = target
+			}
+		case compiler.OpJumpIfNotNil:
+			target := vm.readOperand(frame)
+			if vm.stack[vm.sp-1].Type() != std.NilType {
+				frame.ip = target
+			} else {
+				vm.pop()
+			}
+		case compiler.OpLogical:
+			target := vm.readOperand(frame)
+			op := compiler.Operators[vm.readByte(frame)]
+			left := vm.pop()
+			truth, ok := eval.TruthValue(left, vm.Strict)
+			if !ok {
+				return std.CreateError("Cannot apply operator (%s) on none BOOLEAN type %s", op.Literal, left.Type())
+			}
+			if op.Type == lexer.ANDAND && !truth {
+				vm.push(std.FalseObject)
+				frame.ip = target
+			} else if op.Type == lexer.OROR && truth {
+				vm.push(std.TrueObject)
+				frame.ip = target
+			}
+		case compiler.OpLogicalRight:
+			op := compiler.Operators[vm.readByte(frame)]
+			right := vm.pop()
+			truth, ok := eval.TruthValue(right, vm.Strict)
+			if !ok {
+				return std.CreateError("Cannot apply operator (%s) on none BOOLEAN type %s", op.Literal, right.Type())
+			}
+			vm.push(boolValue(truth))
+		case compiler.OpGetGlobal:
+			index := vm.readOperand(frame)
+			value, _ := vm.lookupGlobal(index)
+			if value == nil {
+				return unboundError(vm.globalNames[index])
+			}
+			vm.push(value)
+		case compiler.OpCheckGlobal:
+			index := vm.readOperand(frame)
+			value, local := vm.lookupGlobal(index)
+			if value == nil {
+				return unboundError(vm.globalNames[index])
+			}
+			if local < 0 && vm.constantGlobals[index] {
+				return std.CreateError("Cannot assign to constant '%s'", vm.globalNames[index])
+			}
+		case compiler.OpSetGlobal:
+			index := vm.readOperand(frame)
+			if _, local := vm.lookupGlobal(index); local >= 0 {
+				vm.stack[local] = vm.stack[vm.sp-1]
+			} else {
+				vm.globals[index] = vm.stack[vm.sp-1]
+			}
+		case compiler.OpDefineGlobal:
+			index := vm.readOperand(frame)
+			constant := vm.readByte(frame) == 1
+			if vm.constantGlobals[index] {
+				return std.CreateError("Cannot redeclare constant '%s'", vm.globalNames[index])
+			}
+			vm.globals[index] = vm.stack[vm.sp-1]
+			vm.constantGlobals[index] = constant
+		case compiler.OpCheckRedeclaration:
+			index := vm.readOperand(frame)
+			if vm.constantGlobals[index] {
+				return std.CreateError("Cannot redeclare constant '%s'", vm.globalNames[index])
+			}
+		case compiler.OpGetLocal:
+			index := vm.readOperand(frame)
+			value := vm.stack[frame.base+index]
+			if value == nil {
+				return unboundError(frame.fn.LocalNames[index])
+			}
+			vm.push(value)
+		case compiler.OpSetLocal, compiler.OpDefineLocal:
+			vm.stack[frame.base+vm.readOperand(frame)] = vm.stack[vm.sp-1]
+		case compiler.OpClearLocals:
+			first := frame.base + vm.readOperand(frame)
+			count := vm.readOperand(frame)
+			for i := first; i < first+count; i++ {
+				vm.stack[i] = nil
+			}
+		case compiler.OpGetGlobalFunc:
+			index := vm.readOperand(frame)
+			value, _ := vm.lookupGlobal(index)
+			fn, err := callable(value, vm.globalNames[index])
+			if err != nil {
+				return err
+			}
+			vm.push(fn)
+		case compiler.OpGetGlobalOrBuiltin:
+			index := vm.readOperand(frame)
+			builtin := std.Builtins[vm.readOperand(frame)]
+			value, _ := vm.lookupGlobal(index)
+			if value == nil {
+				vm.push(builtin)
+				continue
+			}
+			fn, err := callable(value, vm.globalNames[index])
+			if err != nil {
+				return err
+			}
+			vm.push(fn)
+		case compiler.OpGetLocalFunc:
+			index := vm.readOperand(frame)
+			fn, err := callable(vm.stack[frame.base+index], frame.fn.LocalNames[index])
+			if err != nil {
+				return err
+			}
+			vm.push(fn)
+		case compiler.OpCurrentFunc:
+			vm.push(frame.fn)
+		case compiler.OpArray:
+			length := vm.readOperand(frame)
+			values := make([]std.CometObject, length)
+			copy(values, vm.stack[vm.sp-length:vm.sp])
+			vm.sp -= length
+			vm.push(&std.CometArray{Length: length, Values: values})
+		case compiler.OpIndex:
+			index := vm.pop()
+			result := eval.IndexAccess(vm.pop(), index)
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+		case compiler.OpIndexLoad:
+			array, i, err := eval.IndexTarget(vm.stack[vm.sp-2], vm.stack[vm.sp-1])
+			if err != nil {
+				return err
+			}
+			vm.push(array.Values[i])
+		case compiler.OpIndexSet:
+			value := vm.pop()
+			index := vm.pop()
+			// The target is checked again, computing the value can change the length of the array.
+			array, i, err := eval.IndexTarget(vm.pop(), index)
+			if err != nil {
+				return err
+			}
+			array.Values[i] = value
+			vm.push(value)
+		case compiler.OpSlice:
+			result := vm.slice(vm.readByte(frame))
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+		case compiler.OpGetField:
+			name := vm.readString(frame)
+			target := vm.pop()
+			if native, ok := target.(std.NativeObject); ok {
+				value := native.GetField(name)
+				if isError(value) {
+					return value
+				}
+				vm.push(value)
+				continue
+			}
+			if target.Type() != std.ObjType {
+				return std.CreateError("Cannot access field '%s' on none object type %s", name, target.Type())
+			}
+			value, found := target.(*std.CometInstance).Fields[name]
+			if !found {
+				value = std.NilObject
+			}
+			vm.push(value)
+		case compiler.OpFieldLoad:
+			name := vm.readString(frame)
+			target := vm.stack[vm.sp-1]
+			if native, ok := target.(std.NativeObject); ok {
+				value := native.GetField(name)
+				if isError(value) {
+					return value
+				}
+				vm.push(value)
+				continue
+			}
+			if target.Type() != std.ObjType {
+				return std.CreateError("Cannot set field '%s' on none object type %s", name, target.Type())
+			}
+			value, found := target.(*std.CometInstance).Fields[name]
+			if !found {
+				value = std.NilObject
+			}
+			vm.push(value)
+		case compiler.OpSetField:
+			name := vm.readString(frame)
+			value := vm.pop()
+			target := vm.pop()
+			if native, ok := target.(std.NativeObject); ok {
+				if err := native.SetField(name, value); err != nil {
+					return err
+				}
+			} else {
+				target.(*std.CometInstance).Fields[name] = value
+			}
+			vm.push(value)
+		case compiler.OpCallMethod:
+			name := vm.readString(frame)
+			argc := vm.readByte(frame)
+			if err := vm.callMethod(name, argc, frame.fn.Sites[start]); err != nil {
+				return err
+			}
+			frame = vm.frames[len(vm.frames)-1]
+		case compiler.OpCall:
+			argc := vm.readByte(frame)
+			if builtin, ok := vm.stack[vm.sp-argc-1].(*std.Builtin); ok {
+				result := vm.callBuiltin(builtin, argc, frame.fn.Sites[start])
+				if isError(result) {
+					return result
+				}
+				vm.push(result)
+				continue
+			}
+			fn := vm.stack[vm.sp-argc-1].(*compiler.CompiledFunction)
+			if argc < len(fn.Params) {
+				return std.CreateError("Function '%s' expects %d arguments, %d were given", fn.Name, len(fn.Params), argc)
+			}
+			// Extra arguments are ignored.
+			vm.sp -= argc - len(fn.Params)
+			base := vm.sp - len(fn.Params)
+			if err := vm.pushFrame(fn, fn.Name, frame.fn.Sites[start], base, base-1, nil); err != nil {
+				return err
+			}
+			frame = vm.frames[len(vm.frames)-1]
+		case compiler.OpTailCall:
+			argc := vm.readByte(frame)
+			if fn, ok := vm.stack[vm.sp-argc-1].(*compiler.CompiledFunction); ok {
+				if argc < len(fn.Params) {
+					return std.CreateError("Function '%s' expects %d arguments, %d were given", fn.Name, len(fn.Params), argc)
+				}
+				vm.sp -= argc - len(fn.Params)
+				// The function and its arguments replace the current frame, which keeps its return slot.
+				target := frame.returnSp
+				copy(vm.stack[target:], vm.stack[vm.sp-len(fn.Params)-1:vm.sp])
+				vm.sp = target + len(fn.Params) + 1
+				frame.name, frame.site = fn.Name, frame.fn.Sites[start]
+				frame.fn, frame.ip, frame.base = fn, 0, target+1
+				vm.reserveLocals(frame)
+				continue
+			}
+			// The globals bound to builtins are called, and their result is returned.
+			result := vm.callBuiltin(vm.stack[vm.sp-argc-1].(*std.Builtin), argc, frame.fn.Sites[start])
+			if isError(result) {
+				return result
+			}
+			vm.push(result)
+			fallthrough
+		case compiler.OpReturn:
+			result := vm.pop()
+			if len(vm.frames) == 1 {
+				return result
+			}
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.returnSp
+			if frame.instance != nil {
+				result = frame.instance
+			}
+			if frame.callback {
+				return result
+			}
+			vm.push(result)
+			frame = vm.frames[len(vm.frames)-1]
+		case compiler.OpStruct:
+			definition := vm.constants[vm.readOperand(frame)].(*compiler.StructDefinition)
+			if err := vm.declareStruct(definition); err != nil {
+				return err
+			}
+			vm.push(std.NopInstance)
+		case compiler.OpNew:
+			name := vm.readString(frame)
+			argc := vm.readByte(frame)
+			t, found := vm.types[name]
+			if !found {
+				return std.CreateError("Type '%s' not found", name)
+			}
+			if _, found := t.GetConstructor(); !found && argc > 0 {
+				return std.CreateError("Cannot find a defined constructor on the '%s' type, make sure to define an 'init' method on the struct", t.Name)
+			}
+			vm.push(std.NewInstance(t))
+		case compiler.OpInit:
+			argc := vm.readByte(frame)
+			base := vm.sp - argc - 1
+			instance := vm.stack[base].(*std.CometInstance)
+			constructor, found := vm.methods[instance.Struct]["init"]
+			if !found {
+				// it's okay to create a struct instance with no explicit constructor, if the constructor call didn't specify a parameter
+				continue
+			}
+			if argc > len(constructor.Params) {
+				vm.sp -= argc - len(constructor.Params)
+			}
+			if err := vm.pushFrame(constructor, instance.Struct.Name+".init", lexer.Token{}, base, base, instance); err != nil {
+				return err
+			}
+			frame = vm.frames[len(vm.frames)-1]
+		case compiler.OpIterCheck:
+			iterable := vm.readOperand(frame)
+			counter := vm.readOperand(frame)
+			value := vm.pop()
+			switch n := value.(type) {
+			case *std.CometRange:
+				vm.stack[frame.base+counter] = &std.CometInt{Value: n.From.Value}
+			case *std.CometArray:
+				vm.stack[frame.base+counter] = &std.CometInt{Value: 0}
+			default:
+				return std.CreateError("Cannot iterate over value of type %s", value.Type())
+			}
+			vm.stack[frame.base+iterable] = value
+		case compiler.OpIterNext:
+			target := vm.readOperand(frame)
+			iterable := vm.stack[frame.base+vm.readOperand(frame)]
+			counterSlot := frame.base + vm.readOperand(frame)
+			counter := vm.stack[counterSlot].(*std.CometInt)
+			switch n := iterable.(type) {
+			case *std.CometRange:
+				if counter.Value > n.To.Value {
+					frame.ip = target
+					continue
+				}
+				vm.push(&std.CometInt{Value: counter.Value})
+			default:
+				array := n.(*std.CometArray)
+				if counter.Value >= int64(array.Length) {
+					frame.ip = target
+					continue
+				}
+				vm.push(array.Values[counter.Value])
+			}
+			vm.push(counter)
+			vm.stack[counterSlot] = &std.CometInt{Value: counter.Value + 1}
+		case compiler.OpMatchCase:
+			candidate := vm.pop()
+			subject := vm.pop()
+			vm.push(boolValue(eval.MatchesCase(subject, candidate)))
+		case compiler.OpMatch:
+			definition := vm.constants[vm.readOperand(frame)].(*compiler.PatternDefinition)
+			literals := make(map[*parser.LiteralPattern]std.CometObject, len(definition.Literals))
+			for i := len(definition.Literals) - 1; i >= 0; i-- {
+				literals[definition.Literals[i]] = vm.pop()
+			}
+			bindings := make(map[string]std.CometObject)
+			matched, err := vm.matchPattern(definition.Pattern, vm.pop(), literals, bindings)
+			if err != nil {
+				return err
+			}
+			if matched {
+				for _, name := range definition.Names {
+					vm.push(bindings[name])
+				}
+			}
+			vm.push(boolValue(matched))
+		case compiler.OpNoMatch:
+			return std.CreateError("No pattern matched the value %s", vm.pop().ToString())
+		case compiler.OpDestructureError:
+			definition := vm.constants[vm.readOperand(frame)].(*compiler.PatternDefinition)
+			return std.CreateError("Cannot destructure %s with the pattern %s", vm.pop().ToString(), definition.Pattern.Literal())
+		case compiler.OpError:
+			return std.CreateError("%s", vm.readString(frame))
+		default:
+			return std.CreateError("Unknown opcode %d", op)
+		}
+	}
+}
+
+// pushFrame starts the execution of fn, its arguments are the values between base and the stack pointer.
+// It reports an error if the maximum call depth is exceeded.
+func (vm *VM) pushFrame(fn *compiler.CompiledFunction, name string, site lexer.Token, base, returnSp int, instance *std.CometInstance) std.CometObject {
+	frame := &Frame{fn: fn, name: name, site: site, base: base, returnSp: returnSp, instance: instance}
+	// The frame of the program is not a call.
+	if vm.MaxCallDepth > 0 && len(vm.frames)-1 >= vm.MaxCallDepth {
+		calls := make([]string, 0, len(vm.frames))
+		for _, f := range append(vm.frames[1:], frame) {
+			calls = append(calls, eval.DescribeCall(f.name, f.site))
+		}
+		return eval.RecursionError(calls)
+	}
+	vm.frames = append(vm.frames, frame)
+	vm.reserveLocals(frame)
+	return nil
+}
+
+// CheckSize never reports an error, the VM has no collection size limit.
+func (vm *VM) CheckSize(size int64) std.CometObject {
+	return nil
+}
+
+// callBuiltin invokes the builtin with the argc arguments on top of the stack, the builtin and its
+// arguments are popped.
+func (vm *VM) callBuiltin(builtin *std.Builtin, argc int, site lexer.Token) std.CometObject {
+	args := make([]std.CometObject, argc)
+	copy(args, vm.stack[vm.sp-argc:vm.sp])
+	vm.sp -= argc + 1
+	return builtin.Invoke(vm.builtinContext(site), args...)
+}
+
+// builtinContext gives the builtins access to the VM and its streams.
+func (vm *VM) builtinContext(site lexer.Token) *std.Context {
+	return &std.Context{Interpreter: vm, Stdout: vm.Stdout, Stderr: vm.Stderr, Stdin: vm.Stdin, Site: site, Capabilities: vm.Capabilities}
+}
+
+// CallFunction invokes a function value with the given arguments, the frames of the calling
+// program stay on the stack so that the call sees its locals like in the evaluator. It's used by
+// the builtins taking callbacks.
+func (vm *VM) CallFunction(function std.CometObject, args ...std.CometObject) std.CometObject {
+	if builtin, ok := function.(*std.Builtin); ok {
+		return builtin.Invoke(vm.builtinContext(lexer.Token{}), args...)
+	}
+	fn, ok := function.(*compiler.CompiledFunction)
+	if !ok {
+		return std.CreateError("Cannot invoke none callable object of type %s", function.Type())
+	}
+	if len(args) < len(fn.Params) {
+		return std.CreateError("Function '%s' expects %d arguments, %d were given", fn.Name, len(fn.Params), len(args))
+	}
+	depth, returnSp := len(vm.frames), vm.sp
+	vm.push(fn)
+	for _, arg := range args[:len(fn.Params)] {
+		vm.push(arg)
+	}
+	if err := vm.pushFrame(fn, fn.Name, lexer.Token{}, returnSp+1, returnSp, nil); err != nil {
+		vm.sp = returnSp
+		return err
+	}
+	vm.frames[depth].callback = true
+	result := vm.run()
+	// The frames are left on the stack when the call fails.
+	vm.frames, vm.sp = vm.frames[:depth], returnSp
+	return result
+}
+
+// Lookup returns the value bound to the given name in the frames of the calls, innermost first,
+// or in the globals.
+func (vm *VM) Lookup(name string) (std.CometObject, bool) {
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		names := frame.fn.LocalNames
+		for slot := len(names) - 1; slot >= 0; slot-- {
+			if names[slot] == name && vm.stack[frame.base+slot] != nil {
+				return vm.stack[frame.base+slot], true
+			}
+		}
+	}
+	for i, global := range vm.globalNames {
+		if global == name && vm.globals[i] != nil {
+			return vm.globals[i], true
+		}
+	}
+	return nil, false
+}
+
+// lookupGlobal returns the value of a name resolved to a global. Like in the evaluator, where the
+// scope of a call has the scope of its caller as parent, the locals of the calling frames hide the
+// globals. The second returned value is the stack index of the local, -1 for globals.
+func (vm *VM) lookupGlobal(index int) (std.CometObject, int) {
+	name := vm.globalNames[index]
+	for i := len(vm.frames) - 2; i >= 0; i-- {
+		frame := vm.frames[i]
+		names := frame.fn.LocalNames
+		for slot := len(names) - 1; slot >= 0; slot-- {
+			if names[slot] == name && vm.stack[frame.base+slot] != nil {
+				return vm.stack[frame.base+slot], frame.base + slot
+			}
+		}
+	}
+	return vm.globals[index], -1
+}
+
+// reserveLocals pushes the locals of the frame that are not declared yet.
+func (vm *VM) reserveLocals(frame *Frame) {
+	for vm.sp < frame.base+frame.fn.NumLocals {
+		vm.push(nil)
+	}
+}
+
+func (vm *VM) callMethod(name string, argc int, site lexer.Token) std.CometObject {
+	base := vm.sp - argc - 1
+	receiver := vm.stack[base]
+	if native, ok := receiver.(std.NativeObject); ok {
+		args := make([]std.CometObject, argc)
+		copy(args, vm.stack[base+1:vm.sp])
+		vm.sp = base
+		result := native.CallMethod(vm.builtinContext(site), name, args...)
+		if isError(result) {
+			return result
+		}
+		vm.push(result)
+		return nil
+	}
+	if receiver.Type() != std.ObjType {
+		// You can't call methods on none object types
+		return std.CreateError("Cannot call method '%s' on none object type", name)
+	}
+	instance := receiver.(*std.CometInstance)
+	method, found := vm.methods[instance.Struct][name]
+	if !found {
+		return std.CreateError("Could not find method '%s' on type '%s'", name, instance.Struct.Name)
+	}
+	if len(method.Params) > argc {
+		return std.CreateError("Method '%s' on type '%s' expects at least %d parameters, %d were given",
+			method.Name,
+			instance.Struct.Name,
+			len(method.Params),
+			argc)
+	}
+	vm.sp -= argc - len(method.Params)
+	return vm.pushFrame(method, instance.Struct.Name+"."+name, site, base, base, nil)
+}
+
+func (vm *VM) declareStruct(definition *compiler.StructDefinition) std.CometObject {
+	s := &std.CometStruct{Name: definition.Name, Methods: make(map[string]*std.CometFunc)}
+	methods := make(map[string]*compiler.CompiledFunction)
+	for _, method := range definition.Methods {
+		if err := s.Add(&std.CometFunc{Name: method.Name, Params: method.Params}); err != nil {
+			return std.CreateError(err.Error())
+		}
+		methods[method.Name] = method
+	}
+	vm.types[s.Name] = s
+	vm.methods[s] = methods
+	return nil
+}
+
+func (vm *VM) push(obj std.CometObject) {
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, obj)
+	} else {
+		vm.stack[vm.sp] = obj
+	}
+	vm.sp++
+}
+
+func (vm *VM) pop() std.CometObject {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) readOperand(frame *Frame) int {
+	value := int(compiler.ReadUint16(frame.fn.Instructions[frame.ip:]))
+	frame.ip += 2
+	return value
+}
+
+func (vm *VM) readByte(frame *Frame) int {
+	value := int(frame.fn.Instructions[frame.ip])
+	frame.ip++
+	return value
+}
+
+// slice pops the bounds present in mask and the sliced target, see eval.Slice.
+func (vm *VM) slice(mask int) std.CometObject {
+	bounds := make([]std.CometObject, 3)
+	for i := 2; i >= 0; i-- {
+		if mask&(1<<uint(i)) != 0 {
+			bounds[i] = vm.pop()
+		}
+	}
+	return eval.Slice(vm.pop(), bounds[0], bounds[1], bounds[2])
+}
+
+func (vm *VM) readString(frame *Frame) string {
+	return vm.constants[vm.readOperand(frame)].(*std.CometStr).Value
+}
+
+var conditionStatements = map[compiler.Condition]string{
+	compiler.ConditionIf:         "if statement",
+	compiler.ConditionExpression: "conditional expression",
+	compiler.ConditionFor:        "for statement",
+	compiler.ConditionWhile:      "while statement",
+}
+
+func conditionError(condition compiler.Condition, value std.CometObject) std.CometObject {
+	return std.CreateError("Test part of the %s should evaluate to CometBool, evaluated to %s instead", conditionStatements[condition], value.ToString())
+}
+
+func unboundError(name string) std.CometObject {
+	return std.CreateError("Identifier (%s) is not bounded to any value, have you tried declaring it?", name)
+}
+
+func callable(value std.CometObject, name string) (std.CometObject, std.CometObject) {
+	if value == nil {
+		return nil, std.CreateError("Cannot find callable symbol %s", name)
+	}
+	switch value.(type) {
+	case *compiler.CompiledFunction, *std.Builtin:
+		return value, nil
+	default:
+		return nil, std.CreateError("Cannot invoke none callable object of type %s", value.Type())
+	}
+}
+
+func boolValue(condition bool) *std.CometBool {
+	if condition {
+		return std.TrueObject
+	}
+	return std.FalseObject
+}
+
+func newStr(value string) *std.CometStr {
+	return &std.CometStr{Value: value, Size: len(value)}
+}
+
+func isError(obj std.CometObject) bool {
+	return obj.Type() == std.ErrorType
+}
@@ -0,0 +1,250 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/chermehdi/comet/pkg/compiler"
+	"github.com/chermehdi/comet/pkg/eval"
+	"github.com/chermehdi/comet/pkg/internal/enginetest"
+	"github.com/chermehdi/comet/pkg/parser"
+	"github.com/chermehdi/comet/pkg/std"
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func runOrDie(t *testing.T, c *compiler.Compiler, vm *VM, src string) string {
+	p := parser.New(src)
+	root := p.Parse()
+	assert.False(t, p.Errors.HasAny(), p.Errors.String())
+	bytecode, err := c.Compile(root)
+	if !assert.NoError(t, err, src) {
+		return ""
+	}
+	return vm.Run(bytecode).ToString()
+}
+
+// The VM should produce the same results as the evaluator, every program of the evaluator tests is
+// executed by both. Programs are the string literals of a test function that parse without errors,
+// they are executed in order by the same Evaluator and VM.
+func TestVM_Run_MatchesEvaluator(t *testing.T) {
+	tests, err := enginetest.EvaluatorPrograms("../eval/evaluator_test.go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, test := range tests {
+		evaluator := eval.NewEvaluator()
+		c, vm := compiler.New(), New()
+		var evaluatorOutput, vmOutput bytes.Buffer
+		evaluator.Stdout, vm.Stdout = &evaluatorOutput, &vmOutput
+		for _, program := range test.Programs {
+			evaluator.Strict, vm.Strict = program.Strict, program.Strict
+			root, _ := enginetest.Parse(program.Src)
+			expected := evaluator.Eval(root).ToString()
+			assert.Equal(t, expected, runOrDie(t, c, vm, program.Src), "%s: %s", test.Name, program.Src)
+			assert.Equal(t, evaluatorOutput.String(), vmOutput.String(), "%s: %s", test.Name, program.Src)
+		}
+	}
+}
+
+// The modules of the standard library are imported by the VM like by the evaluator, the programs of
+// their tests are executed by both, each with a new Evaluator and VM. The programs are the constant
+// sources of the test tables, prefixed by the import of the module when they don't import it.
+func TestVM_Run_NativeModulesMatchEvaluator(t *testing.T) {
+	file, err := goparser.ParseFile(token.NewFileSet(), "../eval/modules_test.go", nil, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !strings.HasPrefix(fn.Name.Name, "TestEvaluator_Eval_") || !strings.HasSuffix(fn.Name.Name, "Module") {
+			continue
+		}
+		module := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(fn.Name.Name, "TestEvaluator_Eval_"), "Module"))
+		ast.Inspect(fn.Body, func(node ast.Node) bool {
+			test, ok := node.(*ast.CompositeLit)
+			if !ok || len(test.Elts) != 2 {
+				return true
+			}
+			src, ok := stringConstant(test.Elts[0])
+			// The types of the modules and the registered functions are only supported by the evaluator.
+			if !ok || strings.Contains(src, "new ") || strings.Contains(src, "q(") {
+				return false
+			}
+			if !strings.HasPrefix(src, "import") {
+				src = "import \"" + module + "\"\n " + src
+			}
+			root, ok := enginetest.Parse(src)
+			if !assert.True(t, ok, src) {
+				return false
+			}
+			expected := eval.NewEvaluator().Eval(root).ToString()
+			assert.Equal(t, expected, runOrDie(t, compiler.New(), New(), src), "%s: %s", fn.Name.Name, src)
+			return false
+		})
+	}
+}
+
+// stringConstant returns the value of a string literal or of a concatenation of string literals.
+func stringConstant(expr ast.Expr) (string, bool) {
+	switch n := expr.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.STRING {
+			return "", false
+		}
+		value, err := strconv.Unquote(n.Value)
+		return value, err == nil
+	case *ast.BinaryExpr:
+		if n.Op != token.ADD {
+			return "", false
+		}
+		left, ok := stringConstant(n.X)
+		if !ok {
+			return "", false
+		}
+		right, ok := stringConstant(n.Y)
+		return left + right, ok
+	default:
+		return "", false
+	}
+}
+
+func TestVM_Run_BuiltinContext(t *testing.T) {
+	apply := &std.Builtin{
+		Name:     "apply",
+		MinArgs:  1,
+		MaxArgs:  -1,
+		ArgTypes: []std.CometType{std.FuncType, std.AnyType},
+		Func: func(ctx *std.Context, args ...std.CometObject) std.CometObject {
+			return ctx.CallFunction(args[0], args[1:]...)
+		},
+	}
+	lookup := &std.Builtin{
+		Name:    "lookup",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(ctx *std.Context, args ...std.CometObject) std.CometObject {
+			value, found := ctx.Lookup(args[0].(*std.CometStr).Value)
+			if !found {
+				return ctx.Errorf("not bound")
+			}
+			return value
+		},
+	}
+	// The builtins are resolved by the compiler when it's created.
+	builtins := std.Builtins
+	std.Builtins = append(append([]*std.Builtin{}, builtins...), apply, lookup)
+	defer func() {
+		std.Builtins = builtins
+	}()
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"func double(x) { return x * 2 }\n apply(double, 21)", "CometInt(42)"},
+		{"func f(n) {\n if n == 0 { return 0 }\n return apply(f, n - 1) + 1\n }\n f(10)", "CometInt(10)"},
+		{"func f() {\n var local = 3\n return apply(g)\n }\n func g() { return lookup(\"local\") }\n f()", "CometInt(3)"},
+		{"func g() { return lookup(\"x\") }\n var x = 2\n 1 + apply(g) * 10", "CometInt(21)"},
+		{"func fail() { return 1 / 0 }\n apply(fail)", "Comet error: \n\n\tDivision by zero"},
+		{"func add(a, b) { return a + b }\n apply(add, 1)", "Comet error: \n\n\tFunction 'add' expects 2 arguments, 1 were given"},
+		{"var a = 1\n  lookup(\"b\")", "Comet error: \n\n\tnot bound (line 2, column 3)"},
+	}
+	for _, test := range tests {
+		c, vm := compiler.New(), New()
+		assert.Equal(t, test.Expected, runOrDie(t, c, vm, test.Src), test.Src)
+		assert.Len(t, vm.frames, 1, test.Src)
+	}
+	// Deep recursion through callbacks is bounded like the other calls.
+	c, vm := compiler.New(), New()
+	vm.MaxCallDepth = 50
+	result := runOrDie(t, c, vm, "func f(n) { return apply(f, n + 1) }\n f(0)")
+	assert.True(t, strings.HasPrefix(result, "Comet error: \n\n\tmaximum recursion depth exceeded (50 nested calls)"), result)
+}
+
+func TestVM_Run_Capabilities(t *testing.T) {
+	c, vm := compiler.New(), New()
+	assert.Equal(t, "Comet error: \n\n\tPermission denied: builtin 'env' needs access to the environment (line 1, column 1)", runOrDie(t, c, vm, `env("HOME")`))
+
+	exitCode := -1
+	c, vm = compiler.New(), New()
+	vm.Capabilities = std.Capabilities{Exit: func(code int) { exitCode = code }, Args: []string{"a"}}
+	assert.Equal(t, `[CometStr("a")]`, runOrDie(t, c, vm, "exit(2)\n args()"))
+	assert.Equal(t, 2, exitCode)
+
+	// The declarations of the program shadow the builtins, whatever the capabilities.
+	c, vm = compiler.New(), New()
+	assert.Equal(t, "CometBool(true)", runOrDie(t, c, vm, "func exists(n) { return true }\n exists(\"x\")"))
+	assert.Equal(t, "CometInt(4)", runOrDie(t, c, vm, "func exit(code) { return code * 2 }\n exit(2)"))
+	assert.Equal(t, 2, exitCode)
+}
+
+func TestVM_Run_Imports(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"import { upper } from \"strings\"\n func f(x) { return upper(x) }\n f(\"a\")", `CometStr("A")`},
+		{"import { len } from \"strings\"\n func f(x) { return len(x) }\n f([1])", "Comet error: \n\n\tArgument 1 of builtin 'strings.len' expected to be STR, got ARRAY instead (line 2, column 21)"},
+		{"func f() {\n import \"math\" as m\n return m.abs(0 - 2)\n }\n f()", "CometInt(2)"},
+		{"import \"strings\" as s\n s.upper += \"a\"", "Comet error: \n\n\tCannot assign 'upper', the members of module 'strings' are read only"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, runOrDie(t, compiler.New(), New(), test.Src), test.Src)
+	}
+	root, _ := enginetest.Parse("import \"lib\" as l")
+	_, err := compiler.New().Compile(root)
+	assert.EqualError(t, err, "cannot compile the import of lib, only the modules of the standard library are supported by the vm")
+}
+
+func TestVM_Run_Errors(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"var a = [1]\n a[0] = pop(a)", "Comet error: \n\n\tArray access out of bounds, array of length 0, index was: 0"},
+		{"var a = [1]\n a[0] += pop(a)", "Comet error: \n\n\tArray access out of bounds, array of length 0, index was: 0"},
+		{"var a = [1]\n a[1] = 2", "Comet error: \n\n\tArray access out of bounds, array of length 1, index was: 1"},
+		{"var s = \"a\"\n s[0] = \"b\"", "Comet error: \n\n\tCannot assign to an index of a CometStr, strings are immutable"},
+		{"func f(a, b) { return a }\n f(1)", "Comet error: \n\n\tFunction 'f' expects 2 arguments, 1 were given"},
+		{"func f(a, b) { return a }\n func g() { return f(1) }\n g()", "Comet error: \n\n\tFunction 'f' expects 2 arguments, 1 were given"},
+		{"func f(a) { return 2 }\n func g() { return f(1 / 0) }\n g()", "Comet error: \n\n\tDivision by zero"},
+		{"var a = 1\n a[0]", "Comet error: \n\n\tExpected CometArray or CometStr got INTEGER"},
+		{"var a = [1]\n a[\"x\"]", "Comet error: \n\n\tExpected CometInt got STR"},
+		{"var s = \"ab\"\n s[2]", "Comet error: \n\n\tString access out of bounds, string of length 2, index was: 2"},
+		{"var a = 1\n a[0:1]", "Comet error: \n\n\tCannot slice value of type INTEGER"},
+		{"var a = [1, 2]\n a[\"x\":]", "Comet error: \n\n\tSlice bounds should be CometInt got STR"},
+		{"var a = [1, 2]\n a[::0]", "Comet error: \n\n\tSlice step cannot be zero"},
+		{"-\"a\"", "Comet error: \n\n\tCannot apply operator (-) on none INTEGER type STR"},
+		{"var x = 1\n x()", "Comet error: \n\n\tCannot invoke none callable object of type INTEGER"},
+		{"y + 1", "Comet error: \n\n\tIdentifier (y) is not bounded to any value, have you tried declaring it?"},
+		{"var a = 1\n a.b", "Comet error: \n\n\tCannot access field 'b' on none object type INTEGER"},
+		{"var a = 1\n a.b = 2", "Comet error: \n\n\tCannot set field 'b' on none object type INTEGER"},
+		{"match 1 { Point(x) => x }", "Comet error: \n\n\tType 'Point' not found"},
+		{"struct P { func init(x) { this.x = x } }\n match new P(1) { P(a, b) => a }", "Comet error: \n\n\tPattern P(a, b) expects 2 fields, the constructor of 'P' has 1 parameters"},
+		{"match 1 { 1 / 0 => 1 }", "Comet error: \n\n\tDivision by zero"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.Expected, runOrDie(t, compiler.New(), New(), test.Src), test.Src)
+	}
+}
+
+func TestVM_Run_StrictModeErrors(t *testing.T) {
+	tests := []struct {
+		Src      string
+		Expected string
+	}{
+		{"if 1 { 2 }", "Comet error: \n\n\tTest part of the if statement should evaluate to CometBool, evaluated to CometInt(1) instead"},
+		{"while 1 { }", "Comet error: \n\n\tTest part of the while statement should evaluate to CometBool, evaluated to CometInt(1) instead"},
+		{"var x = 1 ? 2 : 3", "Comet error: \n\n\tTest part of the conditional expression should evaluate to CometBool, evaluated to CometInt(1) instead"},
+		{"!1", "Comet error: \n\n\tCannot apply operator (!) on none BOOLEAN type INTEGER"},
+		{"1 && true", "Comet error: \n\n\tCannot apply operator (&&) on none BOOLEAN type INTEGER"},
+	}
+	for _, test := range tests {
+		vm := New()
+		vm.Strict = true
+		assert.Equal(t, test.Expected, runOrDie(t, compiler.New(), vm, test.Src), test.Src)
+	}
+}